@@ -0,0 +1,106 @@
+package bolt
+
+import (
+	"context"
+	"github.com/orchestd/cacheStorage"
+	bbolt "go.etcd.io/bbolt"
+	"time"
+)
+
+const openTimeout = time.Second
+
+type boltCacheStorage struct {
+	db       *bbolt.DB
+	database []byte
+	options  cacheStorage.StorageOptions
+}
+
+// NewBoltCacheStorage returns a CacheStorage persisted in a bbolt file. Connect takes the file path as host and keeps
+// every collection as a bucket nested in a bucket named after database, so several databases can share a file.
+// The credentials are ignored.
+func NewBoltCacheStorage(options ...cacheStorage.StorageOption) cacheStorage.CacheStorage {
+	return &boltCacheStorage{options: cacheStorage.NewStorageOptions(options...)}
+}
+
+func (s *boltCacheStorage) Connect(c context.Context, host, userName, userPw, database string) error {
+	db, err := bbolt.Open(host, 0600, &bbolt.Options{Timeout: openTimeout})
+	if err != nil {
+		return err
+	}
+	err = db.Update(func(tx *bbolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists([]byte(database))
+		if err != nil {
+			return err
+		}
+		return indexIds(bucket)
+	})
+	if err != nil {
+		db.Close()
+		return err
+	}
+	s.db = db
+	s.database = []byte(database)
+	return nil
+}
+
+func (s boltCacheStorage) Close(c context.Context) error {
+	return s.db.Close()
+}
+
+func (s *boltCacheStorage) GetCacheStorageClient() (cacheStorage.CacheStorageGetter, cacheStorage.CacheStorageSetter) {
+	client := boltClient{storage: s}
+	return client, client
+}
+
+func (s *boltCacheStorage) GetLocker() *cacheStorage.Locker {
+	return cacheStorage.NewLocker(boltLeases{storage: s}, s.options.Lock)
+}
+
+// collection returns the bucket of collectionName, or nil if nothing was ever written to it and create is false.
+func (s *boltCacheStorage) collection(tx *bbolt.Tx, collectionName string, create bool) (*bbolt.Bucket, error) {
+	database := tx.Bucket(s.database)
+	if !create {
+		return database.Bucket([]byte(collectionName)), nil
+	}
+	return database.CreateBucketIfNotExists([]byte(collectionName))
+}
+
+// ids returns the index by id of collectionName, or nil if nothing was ever written to it and create is false.
+func (s *boltCacheStorage) ids(tx *bbolt.Tx, collectionName string, create bool) (*bbolt.Bucket, error) {
+	ids := tx.Bucket(s.database).Bucket(idsBucket)
+	if !create {
+		return ids.Bucket([]byte(collectionName)), nil
+	}
+	return ids.CreateBucketIfNotExists([]byte(collectionName))
+}
+
+// indexIds indexes by id the collections of database written before the index was kept, which have no index yet.
+func indexIds(database *bbolt.Bucket) error {
+	ids, err := database.CreateBucketIfNotExists(idsBucket)
+	if err != nil {
+		return err
+	}
+	var unindexed [][]byte
+	err = database.ForEach(func(name, v []byte) error {
+		if v == nil && name[0] != 0 && ids.Bucket(name) == nil {
+			unindexed = append(unindexed, append([]byte(nil), name...))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, name := range unindexed {
+		index, err := ids.CreateBucket(name)
+		if err != nil {
+			return err
+		}
+		err = database.Bucket(name).ForEach(func(k, v []byte) error {
+			return index.Put(idKey(keyId(k), keySeq(k)), k)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
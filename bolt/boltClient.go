@@ -0,0 +1,661 @@
+package bolt
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	. "github.com/orchestd/cacheStorage"
+	"github.com/orchestd/cacheStorage/internal/dest"
+	bbolt "go.etcd.io/bbolt"
+	"time"
+)
+
+const cacheVersionsCollectionName = "cacheVersions"
+
+const keySeparator = 0
+
+type LockedItem struct {
+	LockedAt time.Time `json:"lockedAt"`
+	LockedBy string    `json:"lockedBy"`
+}
+
+type CacheWrapper struct {
+	Id          string      `json:"id"`
+	Ver         string      `json:"ver"`
+	Data        string      `json:"data"`
+	Codec       string      `json:"codec,omitempty"`
+	Compression string      `json:"compression,omitempty"`
+	KeyId       string      `json:"keyId,omitempty"`
+	Locked      *LockedItem `json:"locked"`
+	// Fence counts the locks taken on the item, and outlives them.
+	Fence int64 `json:"fence,omitempty"`
+}
+
+func (w CacheWrapper) AddData(encoded EncodedItem) CacheWrapper {
+	w.Data, w.Codec, w.Compression, w.KeyId = encoded.Text(), encoded.Codec, encoded.Compression, encoded.KeyId
+	return w
+}
+
+/*
+Items are keyed by ver, id and the collection's insertion sequence, separated by a zero byte, so the items of a
+version and the items of an id+ver are both a single prefix scan, in insertion order. Like a mongo collection without
+a unique index the same id+ver may hold more than one item; single item operations act on the first one.
+*/
+func verPrefix(ver string) []byte {
+	return append([]byte(ver), keySeparator)
+}
+
+func itemPrefix(id, ver string) []byte {
+	return append(append(verPrefix(ver), id...), keySeparator)
+}
+
+func itemKey(id, ver string, seq uint64) []byte {
+	return append(itemPrefix(id, ver), itemSeq(seq)...)
+}
+
+func itemSeq(seq uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, seq)
+	return b
+}
+
+func keySeq(k []byte) []byte {
+	return k[len(k)-8:]
+}
+
+// keyId returns the id of the item keyed k.
+func keyId(k []byte) string {
+	return string(k[bytes.IndexByte(k, keySeparator)+1 : len(k)-9])
+}
+
+/*
+idsBucket indexes the items of every collection by id, next to the collections of the database, so the first item of
+an id in any version is found without reading the whole collection. It holds a bucket per collection, keeping the key
+of every item under its id and insertion sequence, separated by a zero byte. Its name starts with a NUL byte so it
+can't be taken for a collection.
+*/
+var idsBucket = []byte("\x00ids")
+
+func idKey(id string, seq []byte) []byte {
+	return append(append([]byte(id), keySeparator), seq...)
+}
+
+func scanPrefix(bucket *bbolt.Bucket, prefix []byte, f func(k, v []byte) (bool, error)) error {
+	if bucket == nil {
+		return nil
+	}
+	cur := bucket.Cursor()
+	for k, v := cur.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = cur.Next() {
+		if next, err := f(k, v); err != nil || !next {
+			return err
+		}
+	}
+	return nil
+}
+
+func firstItem(bucket *bbolt.Bucket, id, ver string) (k, v []byte) {
+	scanPrefix(bucket, itemPrefix(id, ver), func(key, value []byte) (bool, error) {
+		k, v = append([]byte(nil), key...), value
+		return false, nil
+	})
+	return k, v
+}
+
+// firstById returns the oldest item with the given id in any version matching match, the same one FindOneAndUpdate by
+// id would, looking it up in ids, the index of bucket.
+func firstById(bucket, ids *bbolt.Bucket, id string, match func(CacheWrapper) bool) (k []byte, wrap CacheWrapper, err error) {
+	if bucket == nil || ids == nil {
+		return nil, wrap, nil
+	}
+	err = scanPrefix(ids, idKey(id, nil), func(_, key []byte) (bool, error) {
+		var w CacheWrapper
+		if err := json.Unmarshal(bucket.Get(key), &w); err != nil {
+			return false, err
+		}
+		if !match(w) {
+			return true, nil
+		}
+		k, wrap = append([]byte(nil), key...), w
+		return false, nil
+	})
+	return k, wrap, err
+}
+
+type boltClient struct {
+	storage *boltCacheStorage
+}
+
+// wrap encodes item the way the items of collectionName are configured to be, into w.
+func (m boltClient) wrap(collectionName string, w CacheWrapper, item interface{}) (CacheWrapper, error) {
+	encoded, err := m.storage.options.EncodeItem(collectionName, item)
+	if err != nil {
+		return w, err
+	}
+	return w.AddData(encoded), nil
+}
+
+// unwrap returns the func decoding the item of w into its dest, with the keys of the storage when it is encrypted.
+func (m boltClient) unwrap(w CacheWrapper) func(interface{}) error {
+	return func(i interface{}) error {
+		return m.storage.options.DecodeText(EncodedItem{Codec: w.Codec, Compression: w.Compression, KeyId: w.KeyId}, w.Data, i)
+	}
+}
+
+func (m boltClient) GetLatestVersions(c context.Context) ([]CacheVersion, CacheStorageError) {
+	cacheVersions := make(map[string]CacheVersion)
+	var versions []CacheVersion
+	err := m.GetAll(c, cacheVersionsCollectionName, "1", cacheVersions)
+	if err != nil {
+		return versions, err
+	}
+	for i := range cacheVersions {
+		versions = append(versions, cacheVersions[i])
+	}
+	return versions, nil
+}
+
+func (m boltClient) GetLatestCollectionVersion(c context.Context, collection string) (CacheVersion, CacheStorageError) {
+	cacheVersion := CacheVersion{}
+	err := m.GetById(c, cacheVersionsCollectionName, collection, "1", &cacheVersion)
+	if err != nil {
+		return cacheVersion, err
+	}
+	return cacheVersion, nil
+}
+
+// GetStoredVersions seeks from every ver found to the first key past all of its items, instead of reading them all.
+func (m boltClient) GetStoredVersions(c context.Context, collectionName string) ([]string, CacheStorageError) {
+	var vers []string
+	err := m.storage.db.View(func(tx *bbolt.Tx) error {
+		bucket, _ := m.storage.collection(tx, collectionName, false)
+		if bucket == nil {
+			return nil
+		}
+		cur := bucket.Cursor()
+		for k, _ := cur.First(); k != nil; {
+			ver := k[:bytes.IndexByte(k, keySeparator)]
+			vers = append(vers, string(ver))
+			k, _ = cur.Seek(append(append([]byte(nil), ver...), keySeparator+1))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, NewCacheStorageError(err)
+	}
+	return vers, nil
+}
+
+func (m boltClient) GetById(ctx context.Context, collectionName string, id string, ver string, dst interface{}) CacheStorageError {
+	err := dest.Check(dst, true, true, false, false)
+	if err != nil {
+		return NewCacheStorageError(fmt.Errorf("%w: %q", ErrInvalidDestType, err))
+	}
+	err = m.storage.db.View(func(tx *bbolt.Tx) error {
+		bucket, _ := m.storage.collection(tx, collectionName, false)
+		_, v := firstItem(bucket, id, ver)
+		if v == nil {
+			err := fmt.Errorf("element with id: %v not found in collection %v by version %v", id, collectionName, ver)
+			return fmt.Errorf("%w: %q", ErrNotFound, err)
+		}
+		var wrap CacheWrapper
+		if err := json.Unmarshal(v, &wrap); err != nil {
+			return err
+		}
+		return m.unwrap(wrap)(dst)
+	})
+	if err != nil {
+		return NewCacheStorageError(err)
+	}
+	return nil
+}
+
+func (m boltClient) getMany(ctx context.Context, collectionName string, filterByIds []string, ver string, dst interface{}) CacheStorageError {
+	err := dest.Check(dst, false, true, true, false)
+	if err != nil {
+		return NewCacheStorageError(fmt.Errorf("%w: %q", ErrInvalidDestType, err))
+	}
+	foundElementIds := make(map[string]bool)
+	setItem := func(k, v []byte) (bool, error) {
+		var wrap CacheWrapper
+		if err := json.Unmarshal(v, &wrap); err != nil {
+			return false, err
+		}
+		if err := dest.SetMapItem(dst, wrap.Id, m.unwrap(wrap)); err != nil {
+			return false, err
+		}
+		foundElementIds[wrap.Id] = true
+		return true, nil
+	}
+	err = m.storage.db.View(func(tx *bbolt.Tx) error {
+		bucket, _ := m.storage.collection(tx, collectionName, false)
+		if len(filterByIds) == 0 {
+			return scanPrefix(bucket, verPrefix(ver), setItem)
+		}
+		for _, id := range filterByIds {
+			if err := scanPrefix(bucket, itemPrefix(id, ver), setItem); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return NewCacheStorageError(err)
+	}
+	if len(foundElementIds) < len(filterByIds) {
+		var notFoundElements []string
+		for _, id := range filterByIds {
+			if _, ok := foundElementIds[id]; !ok {
+				notFoundElements = append(notFoundElements, id)
+			}
+		}
+		// len == 0 meaning the func got ids with duplicates
+		if len(notFoundElements) > 0 {
+			err := fmt.Errorf("elements with id: %v not found in collection %v by version %v", notFoundElements, collectionName, ver)
+			return NewCacheStorageError(fmt.Errorf("%w: %q", ErrNotFound, err))
+		}
+	}
+	return nil
+}
+
+func (m boltClient) GetManyByIds(ctx context.Context, collectionName string, ids []string, ver string, dst interface{}) CacheStorageError {
+	if len(ids) == 0 {
+		return nil
+	}
+	return m.getMany(ctx, collectionName, ids, ver, dst)
+}
+
+func (m boltClient) GetArrayBySingleId(ctx context.Context, collectionName string, id string, ver string, dst interface{}) CacheStorageError {
+	err := dest.Check(dst, false, true, false, true)
+	if err != nil {
+		return NewCacheStorageError(fmt.Errorf("%w: %q", ErrInvalidDestType, err))
+	}
+	err = m.storage.db.View(func(tx *bbolt.Tx) error {
+		bucket, _ := m.storage.collection(tx, collectionName, false)
+		return scanPrefix(bucket, itemPrefix(id, ver), func(k, v []byte) (bool, error) {
+			var wrap CacheWrapper
+			if err := json.Unmarshal(v, &wrap); err != nil {
+				return false, err
+			}
+			return true, dest.AppendSliceItem(dst, m.unwrap(wrap))
+		})
+	})
+	if err != nil {
+		return NewCacheStorageError(err)
+	}
+	return nil
+}
+
+func (m boltClient) GetAll(ctx context.Context, collectionName string, ver string, dst interface{}) CacheStorageError {
+	return m.getMany(ctx, collectionName, nil, ver, dst)
+}
+
+func put(bucket *bbolt.Bucket, k []byte, wrap CacheWrapper) error {
+	v, err := json.Marshal(wrap)
+	if err != nil {
+		return err
+	}
+	return bucket.Put(k, v)
+}
+
+func insert(bucket, ids *bbolt.Bucket, wrap CacheWrapper) error {
+	seq, err := bucket.NextSequence()
+	if err != nil {
+		return err
+	}
+	k := itemKey(wrap.Id, wrap.Ver, seq)
+	if err := put(bucket, k, wrap); err != nil {
+		return err
+	}
+	return ids.Put(idKey(wrap.Id, keySeq(k)), k)
+}
+
+// remove deletes the item keyed k from bucket and from ids, its index.
+func remove(bucket, ids *bbolt.Bucket, k []byte) error {
+	if err := bucket.Delete(k); err != nil {
+		return err
+	}
+	return ids.Delete(idKey(keyId(k), keySeq(k)))
+}
+
+func (m boltClient) Insert(ctx context.Context, collectionName string, id string, ver string, item interface{}) CacheStorageError {
+	wrap, err := m.wrap(collectionName, CacheWrapper{Id: id, Ver: ver}, item)
+	if err != nil {
+		return NewCacheStorageError(err)
+	}
+	err = m.storage.db.Update(func(tx *bbolt.Tx) error {
+		bucket, err := m.storage.collection(tx, collectionName, true)
+		if err != nil {
+			return err
+		}
+		ids, err := m.storage.ids(tx, collectionName, true)
+		if err != nil {
+			return err
+		}
+		return insert(bucket, ids, wrap)
+	})
+	if err != nil {
+		return NewCacheStorageError(err)
+	}
+	return nil
+}
+
+func (m boltClient) InsertMany(ctx context.Context, collectionName string, ver string, items map[string]interface{}) CacheStorageError {
+	encoded, err := m.storage.options.EncodeItems(collectionName, items)
+	if err != nil {
+		return NewCacheStorageError(err)
+	}
+	var wraps []CacheWrapper
+	for id, item := range encoded {
+		wraps = append(wraps, CacheWrapper{Id: id, Ver: ver}.AddData(item))
+	}
+	err = m.storage.db.Update(func(tx *bbolt.Tx) error {
+		bucket, err := m.storage.collection(tx, collectionName, true)
+		if err != nil {
+			return err
+		}
+		ids, err := m.storage.ids(tx, collectionName, true)
+		if err != nil {
+			return err
+		}
+		for _, wrap := range wraps {
+			if err := insert(bucket, ids, wrap); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return NewCacheStorageError(err)
+	}
+	return nil
+}
+
+func (m boltClient) replace(ctx context.Context, collectionName string, id string, ver string, item interface{}, upsert bool) CacheStorageError {
+	wrap, err := m.wrap(collectionName, CacheWrapper{Id: id, Ver: ver}, item)
+	if err != nil {
+		return NewCacheStorageError(err)
+	}
+	err = m.storage.db.Update(func(tx *bbolt.Tx) error {
+		bucket, err := m.storage.collection(tx, collectionName, upsert)
+		if err != nil || bucket == nil {
+			return err
+		}
+		if k, v := firstItem(bucket, id, ver); k != nil {
+			var current CacheWrapper
+			if err := json.Unmarshal(v, &current); err != nil {
+				return err
+			}
+			if m.guarded(current) {
+				return fmt.Errorf("%w: item %v of collection %v is locked by another owner", ErrLockNotHeld, id, collectionName)
+			}
+			wrap.Fence = current.Fence
+			return put(bucket, k, wrap)
+		}
+		if upsert {
+			ids, err := m.storage.ids(tx, collectionName, true)
+			if err != nil {
+				return err
+			}
+			return insert(bucket, ids, wrap)
+		}
+		return nil
+	})
+	if err != nil {
+		return NewCacheStorageError(err)
+	}
+	return nil
+}
+
+// guarded tells whether w holds a lock that Update must not overwrite, see LockOptions.GuardUpdates.
+func (m boltClient) guarded(w CacheWrapper) bool {
+	return m.storage.options.Lock.GuardUpdates && w.Locked != nil && time.Since(w.Locked.LockedAt) <= m.storage.options.Lock.Lease
+}
+
+func (m boltClient) InsertOrUpdate(ctx context.Context, collectionName string, id string, ver string, item interface{}) CacheStorageError {
+	return m.replace(ctx, collectionName, id, ver, item, true)
+}
+
+func (m boltClient) Update(ctx context.Context, collectionName string, id string, ver string, item interface{}) CacheStorageError {
+	return m.replace(ctx, collectionName, id, ver, item, false)
+}
+
+func (m boltClient) Remove(ctx context.Context, collectionName string, id string, ver string) CacheStorageError {
+	err := m.storage.db.Update(func(tx *bbolt.Tx) error {
+		bucket, _ := m.storage.collection(tx, collectionName, false)
+		ids, _ := m.storage.ids(tx, collectionName, false)
+		if k, _ := firstItem(bucket, id, ver); k != nil {
+			return remove(bucket, ids, k)
+		}
+		return nil
+	})
+	if err != nil {
+		return NewCacheStorageError(err)
+	}
+	return nil
+}
+
+func (m boltClient) RemoveAll(ctx context.Context, collectionName string, ver string) CacheStorageError {
+	err := m.storage.db.Update(func(tx *bbolt.Tx) error {
+		bucket, _ := m.storage.collection(tx, collectionName, false)
+		ids, _ := m.storage.ids(tx, collectionName, false)
+		var keys [][]byte
+		scanPrefix(bucket, verPrefix(ver), func(k, v []byte) (bool, error) {
+			keys = append(keys, append([]byte(nil), k...))
+			return true, nil
+		})
+		for _, k := range keys {
+			if err := remove(bucket, ids, k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return NewCacheStorageError(err)
+	}
+	return nil
+}
+
+func (m boltClient) GetAndLockById(c context.Context, collectionName string, id string, dst interface{}) (LockHandle, CacheStorageError) {
+	handle := LockHandle{Collection: collectionName, Id: id, Owner: NewLockOwner()}
+	wait := m.storage.options.Lock.NewLockWait(collectionName, id)
+	for {
+		var wrap CacheWrapper
+		err := m.storage.db.Update(func(tx *bbolt.Tx) error {
+			bucket, _ := m.storage.collection(tx, collectionName, false)
+			ids, _ := m.storage.ids(tx, collectionName, false)
+			k, first, err := firstById(bucket, ids, id, func(CacheWrapper) bool { return true })
+			if err != nil {
+				return err
+			}
+			if k == nil {
+				err := fmt.Errorf("element with id: %v not found in collection %v", id, collectionName)
+				return fmt.Errorf("%w: %q", ErrNotFound, err)
+			}
+			wrap = first
+			if now := time.Now(); wrap.Locked == nil || now.Sub(wrap.Locked.LockedAt) > m.storage.options.Lock.Lease {
+				wrap.Locked = &LockedItem{LockedAt: now, LockedBy: handle.Owner}
+				wrap.Fence++
+				return put(bucket, k, wrap)
+			}
+			return nil
+		})
+		if err != nil {
+			return LockHandle{}, NewCacheStorageError(err)
+		}
+		if wrap.Locked.LockedBy == handle.Owner {
+			if err := m.unwrap(wrap)(dst); err != nil {
+				return LockHandle{}, NewCacheStorageError(err)
+			}
+			handle.Fence = wrap.Fence
+			return handle, nil
+		}
+		if err := wait.Sleep(c, nil); err != nil {
+			return LockHandle{}, NewCacheStorageError(err)
+		}
+	}
+}
+
+/*
+ReleaseLockedById in most cases will do nothing, cause UpdateAndRelease writes the item without a lock and
+therefore "automatically releases" the item a specific session locked
+*/
+func (m boltClient) ReleaseLockedById(c context.Context, lock LockHandle) CacheStorageError {
+	err := m.storage.db.Update(func(tx *bbolt.Tx) error {
+		bucket, _ := m.storage.collection(tx, lock.Collection, false)
+		ids, _ := m.storage.ids(tx, lock.Collection, false)
+		k, wrap, err := firstById(bucket, ids, lock.Id, func(w CacheWrapper) bool {
+			return w.Locked != nil && w.Locked.LockedBy == lock.Owner
+		})
+		if err != nil || k == nil {
+			return err
+		}
+		wrap.Locked = nil
+		return put(bucket, k, wrap)
+	})
+	if err != nil {
+		return NewCacheStorageError(err)
+	}
+	return nil
+}
+
+func (m boltClient) UpdateAndRelease(c context.Context, lock LockHandle, item interface{}) CacheStorageError {
+	wrap, err := m.wrap(lock.Collection, CacheWrapper{Id: lock.Id}, item)
+	if err != nil {
+		return NewCacheStorageError(err)
+	}
+	err = m.storage.db.Update(func(tx *bbolt.Tx) error {
+		now := time.Now()
+		bucket, _ := m.storage.collection(tx, lock.Collection, false)
+		ids, _ := m.storage.ids(tx, lock.Collection, false)
+		k, current, err := firstById(bucket, ids, lock.Id, func(w CacheWrapper) bool {
+			return w.Locked != nil && w.Locked.LockedBy == lock.Owner && now.Sub(w.Locked.LockedAt) <= m.storage.options.Lock.Lease
+		})
+		if err != nil {
+			return err
+		}
+		if k == nil {
+			return fmt.Errorf("%w: item %v of collection %v", ErrLockNotHeld, lock.Id, lock.Collection)
+		}
+		wrap.Ver, wrap.Fence = current.Ver, current.Fence
+		return put(bucket, k, wrap)
+	})
+	if err != nil {
+		return NewCacheStorageError(err)
+	}
+	return nil
+}
+
+func (m boltClient) RenewLock(c context.Context, lock LockHandle) CacheStorageError {
+	err := m.storage.db.Update(func(tx *bbolt.Tx) error {
+		now := time.Now()
+		bucket, _ := m.storage.collection(tx, lock.Collection, false)
+		ids, _ := m.storage.ids(tx, lock.Collection, false)
+		k, wrap, err := firstById(bucket, ids, lock.Id, func(w CacheWrapper) bool {
+			return w.Locked != nil && w.Locked.LockedBy == lock.Owner && now.Sub(w.Locked.LockedAt) <= m.storage.options.Lock.Lease
+		})
+		if err != nil {
+			return err
+		}
+		if k == nil {
+			return fmt.Errorf("%w: item %v of collection %v", ErrLockNotHeld, lock.Id, lock.Collection)
+		}
+		wrap.Locked.LockedAt = now
+		return put(bucket, k, wrap)
+	})
+	if err != nil {
+		return NewCacheStorageError(err)
+	}
+	return nil
+}
+
+func (m boltClient) UpdateCacheVersion(c context.Context, collection string, update func(cacheVersion *CacheVersion) error) CacheStorageError {
+	err := m.storage.db.Update(func(tx *bbolt.Tx) error {
+		bucket, err := m.storage.collection(tx, cacheVersionsCollectionName, true)
+		if err != nil {
+			return err
+		}
+		cacheVersion := CacheVersion{CollectionName: collection}
+		wrap := CacheWrapper{Id: collection, Ver: "1"}
+		k, v := firstItem(bucket, collection, "1")
+		if k != nil {
+			if err := json.Unmarshal(v, &wrap); err != nil {
+				return err
+			}
+			if err := m.unwrap(wrap)(&cacheVersion); err != nil {
+				return err
+			}
+		}
+		if err := update(&cacheVersion); err != nil {
+			return err
+		}
+		if wrap, err = m.wrap(cacheVersionsCollectionName, wrap, cacheVersion); err != nil {
+			return err
+		}
+		if k != nil {
+			return put(bucket, k, wrap)
+		}
+		ids, err := m.storage.ids(tx, cacheVersionsCollectionName, true)
+		if err != nil {
+			return err
+		}
+		return insert(bucket, ids, wrap)
+	})
+	if err != nil {
+		return NewCacheStorageError(err)
+	}
+	return nil
+}
+
+func (m boltClient) MoveVersion(c context.Context, collectionName string, fromVer string, toVer string) (int, CacheStorageError) {
+	moved := 0
+	err := m.storage.db.Update(func(tx *bbolt.Tx) error {
+		bucket, _ := m.storage.collection(tx, collectionName, false)
+		if bucket == nil {
+			return nil
+		}
+		if k, _ := bucket.Cursor().Seek(verPrefix(toVer)); k != nil && bytes.HasPrefix(k, verPrefix(toVer)) {
+			err := fmt.Errorf("ver %v of collection %v", toVer, collectionName)
+			return fmt.Errorf("%w: %q", ErrVerInUse, err)
+		}
+		var keys [][]byte
+		var wraps []CacheWrapper
+		err := scanPrefix(bucket, verPrefix(fromVer), func(k, v []byte) (bool, error) {
+			var wrap CacheWrapper
+			if err := json.Unmarshal(v, &wrap); err != nil {
+				return false, err
+			}
+			keys = append(keys, append([]byte(nil), k...))
+			wraps = append(wraps, wrap)
+			return true, nil
+		})
+		if err != nil {
+			return err
+		}
+		ids, err := m.storage.ids(tx, collectionName, true)
+		if err != nil {
+			return err
+		}
+		for i, k := range keys {
+			if err := bucket.Delete(k); err != nil {
+				return err
+			}
+			wraps[i].Ver = toVer
+			key := append(itemPrefix(wraps[i].Id, toVer), keySeq(k)...)
+			if err := put(bucket, key, wraps[i]); err != nil {
+				return err
+			}
+			if err := ids.Put(idKey(wraps[i].Id, keySeq(k)), key); err != nil {
+				return err
+			}
+		}
+		moved = len(keys)
+		return nil
+	})
+	if err != nil {
+		return 0, NewCacheStorageError(err)
+	}
+	return moved, nil
+}
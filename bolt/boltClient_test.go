@@ -0,0 +1,233 @@
+package bolt
+
+import (
+	"bytes"
+	"context"
+	"github.com/orchestd/cacheStorage"
+	"github.com/orchestd/cacheStorage/cacheStoragetest"
+	bbolt "go.etcd.io/bbolt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConformance(t *testing.T) {
+	cacheStoragetest.RunConformance(t, func(t *testing.T, options ...cacheStorage.StorageOption) cacheStorage.CacheStorage {
+		dir, err := ioutil.TempDir("", "cacheStorage")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			os.RemoveAll(dir)
+		})
+		cache := NewBoltCacheStorage(options...)
+		if err := cache.Connect(context.TODO(), filepath.Join(dir, "cache.db"), "", "", "test"); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			cache.Close(context.TODO())
+		})
+		return cache
+	})
+}
+
+func TestReopen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cacheStorage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "cache.db")
+
+	cache := NewBoltCacheStorage()
+	if err := cache.Connect(context.TODO(), path, "", "", "test"); err != nil {
+		t.Fatal(err)
+	}
+	_, cacheSetter := cache.GetCacheStorageClient()
+	if err := cacheSetter.Insert(context.TODO(), "catalog", "1", "1", "item"); err != nil {
+		t.Fatal(err)
+	}
+	if err := cache.Close(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+
+	cache = NewBoltCacheStorage()
+	if err := cache.Connect(context.TODO(), path, "", "", "test"); err != nil {
+		t.Fatal(err)
+	}
+	defer cache.Close(context.TODO())
+	cacheGetter, _ := cache.GetCacheStorageClient()
+	var item string
+	if err := cacheGetter.GetById(context.TODO(), "catalog", "1", "1", &item); err != nil {
+		t.Fatal(err)
+	}
+	if item != "item" {
+		t.Fatalf("expected the item inserted before reopening, got %q", item)
+	}
+}
+
+func TestIndexIds(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cacheStorage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "cache.db")
+
+	cache := NewBoltCacheStorage()
+	if err := cache.Connect(context.TODO(), path, "", "", "test"); err != nil {
+		t.Fatal(err)
+	}
+	_, cacheSetter := cache.GetCacheStorageClient()
+	for _, ver := range []string{"2", "1"} {
+		if err := cacheSetter.Insert(context.TODO(), "catalog", "1", ver, "item"+ver); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// drop the index, as in a file written before it was kept
+	err = cache.(*boltCacheStorage).db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte("test")).DeleteBucket(idsBucket)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cache.Close(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+
+	cache = NewBoltCacheStorage()
+	if err := cache.Connect(context.TODO(), path, "", "", "test"); err != nil {
+		t.Fatal(err)
+	}
+	defer cache.Close(context.TODO())
+	_, cacheSetter = cache.GetCacheStorageClient()
+	var item string
+	lock, lockErr := cacheSetter.GetAndLockById(context.TODO(), "catalog", "1", &item)
+	if lockErr != nil {
+		t.Fatal(lockErr)
+	}
+	if item != "item2" {
+		t.Fatalf("expected the item inserted first, got %q", item)
+	}
+	if err := cacheSetter.ReleaseLockedById(context.TODO(), lock); err != nil {
+		t.Fatal(err)
+	}
+	if err := cacheSetter.RemoveAll(context.TODO(), "catalog", "2"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cacheSetter.GetAndLockById(context.TODO(), "catalog", "1", &item); err != nil {
+		t.Fatal(err)
+	}
+	if item != "item1" {
+		t.Fatalf("expected the item left after removing the first, got %q", item)
+	}
+}
+
+func TestMixedCodecs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cacheStorage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "cache.db")
+
+	cache := NewBoltCacheStorage()
+	if err := cache.Connect(context.TODO(), path, "", "", "test"); err != nil {
+		t.Fatal(err)
+	}
+	_, cacheSetter := cache.GetCacheStorageClient()
+	if err := cacheSetter.Insert(context.TODO(), "catalog", "1", "1", map[string]string{"name": "json"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := cache.Close(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+
+	cache = NewBoltCacheStorage(cacheStorage.WithCollectionCodec("catalog", cacheStorage.MsgpackCodec))
+	if err := cache.Connect(context.TODO(), path, "", "", "test"); err != nil {
+		t.Fatal(err)
+	}
+	defer cache.Close(context.TODO())
+	cacheGetter, cacheSetter := cache.GetCacheStorageClient()
+	if err := cacheSetter.Insert(context.TODO(), "catalog", "2", "1", map[string]string{"name": "msgpack"}); err != nil {
+		t.Fatal(err)
+	}
+	items := make(map[string]map[string]string)
+	if err := cacheGetter.GetAll(context.TODO(), "catalog", "1", items); err != nil {
+		t.Fatal(err)
+	}
+	if items["1"]["name"] != "json" || items["2"]["name"] != "msgpack" {
+		t.Fatalf("expected the items of both codecs, got %v", items)
+	}
+}
+
+func TestEncryptedItems(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cacheStorage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "cache.db")
+	connect := func(keys cacheStorage.KeyProvider) cacheStorage.CacheStorage {
+		cache := NewBoltCacheStorage(cacheStorage.WithEncryption(keys, "customers"))
+		if err := cache.Connect(context.TODO(), path, "", "", "test"); err != nil {
+			t.Fatal(err)
+		}
+		return cache
+	}
+
+	keys := cacheStorage.NewKeyRing()
+	if err := keys.Add("k1", bytes.Repeat([]byte{1}, 32)); err != nil {
+		t.Fatal(err)
+	}
+	cache := connect(keys)
+	_, cacheSetter := cache.GetCacheStorageClient()
+	if err := cacheSetter.Insert(context.TODO(), "customers", "1", "1", map[string]string{"email": "first@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := keys.Add("k2", bytes.Repeat([]byte{2}, 32)); err != nil {
+		t.Fatal(err)
+	}
+	if err := cacheSetter.Insert(context.TODO(), "customers", "2", "1", map[string]string{"email": "second@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := cache.Close(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+	stored, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(stored, []byte("@example.com")) {
+		t.Fatal("expected the stored items to be encrypted")
+	}
+
+	cache = connect(keys)
+	cacheGetter, _ := cache.GetCacheStorageClient()
+	items := make(map[string]map[string]string)
+	if err := cacheGetter.GetAll(context.TODO(), "customers", "1", items); err != nil {
+		t.Fatal(err)
+	}
+	if items["1"]["email"] != "first@example.com" || items["2"]["email"] != "second@example.com" {
+		t.Fatalf("expected the items of both keys, got %v", items)
+	}
+	if err := cache.Close(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+
+	rotated := cacheStorage.NewKeyRing()
+	if err := rotated.Add("k2", bytes.Repeat([]byte{2}, 32)); err != nil {
+		t.Fatal(err)
+	}
+	cache = connect(rotated)
+	defer cache.Close(context.TODO())
+	cacheGetter, _ = cache.GetCacheStorageClient()
+	var item map[string]string
+	if err := cacheGetter.GetById(context.TODO(), "customers", "1", "1", &item); err == nil || !err.IsUnknownKey() {
+		t.Fatalf("expected an unknown key error, got %v", err)
+	}
+	if err := cacheGetter.GetById(context.TODO(), "customers", "2", "1", &item); err != nil {
+		t.Fatal(err)
+	}
+}
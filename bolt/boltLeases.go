@@ -0,0 +1,104 @@
+package bolt
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	. "github.com/orchestd/cacheStorage"
+	bbolt "go.etcd.io/bbolt"
+	"time"
+)
+
+// leasesBucket keeps the slots of every named lock by name, next to the collections of the database. Its name starts
+// with a NUL byte so it can't be taken for a collection.
+var leasesBucket = []byte("\x00leases")
+
+// leaseSlot is one of the slots of a named lock, held by Owner until ExpiresAt.
+type leaseSlot struct {
+	Owner     string    `json:"owner,omitempty"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	Fence     int64     `json:"fence"`
+}
+
+type boltLeases struct {
+	storage *boltCacheStorage
+}
+
+// update runs f on the first n slots of name and writes them back, unless f fails.
+func (m boltLeases) update(name string, n int, f func(slots []leaseSlot) error) error {
+	return m.storage.db.Update(func(tx *bbolt.Tx) error {
+		bucket, err := tx.Bucket(m.storage.database).CreateBucketIfNotExists(leasesBucket)
+		if err != nil {
+			return err
+		}
+		var slots []leaseSlot
+		if v := bucket.Get([]byte(name)); v != nil {
+			if err := json.Unmarshal(v, &slots); err != nil {
+				return err
+			}
+		}
+		for len(slots) < n {
+			slots = append(slots, leaseSlot{})
+		}
+		if err := f(slots[:n]); err != nil {
+			return err
+		}
+		v, err := json.Marshal(slots)
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(name), v)
+	})
+}
+
+func (m boltLeases) AcquireLease(c context.Context, name string, slots int, owner string) (int64, CacheStorageError) {
+	var fence int64
+	err := m.update(name, slots, func(slots []leaseSlot) error {
+		now := time.Now()
+		for i := range slots {
+			if slots[i].Owner == "" || now.After(slots[i].ExpiresAt) {
+				slots[i].Owner, slots[i].ExpiresAt = owner, now.Add(m.storage.options.Lock.Lease)
+				slots[i].Fence++
+				fence = slots[i].Fence
+				return nil
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, NewCacheStorageError(err)
+	}
+	return fence, nil
+}
+
+func (m boltLeases) ReleaseLease(c context.Context, name string, slots int, owner string) CacheStorageError {
+	err := m.update(name, slots, func(slots []leaseSlot) error {
+		for i := range slots {
+			if slots[i].Owner == owner {
+				slots[i].Owner = ""
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return NewCacheStorageError(err)
+	}
+	return nil
+}
+
+func (m boltLeases) RenewLease(c context.Context, name string, slots int, owner string) CacheStorageError {
+	err := m.update(name, slots, func(slots []leaseSlot) error {
+		now := time.Now()
+		for i := range slots {
+			if slots[i].Owner == owner && !now.After(slots[i].ExpiresAt) {
+				slots[i].ExpiresAt = now.Add(m.storage.options.Lock.Lease)
+				return nil
+			}
+		}
+		return fmt.Errorf("%w: %v", ErrLockNotHeld, name)
+	})
+	if err != nil {
+		return NewCacheStorageError(err)
+	}
+	return nil
+}
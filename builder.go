@@ -0,0 +1,168 @@
+package cacheStorage
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// stagedVerSeparator joins a version and a random token into the ver its items are staged under.
+const stagedVerSeparator = "~staged~"
+
+/*
+VersionBuilder writes the items of a new version of a collection under a hidden ver, registered in the collection's
+CacheVersion so GC leaves it alone, and only moves them to the version's own ver when it is committed. Readers guessing
+the version's ver see nothing until then. Insert and InsertMany may be called from several goroutines.
+*/
+type VersionBuilder struct {
+	setter     CacheStorageSetter
+	collection string
+	version    string
+	ver        string
+	inserted   int64
+}
+
+func newStagedVer(version string) (string, error) {
+	token := make([]byte, 8)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+	return version + stagedVerSeparator + hex.EncodeToString(token), nil
+}
+
+// MoveVersion calls the MoveVersion of setter, failing with ErrNotSupported when setter is not a VersionMover.
+func MoveVersion(c context.Context, setter CacheStorageSetter, collectionName string, fromVer string, toVer string) (int, CacheStorageError) {
+	mover, ok := setter.(VersionMover)
+	if !ok {
+		return 0, notMovable(setter, collectionName)
+	}
+	return mover.MoveVersion(c, collectionName, fromVer, toVer)
+}
+
+func notMovable(setter CacheStorageSetter, collection string) CacheStorageError {
+	return NewCacheStorageError(fmt.Errorf("%w: %T can't move the versions of collection %v", ErrNotSupported, setter, collection))
+}
+
+// OpenVersion starts building version of collection, which must not be published or being built already. setter must
+// be a VersionMover for the version to be committed.
+func OpenVersion(c context.Context, setter CacheStorageSetter, collection string, version string) (*VersionBuilder, CacheStorageError) {
+	if version == "" {
+		return nil, NewCacheStorageError(fmt.Errorf("%w: version of collection %v must not be empty", ErrInvalidCacheVersion, collection))
+	}
+	if _, ok := setter.(VersionMover); !ok {
+		return nil, notMovable(setter, collection)
+	}
+	ver, err := newStagedVer(version)
+	if err != nil {
+		return nil, NewCacheStorageError(err)
+	}
+	storageErr := UpdateCacheVersion(c, setter, collection, func(cacheVersion *CacheVersion) error {
+		if _, ok := findVersion(cacheVersion, version); ok {
+			return fmt.Errorf("%w: version %v of collection %v", ErrVersionAlreadyPublished, version, collection)
+		}
+		for _, staged := range cacheVersion.Staged {
+			if staged.Version == version {
+				return fmt.Errorf("%w: version %v of collection %v is being built since %v", ErrVersionAlreadyPublished, version, collection, staged.StartedAt)
+			}
+		}
+		cacheVersion.Staged = append(cacheVersion.Staged, StagedVersion{Version: version, Ver: ver, StartedAt: time.Now()})
+		return nil
+	})
+	if storageErr != nil {
+		return nil, storageErr
+	}
+	return &VersionBuilder{setter: setter, collection: collection, version: version, ver: ver}, nil
+}
+
+func (b *VersionBuilder) Insert(c context.Context, id string, item interface{}) CacheStorageError {
+	if err := b.setter.Insert(c, b.collection, id, b.ver, item); err != nil {
+		return err
+	}
+	atomic.AddInt64(&b.inserted, 1)
+	return nil
+}
+
+func (b *VersionBuilder) InsertMany(c context.Context, items map[string]interface{}) CacheStorageError {
+	if err := b.setter.InsertMany(c, b.collection, b.ver, items); err != nil {
+		return err
+	}
+	atomic.AddInt64(&b.inserted, int64(len(items)))
+	return nil
+}
+
+// Inserted returns how many items were inserted so far.
+func (b *VersionBuilder) Inserted() int {
+	return int(atomic.LoadInt64(&b.inserted))
+}
+
+func (b *VersionBuilder) unstage(cacheVersion *CacheVersion) bool {
+	for i, staged := range cacheVersion.Staged {
+		if staged.Ver == b.ver {
+			cacheVersion.Staged = append(cacheVersion.Staged[:i], cacheVersion.Staged[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+/*
+Commit moves the built items to the version's ver and publishes the version to become active at activateAt. It fails,
+leaving the version staged so it can still be aborted, unless exactly the inserted items were moved and, when
+expectedItems is positive, they are as many as expected.
+
+The items are moved before the version is published, so readers that resolve vers through the cache versions never see
+a version whose items are not all in place. Readers asking for the version's ver directly may see some of its items
+between the move and the publish, and, on backends whose MoveVersion is not atomic such as mongodb, during the move.
+When publishing fails the items are moved back to the staged ver, and the error of doing so is returned along with
+the error of publishing.
+*/
+func (b *VersionBuilder) Commit(c context.Context, activateAt time.Time, expectedItems int) CacheStorageError {
+	inserted := b.Inserted()
+	if expectedItems > 0 && inserted != expectedItems {
+		return NewCacheStorageError(fmt.Errorf("%w: version %v of collection %v has %v items instead of %v", ErrInvalidCacheVersion, b.version, b.collection, inserted, expectedItems))
+	}
+	moved, err := MoveVersion(c, b.setter, b.collection, b.ver, b.version)
+	if err != nil {
+		return err
+	}
+	if moved != inserted {
+		err := fmt.Errorf("%w: %v items of version %v of collection %v were inserted but %v were stored", ErrInvalidCacheVersion, inserted, b.version, b.collection, moved)
+		return NewCacheStorageError(joinErrors(err, b.moveBack(c)))
+	}
+	err = UpdateCacheVersion(c, b.setter, b.collection, func(cacheVersion *CacheVersion) error {
+		if !b.unstage(cacheVersion) {
+			return fmt.Errorf("%w: version %v of collection %v is not being built anymore", ErrInvalidCacheVersion, b.version, b.collection)
+		}
+		if _, ok := findVersion(cacheVersion, b.version); ok {
+			return fmt.Errorf("%w: version %v of collection %v", ErrVersionAlreadyPublished, b.version, b.collection)
+		}
+		cacheVersion.Versions = append(cacheVersion.Versions, Version{Version: b.version, TimedTo: activateAt})
+		return nil
+	})
+	if err != nil {
+		return NewCacheStorageError(joinErrors(err, b.moveBack(c)))
+	}
+	return nil
+}
+
+// moveBack puts the items moved by Commit back under the staged ver, so the version can still be aborted.
+func (b *VersionBuilder) moveBack(c context.Context) error {
+	if _, err := MoveVersion(c, b.setter, b.collection, b.version, b.ver); err != nil {
+		return fmt.Errorf("moving the items of version %v of collection %v back to %v: %w", b.version, b.collection, b.ver, err)
+	}
+	return nil
+}
+
+// Abort removes the items built so far and forgets the version.
+func (b *VersionBuilder) Abort(c context.Context) CacheStorageError {
+	if err := b.setter.RemoveAll(c, b.collection, b.ver); err != nil {
+		return err
+	}
+	return UpdateCacheVersion(c, b.setter, b.collection, func(cacheVersion *CacheVersion) error {
+		b.unstage(cacheVersion)
+		return nil
+	})
+}
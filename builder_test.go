@@ -0,0 +1,99 @@
+package cacheStorage_test
+
+import (
+	"context"
+	"errors"
+	"github.com/orchestd/cacheStorage"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+type TestCatalogItem struct {
+	Id   string
+	Name string
+}
+
+// failingCommitSetter fails publishing once publish is set, and every MoveVersion after the first.
+type failingCommitSetter struct {
+	cacheStorage.CacheStorageSetter
+	publish bool
+	moves   int
+}
+
+func (s *failingCommitSetter) UpdateCacheVersion(c context.Context, collection string, update func(cacheVersion *cacheStorage.CacheVersion) error) cacheStorage.CacheStorageError {
+	if s.publish {
+		return cacheStorage.NewCacheStorageError(cacheStorage.ErrConflict)
+	}
+	return cacheStorage.UpdateCacheVersion(c, s.CacheStorageSetter, collection, update)
+}
+
+func (s *failingCommitSetter) MoveVersion(c context.Context, collectionName string, fromVer string, toVer string) (int, cacheStorage.CacheStorageError) {
+	if s.moves++; s.moves > 1 {
+		return 0, cacheStorage.NewCacheStorageError(cacheStorage.ErrConnection)
+	}
+	return cacheStorage.MoveVersion(c, s.CacheStorageSetter, collectionName, fromVer, toVer)
+}
+
+func TestVersionBuilder(t *testing.T) {
+	getter, setter := newTestSetter(t)
+	now := time.Now()
+	Convey("Building a version hides its items until it is committed", t, func() {
+		builder, err := cacheStorage.OpenVersion(context.TODO(), setter, "catalog", "1")
+		So(err, ShouldBeNil)
+		So(builder.Insert(context.TODO(), "1", TestCatalogItem{Id: "1", Name: "Item1"}), ShouldBeNil)
+		So(builder.InsertMany(context.TODO(), map[string]interface{}{
+			"2": TestCatalogItem{Id: "2", Name: "Item2"},
+			"3": TestCatalogItem{Id: "3", Name: "Item3"},
+		}), ShouldBeNil)
+		var item TestCatalogItem
+		So(getter.GetById(context.TODO(), "catalog", "1", "1", &item), ShouldNotBeNil)
+		_, err = cacheStorage.OpenVersion(context.TODO(), setter, "catalog", "1")
+		So(err, ShouldNotBeNil)
+
+		So(builder.Commit(context.TODO(), now, 3), ShouldBeNil)
+		So(cacheStorage.GetByIdActive(context.TODO(), getter, "catalog", "1", &item), ShouldBeNil)
+		So(item.Name, ShouldEqual, "Item1")
+		cacheVersion, err := getter.GetLatestCollectionVersion(context.TODO(), "catalog")
+		So(err, ShouldBeNil)
+		So(cacheVersion.Staged, ShouldBeEmpty)
+	})
+	Convey("Committing a version with fewer items than expected", t, func() {
+		builder, err := cacheStorage.OpenVersion(context.TODO(), setter, "catalog", "2")
+		So(err, ShouldBeNil)
+		So(builder.Insert(context.TODO(), "1", TestCatalogItem{Id: "1", Name: "Item1!"}), ShouldBeNil)
+		So(builder.Commit(context.TODO(), now, 3), ShouldNotBeNil)
+		var item TestCatalogItem
+		So(getter.GetById(context.TODO(), "catalog", "1", "2", &item), ShouldNotBeNil)
+
+		So(builder.Abort(context.TODO()), ShouldBeNil)
+		vers, err := cacheStorage.GetStoredVersions(context.TODO(), getter, "catalog")
+		So(err, ShouldBeNil)
+		So(vers, ShouldResemble, []string{"1"})
+		cacheVersion, _ := getter.GetLatestCollectionVersion(context.TODO(), "catalog")
+		So(cacheVersion.Staged, ShouldBeEmpty)
+		So(len(cacheVersion.Versions), ShouldEqual, 1)
+	})
+	Convey("Building a version already published", t, func() {
+		_, err := cacheStorage.OpenVersion(context.TODO(), setter, "catalog", "1")
+		So(err, ShouldNotBeNil)
+	})
+	Convey("Committing a version whose items cannot be moved back after publishing failed", t, func() {
+		failing := &failingCommitSetter{CacheStorageSetter: setter}
+		builder, err := cacheStorage.OpenVersion(context.TODO(), failing, "catalog", "3")
+		So(err, ShouldBeNil)
+		So(builder.Insert(context.TODO(), "1", TestCatalogItem{Id: "1", Name: "Item1"}), ShouldBeNil)
+		failing.publish = true
+		err = builder.Commit(context.TODO(), now, 1)
+		So(err, ShouldNotBeNil)
+		So(err.IsConflict(), ShouldBeTrue)
+		So(err.IsConnection(), ShouldBeTrue)
+		So(errors.Is(err, cacheStorage.ErrConnection), ShouldBeTrue)
+		So(failing.moves, ShouldEqual, 2)
+	})
+	Convey("Building a version through a setter that can't move versions", t, func() {
+		_, err := cacheStorage.OpenVersion(context.TODO(), basicSetter{setter}, "catalog", "4")
+		So(err, ShouldNotBeNil)
+		So(errors.Is(err, cacheStorage.ErrNotSupported), ShouldBeTrue)
+	})
+}
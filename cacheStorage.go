@@ -5,10 +5,30 @@ import (
 	"time"
 )
 
+/*
+CacheStorageError classifies the errors of every backend, so callers need not know the errors of the database behind
+it. Unwrap returns the error it classifies, for errors.Is and errors.As to match the sentinels below and the errors of
+the database.
+*/
 type CacheStorageError interface {
 	IsNotFound() bool
 	IsInvalidDestType() bool
+	IsUnknownKey() bool
+	IsSerialization() bool
+	IsDuplicateKey() bool
+	// IsTimeout is true for operations that ran out of time, their context's deadline included.
+	IsTimeout() bool
+	IsCanceled() bool
+	// IsConnection is true for operations that could not reach the database.
+	IsConnection() bool
+	// IsLockTimeout is true for GetAndLockById giving up waiting for an item locked by another owner.
+	IsLockTimeout() bool
+	// IsConflict is true for writes the current state of the storage does not allow.
+	IsConflict() bool
+	// IsRetryable is true for failures that retrying the operation as it is may overcome.
+	IsRetryable() bool
 	Error() string
+	Unwrap() error
 }
 
 type Version struct {
@@ -16,11 +36,37 @@ type Version struct {
 	TimedTo time.Time
 }
 
+// VersionPin overrides the schedule of a collection, keeping Version active until it is unpinned.
+type VersionPin struct {
+	Version  string
+	Author   string
+	Reason   string
+	PinnedAt time.Time
+}
+
+// RolledBackVersion is a version that was taken out of the schedule by a rollback.
+type RolledBackVersion struct {
+	Version
+	Author       string
+	Reason       string
+	RolledBackAt time.Time
+}
+
+// StagedVersion is a version being built under a hidden ver until it is committed.
+type StagedVersion struct {
+	Version   string
+	Ver       string
+	StartedAt time.Time
+}
+
 type CacheVersion struct {
 	CollectionName  string
 	Versions        []Version
 	LockVersionUpon []string
 	CacheType       string
+	Pin             *VersionPin         `json:",omitempty"`
+	RolledBack      []RolledBackVersion `json:",omitempty"`
+	Staged          []StagedVersion     `json:",omitempty"`
 }
 
 type CacheStorageGetterMiddleware func(cacheStorageGetter CacheStorageGetter) CacheStorageGetter
@@ -35,6 +81,14 @@ type CacheStorageGetter interface {
 	/*TODO: move to persistent storage*/
 	GetArrayBySingleId(c context.Context, collectionName string, id string, ver string, dest interface{}) CacheStorageError
 }
+
+// StoredVersionsLister is implemented by the getters of backends that can list the vers their items are stored under.
+// Callers use the GetStoredVersions function rather than asserting it themselves.
+type StoredVersionsLister interface {
+	// GetStoredVersions returns the distinct vers holding at least one item of collectionName, whether published or not.
+	GetStoredVersions(c context.Context, collectionName string) ([]string, CacheStorageError)
+}
+
 type CacheStorageGetterWrapper interface {
 	CacheStorageGetter
 }
@@ -45,10 +99,39 @@ type CacheStorageSetter interface {
 	Update(c context.Context, collectionName string, id string, ver string, item interface{}) CacheStorageError
 	Remove(c context.Context, collectionName string, id string, ver string) CacheStorageError
 	RemoveAll(c context.Context, collectionName string, ver string) CacheStorageError
-
 	/*TODO: move to persistent storage*/
-	GetAndLockById(c context.Context, collectionName string, id string, dest interface{}) CacheStorageError
-	ReleaseLockedById(c context.Context, collectionName string, id string) CacheStorageError
+	GetAndLockById(c context.Context, collectionName string, id string, dest interface{}) (LockHandle, CacheStorageError)
+	ReleaseLockedById(c context.Context, lock LockHandle) CacheStorageError
+	// UpdateAndRelease replaces the item lock was taken on, in the version GetAndLockById read it from, with item and
+	// releases lock at once. It fails with ErrLockNotHeld and writes nothing once lock was released or its lease ran
+	// out, as another owner may have taken the item over since.
+	UpdateAndRelease(c context.Context, lock LockHandle, item interface{}) CacheStorageError
+	// RenewLock extends the lease of lock by a whole lease from now. It fails with ErrLockNotHeld once the lock was
+	// released or its lease ran out, as another owner may have taken the item over since.
+	RenewLock(c context.Context, lock LockHandle) CacheStorageError
+}
+
+/*
+CacheVersionUpdater is implemented by the setters of backends that write the cacheVersions entries, which publishing,
+pinning, rolling back and building versions go through. Callers use the UpdateCacheVersion function rather than
+asserting it themselves.
+*/
+type CacheVersionUpdater interface {
+	/*
+		UpdateCacheVersion atomically reads the cacheVersions entry of collection, passes it to update and writes it back.
+		A collection without an entry yet gets an empty CacheVersion named after it. Nothing is written when update
+		returns an error. update may be called more than once when a concurrent writer gets in between, so it must only
+		modify the CacheVersion it is given.
+	*/
+	UpdateCacheVersion(c context.Context, collection string, update func(cacheVersion *CacheVersion) error) CacheStorageError
+}
+
+// VersionMover is implemented by the setters of backends that can move items from one ver to another, which
+// VersionBuilder needs to commit. Callers use the MoveVersion function rather than asserting it themselves.
+type VersionMover interface {
+	// MoveVersion moves every item of collectionName from fromVer to toVer, which must not hold any item yet, and returns
+	// how many items it moved.
+	MoveVersion(c context.Context, collectionName string, fromVer string, toVer string) (int, CacheStorageError)
 }
 
 type CacheStorageSetterMiddleware func(setter CacheStorageSetter) CacheStorageSetter
@@ -61,6 +144,8 @@ type CacheStorage interface {
 	Connect(c context.Context, host, userName, userPw, database string) error
 	Close(context.Context) error
 	GetCacheStorageClient() (CacheStorageGetter, CacheStorageSetter)
+	// GetLocker returns the Locker keeping its named locks and semaphores in the storage.
+	GetLocker() *Locker
 }
 
 /*func DefaultCacheStorageClient(lc fx.Lifecycle, credentials credentials.CredentialsGetter,cacheStorage cacheStorage.CacheStorage) (cache.CacheStorageGetter, cache.CacheStorageSetter) {
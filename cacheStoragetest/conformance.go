@@ -0,0 +1,929 @@
+// Package cacheStoragetest holds a backend agnostic test kit. Every cacheStorage.CacheStorage implementation should
+// pass RunConformance, which checks it behaves exactly like the mongodb backend does.
+package cacheStoragetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/orchestd/cacheStorage"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+// Factory returns a connected and empty CacheStorage configured with options. It is called once for every scenario, so
+// storages must not share data between calls.
+type Factory func(t *testing.T, options ...cacheStorage.StorageOption) cacheStorage.CacheStorage
+
+const CacheVersionsCollectionName = "cacheVersions"
+
+const testCollectionName = "catalog"
+const testVersion = "1"
+
+type TestCatalogItem struct {
+	Id    string
+	Name  string
+	Price float32
+}
+
+var testCatalogItem1 = TestCatalogItem{Id: "1", Name: "Item1", Price: 10.20}
+var testCatalogItem2 = TestCatalogItem{Id: "2", Name: "Item2", Price: 20.30}
+var testCatalogItem3 = TestCatalogItem{Id: "3", Name: "Item3", Price: 30.40}
+var testCatalogItem4 = TestCatalogItem{Id: "4", Name: "Item4", Price: 40.50}
+var testCatalogItem5 = TestCatalogItem{Id: "5", Name: "Item5", Price: 40.50}
+var testCatalogItem6 = TestCatalogItem{Id: "5", Name: "Item5!", Price: 40.50}
+
+var versionsTimedTo = time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// configurations cover every built in codec, every built in compressor compressing every item, and encrypting every item.
+var configurations = []struct {
+	name   string
+	option cacheStorage.StorageOption
+}{
+	{"json", cacheStorage.WithCodec(cacheStorage.JSONCodec)},
+	{"gob", cacheStorage.WithCodec(cacheStorage.GobCodec)},
+	{"msgpack", cacheStorage.WithCodec(cacheStorage.MsgpackCodec)},
+	{"bson", cacheStorage.WithCodec(cacheStorage.BSONCodec)},
+	{"gzip", cacheStorage.WithCompression(cacheStorage.GzipCompressor, 0)},
+	{"zstd", cacheStorage.WithCompression(cacheStorage.ZstdCompressor, 0)},
+	{"snappy", cacheStorage.WithCompression(cacheStorage.SnappyCompressor, 0)},
+	{"aes-gcm", cacheStorage.WithEncryption(testKeys())},
+}
+
+func testKeys() cacheStorage.KeyProvider {
+	keys := cacheStorage.NewKeyRing()
+	if err := keys.Add("conformance", make([]byte, 32)); err != nil {
+		panic(err)
+	}
+	return keys
+}
+
+// RunConformance runs every scenario against fresh storages returned by factory, once in each configuration.
+func RunConformance(t *testing.T, factory Factory) {
+	scenarios := []struct {
+		name string
+		run  func(t *testing.T, getter cacheStorage.CacheStorageGetter, setter cacheStorage.CacheStorageSetter)
+	}{
+		{"GetLatestVersions", testGetLatestVersions},
+		{"GetLatestCollectionVersion", testGetLatestCollectionVersion},
+		{"GetById", testGetById},
+		{"GetManyByIds", testGetManyByIds},
+		{"GetAll", testGetAll},
+		{"GetArrayBySingleId", testGetArrayBySingleId},
+		{"GetStoredVersions", testGetStoredVersions},
+		{"Insert", testInsert},
+		{"InsertMany", testInsertMany},
+		{"Serialization", testSerialization},
+		{"Update", testUpdate},
+		{"InsertOrUpdate", testInsertOrUpdate},
+		{"Remove", testRemove},
+		{"RemoveAll", testRemoveAll},
+		{"GetAndLockById", testGetAndLockById},
+		{"UpdateCacheVersion", testUpdateCacheVersion},
+		{"MoveVersion", testMoveVersion},
+	}
+	for _, configuration := range configurations {
+		configuration := configuration
+		t.Run(configuration.name, func(t *testing.T) {
+			for _, scenario := range scenarios {
+				scenario := scenario
+				t.Run(scenario.name, func(t *testing.T) {
+					cache := factory(t, configuration.option)
+					getter, setter := cache.GetCacheStorageClient()
+					seed(t, setter)
+					scenario.run(t, getter, setter)
+				})
+			}
+		})
+	}
+	t.Run("LockOptions", func(t *testing.T) {
+		cache := factory(t,
+			cacheStorage.WithLockLease(300*time.Millisecond),
+			cacheStorage.WithLockWait(200*time.Millisecond),
+			cacheStorage.WithLockBackoff(10*time.Millisecond, 40*time.Millisecond, 0.5),
+			cacheStorage.WithGuardedUpdates(),
+		)
+		getter, setter := cache.GetCacheStorageClient()
+		seed(t, setter)
+		testLockOptions(t, getter, setter)
+	})
+	t.Run("Locker", func(t *testing.T) {
+		cache := factory(t,
+			cacheStorage.WithLockLease(300*time.Millisecond),
+			cacheStorage.WithLockWait(200*time.Millisecond),
+			cacheStorage.WithLockBackoff(10*time.Millisecond, 40*time.Millisecond, 0.5),
+		)
+		_, setter := cache.GetCacheStorageClient()
+		seed(t, setter)
+		testLocker(t, cache)
+	})
+}
+
+func seed(t *testing.T, setter cacheStorage.CacheStorageSetter) {
+	c := context.Background()
+	catalog := map[string]interface{}{
+		"1": testCatalogItem1,
+		"2": testCatalogItem2,
+		"3": testCatalogItem3,
+		"4": testCatalogItem4,
+	}
+	if err := setter.InsertMany(c, testCollectionName, testVersion, catalog); err != nil {
+		t.Fatalf("could not seed %v: %v", testCollectionName, err)
+	}
+	if err := setter.Insert(c, testCollectionName, "5", "3", testCatalogItem5); err != nil {
+		t.Fatalf("could not seed %v: %v", testCollectionName, err)
+	}
+	if err := setter.Insert(c, testCollectionName, "5", "4", testCatalogItem6); err != nil {
+		t.Fatalf("could not seed %v: %v", testCollectionName, err)
+	}
+	versions := map[string]interface{}{
+		"stores":            cacheVersion("stores", "2"),
+		"storeOpeningHours": cacheVersion("storeOpeningHours", "4"),
+		"occasions":         cacheVersion("occasions", "7"),
+		testCollectionName:  cacheVersion(testCollectionName, "4"),
+	}
+	if err := setter.InsertMany(c, CacheVersionsCollectionName, "1", versions); err != nil {
+		t.Fatalf("could not seed %v: %v", CacheVersionsCollectionName, err)
+	}
+}
+
+func cacheVersion(collection, version string) cacheStorage.CacheVersion {
+	return cacheStorage.CacheVersion{
+		CollectionName: collection,
+		Versions:       []cacheStorage.Version{{Version: version, TimedTo: versionsTimedTo}},
+	}
+}
+
+func testGetLatestVersions(t *testing.T, getter cacheStorage.CacheStorageGetter, _ cacheStorage.CacheStorageSetter) {
+	Convey("Getting cache versions", t, func() {
+		versions, err := getter.GetLatestVersions(context.TODO())
+		So(err, ShouldBeNil)
+		So(len(versions), ShouldEqual, 4)
+	})
+}
+
+func testGetLatestCollectionVersion(t *testing.T, getter cacheStorage.CacheStorageGetter, _ cacheStorage.CacheStorageSetter) {
+	Convey("Getting stores latest cache versions", t, func() {
+		version, err := getter.GetLatestCollectionVersion(context.TODO(), "stores")
+		So(err, ShouldBeNil)
+		So(version.CollectionName, ShouldEqual, "stores")
+		So(version.Versions[0].Version, ShouldEqual, "2")
+		So(version.Versions[0].TimedTo.Equal(versionsTimedTo), ShouldBeTrue)
+	})
+	Convey("Getting latest cache versions of an unknown collection", t, func() {
+		_, err := getter.GetLatestCollectionVersion(context.TODO(), "unknown")
+		So(err, ShouldNotBeNil)
+		So(err.IsNotFound(), ShouldBeTrue)
+	})
+}
+
+func testGetById(t *testing.T, getter cacheStorage.CacheStorageGetter, _ cacheStorage.CacheStorageSetter) {
+	var testCatalogItem TestCatalogItem
+	Convey("Getting test item by ID = 1 and non pointer dest", t, func() {
+		err := getter.GetById(context.TODO(), testCollectionName, "1", testVersion, testCatalogItem)
+		So(err, ShouldNotBeNil)
+		So(err.IsInvalidDestType(), ShouldBeTrue)
+	})
+	Convey("Getting existing test item by ID = 1", t, func() {
+		err := getter.GetById(context.TODO(), testCollectionName, "1", testVersion, &testCatalogItem)
+		So(err, ShouldBeNil)
+		So(testCatalogItem, ShouldResemble, testCatalogItem1)
+	})
+	Convey("Getting non existent test item by ID = 9", t, func() {
+		err := getter.GetById(context.TODO(), testCollectionName, "9", testVersion, &testCatalogItem)
+		So(err, ShouldNotBeNil)
+		So(err.IsNotFound(), ShouldBeTrue)
+	})
+	Convey("Getting each version of an item by ID = 5", t, func() {
+		err := getter.GetById(context.TODO(), testCollectionName, "5", "3", &testCatalogItem)
+		So(err, ShouldBeNil)
+		So(testCatalogItem, ShouldResemble, testCatalogItem5)
+		err = getter.GetById(context.TODO(), testCollectionName, "5", "4", &testCatalogItem)
+		So(err, ShouldBeNil)
+		So(testCatalogItem, ShouldResemble, testCatalogItem6)
+	})
+	Convey("Getting test item by ID = 1 in a version it does not exist in", t, func() {
+		err := getter.GetById(context.TODO(), testCollectionName, "1", "3", &testCatalogItem)
+		So(err, ShouldNotBeNil)
+		So(err.IsNotFound(), ShouldBeTrue)
+	})
+}
+
+func testGetManyByIds(t *testing.T, getter cacheStorage.CacheStorageGetter, _ cacheStorage.CacheStorageSetter) {
+	var testCatalogItem TestCatalogItem
+	Convey("Getting test item by ID = 1 and non map dest", t, func() {
+		err := getter.GetManyByIds(context.TODO(), testCollectionName, []string{"1"}, testVersion, &testCatalogItem)
+		So(err, ShouldNotBeNil)
+		So(err.IsInvalidDestType(), ShouldBeTrue)
+	})
+	Convey("Getting 3 existing test items by ID = 1, 2, 3", t, func() {
+		testCatalogItems := make(map[string]TestCatalogItem)
+		err := getter.GetManyByIds(context.TODO(), testCollectionName, []string{"1", "2", "3"}, testVersion, testCatalogItems)
+		So(err, ShouldBeNil)
+		So(len(testCatalogItems), ShouldEqual, 3)
+		So(testCatalogItems["1"], ShouldResemble, testCatalogItem1)
+		So(testCatalogItems["3"], ShouldResemble, testCatalogItem3)
+	})
+	Convey("Getting 2 existing test items by ID = 1, 2 and one non existent item by ID = 9", t, func() {
+		testCatalogItems := make(map[string]TestCatalogItem)
+		err := getter.GetManyByIds(context.TODO(), testCollectionName, []string{"1", "2", "9"}, testVersion, testCatalogItems)
+		So(err, ShouldNotBeNil)
+		So(err.IsNotFound(), ShouldBeTrue)
+		So(len(testCatalogItems), ShouldEqual, 2)
+	})
+	Convey("Getting list of existing items with duplicates", t, func() {
+		testCatalogItems := make(map[string]TestCatalogItem)
+		err := getter.GetManyByIds(context.TODO(), testCollectionName, []string{"1", "1", "2"}, testVersion, testCatalogItems)
+		So(err, ShouldBeNil)
+		So(len(testCatalogItems), ShouldEqual, 2)
+	})
+	Convey("Getting an empty list of ids", t, func() {
+		testCatalogItems := make(map[string]TestCatalogItem)
+		err := getter.GetManyByIds(context.TODO(), testCollectionName, nil, testVersion, testCatalogItems)
+		So(err, ShouldBeNil)
+		So(len(testCatalogItems), ShouldEqual, 0)
+	})
+}
+
+func testGetAll(t *testing.T, getter cacheStorage.CacheStorageGetter, _ cacheStorage.CacheStorageSetter) {
+	Convey("Getting all items from the test collection", t, func() {
+		testCatalogItems := make(map[string]TestCatalogItem)
+		err := getter.GetAll(context.TODO(), testCollectionName, testVersion, testCatalogItems)
+		So(err, ShouldBeNil)
+		So(len(testCatalogItems), ShouldEqual, 4)
+		So(testCatalogItems["1"], ShouldResemble, testCatalogItem1)
+		So(testCatalogItems["4"], ShouldResemble, testCatalogItem4)
+	})
+	Convey("Getting all items of a version holding a single item", t, func() {
+		testCatalogItems := make(map[string]TestCatalogItem)
+		err := getter.GetAll(context.TODO(), testCollectionName, "4", testCatalogItems)
+		So(err, ShouldBeNil)
+		So(len(testCatalogItems), ShouldEqual, 1)
+		So(testCatalogItems["5"], ShouldResemble, testCatalogItem6)
+	})
+	Convey("Getting all items of an unknown version", t, func() {
+		testCatalogItems := make(map[string]TestCatalogItem)
+		err := getter.GetAll(context.TODO(), testCollectionName, "99", testCatalogItems)
+		So(err, ShouldBeNil)
+		So(len(testCatalogItems), ShouldEqual, 0)
+	})
+	Convey("Getting all items into a non map dest", t, func() {
+		var testCatalogItems []TestCatalogItem
+		err := getter.GetAll(context.TODO(), testCollectionName, testVersion, &testCatalogItems)
+		So(err, ShouldNotBeNil)
+		So(err.IsInvalidDestType(), ShouldBeTrue)
+	})
+}
+
+func testGetArrayBySingleId(t *testing.T, getter cacheStorage.CacheStorageGetter, setter cacheStorage.CacheStorageSetter) {
+	first := TestCatalogItem{Id: "10", Name: "Item10", Price: 10}
+	second := TestCatalogItem{Id: "10", Name: "Item10!", Price: 20}
+	Convey("Inserting two items under ID = 10", t, func() {
+		So(setter.Insert(context.TODO(), testCollectionName, "10", testVersion, first), ShouldBeNil)
+		So(setter.Insert(context.TODO(), testCollectionName, "10", testVersion, second), ShouldBeNil)
+	})
+	Convey("Getting every item stored under ID = 10", t, func() {
+		var testCatalogItems []TestCatalogItem
+		err := getter.GetArrayBySingleId(context.TODO(), testCollectionName, "10", testVersion, &testCatalogItems)
+		So(err, ShouldBeNil)
+		So(testCatalogItems, ShouldResemble, []TestCatalogItem{first, second})
+	})
+	Convey("Getting the item stored under ID = 10 by id returns the first one", t, func() {
+		var testCatalogItem TestCatalogItem
+		err := getter.GetById(context.TODO(), testCollectionName, "10", testVersion, &testCatalogItem)
+		So(err, ShouldBeNil)
+		So(testCatalogItem, ShouldResemble, first)
+	})
+	Convey("Getting items of a non existent ID = 11", t, func() {
+		var testCatalogItems []TestCatalogItem
+		err := getter.GetArrayBySingleId(context.TODO(), testCollectionName, "11", testVersion, &testCatalogItems)
+		So(err, ShouldBeNil)
+		So(len(testCatalogItems), ShouldEqual, 0)
+	})
+	Convey("Getting items of ID = 10 into a non slice dest", t, func() {
+		testCatalogItems := make(map[string]TestCatalogItem)
+		err := getter.GetArrayBySingleId(context.TODO(), testCollectionName, "10", testVersion, testCatalogItems)
+		So(err, ShouldNotBeNil)
+		So(err.IsInvalidDestType(), ShouldBeTrue)
+	})
+}
+
+func testGetStoredVersions(t *testing.T, getter cacheStorage.CacheStorageGetter, setter cacheStorage.CacheStorageSetter) {
+	Convey("Getting the stored versions of a collection", t, func() {
+		vers, err := cacheStorage.GetStoredVersions(context.TODO(), getter, testCollectionName)
+		So(err, ShouldBeNil)
+		So(vers, ShouldResemble, []string{"1", "3", "4"})
+	})
+	Convey("Getting the stored versions of a collection after removing one", t, func() {
+		So(setter.RemoveAll(context.TODO(), testCollectionName, "3"), ShouldBeNil)
+		So(setter.Insert(context.TODO(), testCollectionName, "1", "a:*", testCatalogItem1), ShouldBeNil)
+		vers, err := cacheStorage.GetStoredVersions(context.TODO(), getter, testCollectionName)
+		So(err, ShouldBeNil)
+		So(vers, ShouldResemble, []string{"1", "4", "a:*"})
+	})
+	Convey("Getting the stored versions of an unknown collection", t, func() {
+		vers, err := cacheStorage.GetStoredVersions(context.TODO(), getter, "unknown")
+		So(err, ShouldBeNil)
+		So(vers, ShouldBeEmpty)
+	})
+}
+
+func testInsert(t *testing.T, getter cacheStorage.CacheStorageGetter, setter cacheStorage.CacheStorageSetter) {
+	testCatalogItem := TestCatalogItem{Id: "5", Name: "Item5", Price: 50.60}
+	Convey("Inserting test item with ID = 5", t, func() {
+		err := setter.Insert(context.TODO(), testCollectionName, "5", testVersion, testCatalogItem)
+		So(err, ShouldBeNil)
+	})
+	Convey("Getting inserted test item with ID = 5", t, func() {
+		var insertedItem TestCatalogItem
+		err := getter.GetById(context.TODO(), testCollectionName, "5", testVersion, &insertedItem)
+		So(err, ShouldBeNil)
+		So(insertedItem, ShouldResemble, testCatalogItem)
+	})
+	Convey("Other versions of ID = 5 are left untouched", t, func() {
+		var otherItem TestCatalogItem
+		err := getter.GetById(context.TODO(), testCollectionName, "5", "4", &otherItem)
+		So(err, ShouldBeNil)
+		So(otherItem, ShouldResemble, testCatalogItem6)
+	})
+}
+
+func testInsertMany(t *testing.T, getter cacheStorage.CacheStorageGetter, setter cacheStorage.CacheStorageSetter) {
+	testCatalogItems := map[string]interface{}{
+		"6": TestCatalogItem{Id: "6", Name: "Item6", Price: 50.60},
+		"7": TestCatalogItem{Id: "7", Name: "Item7", Price: 50.60},
+		"8": TestCatalogItem{Id: "8", Name: "Item8", Price: 50.60},
+	}
+	Convey("Inserting test items with ID = 6, 7, 8", t, func() {
+		err := setter.InsertMany(context.TODO(), testCollectionName, testVersion, testCatalogItems)
+		So(err, ShouldBeNil)
+	})
+	Convey("Getting inserted test items with ID = 6, 7, 8", t, func() {
+		insertedItems := make(map[string]TestCatalogItem)
+		err := getter.GetManyByIds(context.TODO(), testCollectionName, []string{"6", "7", "8"}, testVersion, insertedItems)
+		So(err, ShouldBeNil)
+		So(len(insertedItems), ShouldEqual, 3)
+		So(insertedItems["7"], ShouldResemble, testCatalogItems["7"])
+	})
+}
+
+// testSerialization stores items no codec can encode, which must fail without writing anything.
+func testSerialization(t *testing.T, getter cacheStorage.CacheStorageGetter, setter cacheStorage.CacheStorageSetter) {
+	unserializable := make(chan int)
+	Convey("Storing an item that cannot be encoded", t, func() {
+		err := setter.Insert(context.TODO(), testCollectionName, "6", testVersion, unserializable)
+		So(err, ShouldNotBeNil)
+		So(err.IsSerialization(), ShouldBeTrue)
+		err = setter.Update(context.TODO(), testCollectionName, "1", testVersion, unserializable)
+		So(err, ShouldNotBeNil)
+		So(err.IsSerialization(), ShouldBeTrue)
+		err = setter.InsertOrUpdate(context.TODO(), testCollectionName, "1", testVersion, unserializable)
+		So(err, ShouldNotBeNil)
+		So(err.IsSerialization(), ShouldBeTrue)
+		testCatalogItem := TestCatalogItem{}
+		So(getter.GetById(context.TODO(), testCollectionName, "1", testVersion, &testCatalogItem), ShouldBeNil)
+		So(testCatalogItem, ShouldResemble, testCatalogItem1)
+	})
+	Convey("Inserting a batch holding items that cannot be encoded names them and inserts nothing", t, func() {
+		err := setter.InsertMany(context.TODO(), testCollectionName, testVersion, map[string]interface{}{
+			"6": TestCatalogItem{Id: "6", Name: "Item6", Price: 50.60},
+			"7": unserializable,
+			"8": unserializable,
+		})
+		So(err, ShouldNotBeNil)
+		So(err.IsSerialization(), ShouldBeTrue)
+		So(err.Error(), ShouldContainSubstring, "[7 8]")
+		testCatalogItem := TestCatalogItem{}
+		err = getter.GetById(context.TODO(), testCollectionName, "6", testVersion, &testCatalogItem)
+		So(err, ShouldNotBeNil)
+		So(err.IsNotFound(), ShouldBeTrue)
+	})
+}
+
+func testUpdate(t *testing.T, getter cacheStorage.CacheStorageGetter, setter cacheStorage.CacheStorageSetter) {
+	updated := testCatalogItem1
+	updated.Name = updated.Name + "!"
+	Convey("Updating existing test item with ID = 1", t, func() {
+		err := setter.Update(context.TODO(), testCollectionName, "1", testVersion, updated)
+		So(err, ShouldBeNil)
+	})
+	Convey("Getting updated test item with ID = 1 and name = Item1!", t, func() {
+		testCatalogItem := TestCatalogItem{}
+		err := getter.GetById(context.TODO(), testCollectionName, "1", testVersion, &testCatalogItem)
+		So(err, ShouldBeNil)
+		So(testCatalogItem, ShouldResemble, updated)
+	})
+	Convey("Updating non existent test item with ID = 9 does not insert it", t, func() {
+		err := setter.Update(context.TODO(), testCollectionName, "9", testVersion, updated)
+		So(err, ShouldBeNil)
+		testCatalogItem := TestCatalogItem{}
+		err = getter.GetById(context.TODO(), testCollectionName, "9", testVersion, &testCatalogItem)
+		So(err, ShouldNotBeNil)
+		So(err.IsNotFound(), ShouldBeTrue)
+	})
+}
+
+func testInsertOrUpdate(t *testing.T, getter cacheStorage.CacheStorageGetter, setter cacheStorage.CacheStorageSetter) {
+	testCatalogItem := TestCatalogItem{Id: "9", Name: "Item9", Price: 99.69}
+	Convey("Inserting or updating non exist test item with ID = 9", t, func() {
+		err := setter.InsertOrUpdate(context.TODO(), testCollectionName, "9", testVersion, testCatalogItem)
+		So(err, ShouldBeNil)
+	})
+	Convey("Getting inserted test item with ID = 9 and name = Item9", t, func() {
+		var insertedItem TestCatalogItem
+		err := getter.GetById(context.TODO(), testCollectionName, "9", testVersion, &insertedItem)
+		So(err, ShouldBeNil)
+		So(insertedItem, ShouldResemble, testCatalogItem)
+	})
+
+	testCatalogItem.Name = testCatalogItem.Name + "!"
+	Convey("Inserting or updating exist test item with ID = 9", t, func() {
+		err := setter.InsertOrUpdate(context.TODO(), testCollectionName, "9", testVersion, testCatalogItem)
+		So(err, ShouldBeNil)
+	})
+	Convey("Getting updated test item with ID = 9 and name = Item9!", t, func() {
+		var insertedItems []TestCatalogItem
+		err := getter.GetArrayBySingleId(context.TODO(), testCollectionName, "9", testVersion, &insertedItems)
+		So(err, ShouldBeNil)
+		So(insertedItems, ShouldResemble, []TestCatalogItem{testCatalogItem})
+	})
+}
+
+func testRemove(t *testing.T, getter cacheStorage.CacheStorageGetter, setter cacheStorage.CacheStorageSetter) {
+	Convey("Removing test item with ID = 1", t, func() {
+		err := setter.Remove(context.TODO(), testCollectionName, "1", testVersion)
+		So(err, ShouldBeNil)
+	})
+	Convey("Getting removed test item with ID = 1", t, func() {
+		insertedItems := make(map[string]TestCatalogItem)
+		err := getter.GetManyByIds(context.TODO(), testCollectionName, []string{"1"}, testVersion, insertedItems)
+		So(err, ShouldNotBeNil)
+		So(err.IsNotFound(), ShouldBeTrue)
+		So(len(insertedItems), ShouldEqual, 0)
+	})
+	Convey("Removing non existent test item with ID = 9", t, func() {
+		err := setter.Remove(context.TODO(), testCollectionName, "9", testVersion)
+		So(err, ShouldBeNil)
+	})
+	Convey("Removing a single version of test item with ID = 5", t, func() {
+		err := setter.Remove(context.TODO(), testCollectionName, "5", "3")
+		So(err, ShouldBeNil)
+		var testCatalogItem TestCatalogItem
+		err = getter.GetById(context.TODO(), testCollectionName, "5", "4", &testCatalogItem)
+		So(err, ShouldBeNil)
+		So(testCatalogItem, ShouldResemble, testCatalogItem6)
+	})
+}
+
+func testRemoveAll(t *testing.T, getter cacheStorage.CacheStorageGetter, setter cacheStorage.CacheStorageSetter) {
+	Convey("Removing all items", t, func() {
+		err := setter.RemoveAll(context.TODO(), testCollectionName, testVersion)
+		So(err, ShouldBeNil)
+	})
+	Convey("Getting all items", t, func() {
+		insertedItems := make(map[string]TestCatalogItem)
+		err := getter.GetAll(context.TODO(), testCollectionName, testVersion, insertedItems)
+		So(err, ShouldBeNil)
+		So(len(insertedItems), ShouldEqual, 0)
+	})
+	Convey("Items of other versions are left untouched", t, func() {
+		insertedItems := make(map[string]TestCatalogItem)
+		err := getter.GetAll(context.TODO(), testCollectionName, "3", insertedItems)
+		So(err, ShouldBeNil)
+		So(len(insertedItems), ShouldEqual, 1)
+	})
+}
+
+func testGetAndLockById(t *testing.T, getter cacheStorage.CacheStorageGetter, setter cacheStorage.CacheStorageSetter) {
+	var held cacheStorage.LockHandle
+	Convey("Locking a free item returns it with the handle of the lock", t, func() {
+		var testCatalogItem TestCatalogItem
+		lock, err := setter.GetAndLockById(context.TODO(), testCollectionName, "1", &testCatalogItem)
+		So(err, ShouldBeNil)
+		So(testCatalogItem, ShouldResemble, testCatalogItem1)
+		So(lock.Collection, ShouldEqual, testCollectionName)
+		So(lock.Id, ShouldEqual, "1")
+		So(lock.Owner, ShouldNotBeEmpty)
+		So(lock.Fence, ShouldBeGreaterThan, 0)
+		held = lock
+	})
+	Convey("Locking a held item gives up when the context is done", t, func() {
+		var testCatalogItem TestCatalogItem
+		c, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+		_, err := setter.GetAndLockById(c, testCollectionName, "1", &testCatalogItem)
+		So(err, ShouldNotBeNil)
+		So(err.IsTimeout(), ShouldBeTrue)
+		So(err.IsRetryable(), ShouldBeTrue)
+		So(errors.Is(err, context.DeadlineExceeded), ShouldBeTrue)
+	})
+	Convey("Locking a held item gives up when the context is canceled", t, func() {
+		var testCatalogItem TestCatalogItem
+		c, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(100*time.Millisecond, cancel)
+		_, err := setter.GetAndLockById(c, testCollectionName, "1", &testCatalogItem)
+		So(err, ShouldNotBeNil)
+		So(err.IsCanceled(), ShouldBeTrue)
+		So(err.IsRetryable(), ShouldBeFalse)
+	})
+	Convey("Releasing with the handle of another owner leaves the item locked", t, func() {
+		stale := held
+		stale.Owner = cacheStorage.NewLockOwner()
+		So(setter.ReleaseLockedById(context.TODO(), stale), ShouldBeNil)
+		var testCatalogItem TestCatalogItem
+		c, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+		_, err := setter.GetAndLockById(c, testCollectionName, "1", &testCatalogItem)
+		So(err, ShouldNotBeNil)
+		So(err.IsTimeout(), ShouldBeTrue)
+	})
+	Convey("Locking a held item waits until it is released", t, func() {
+		type locked struct {
+			lock cacheStorage.LockHandle
+			err  cacheStorage.CacheStorageError
+		}
+		acquired := make(chan locked, 1)
+		go func() {
+			var testCatalogItem TestCatalogItem
+			lock, err := setter.GetAndLockById(context.TODO(), testCollectionName, "1", &testCatalogItem)
+			acquired <- locked{lock, err}
+		}()
+		acquiredWhileHeld := false
+		select {
+		case <-acquired:
+			acquiredWhileHeld = true
+		case <-time.After(200 * time.Millisecond):
+		}
+		So(acquiredWhileHeld, ShouldBeFalse)
+
+		So(setter.ReleaseLockedById(context.TODO(), held), ShouldBeNil)
+		acquiredAfterRelease := false
+		select {
+		case res := <-acquired:
+			So(res.err, ShouldBeNil)
+			So(res.lock.Owner, ShouldNotEqual, held.Owner)
+			So(res.lock.Fence, ShouldBeGreaterThan, held.Fence)
+			held = res.lock
+			acquiredAfterRelease = true
+		case <-time.After(5 * time.Second):
+		}
+		So(acquiredAfterRelease, ShouldBeTrue)
+	})
+	Convey("Updating a locked item releases it and keeps its fence growing", t, func() {
+		So(setter.Update(context.TODO(), testCollectionName, "1", testVersion, testCatalogItem1), ShouldBeNil)
+		var testCatalogItem TestCatalogItem
+		c, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		lock, err := setter.GetAndLockById(c, testCollectionName, "1", &testCatalogItem)
+		So(err, ShouldBeNil)
+		So(lock.Fence, ShouldBeGreaterThan, held.Fence)
+		So(setter.ReleaseLockedById(context.TODO(), lock), ShouldBeNil)
+	})
+	Convey("Updating and releasing a locked item writes it while the lock is held", t, func() {
+		var testCatalogItem TestCatalogItem
+		lock, err := setter.GetAndLockById(context.TODO(), testCollectionName, "1", &testCatalogItem)
+		So(err, ShouldBeNil)
+		updated := TestCatalogItem{Id: "1", Name: "Item1 updated", Price: 11}
+		So(setter.UpdateAndRelease(context.TODO(), lock, updated), ShouldBeNil)
+		So(getter.GetById(context.TODO(), testCollectionName, "1", testVersion, &testCatalogItem), ShouldBeNil)
+		So(testCatalogItem, ShouldResemble, updated)
+
+		err = setter.UpdateAndRelease(context.TODO(), lock, testCatalogItem1)
+		So(err, ShouldNotBeNil)
+		So(err.IsConflict(), ShouldBeTrue)
+		So(errors.Is(err, cacheStorage.ErrLockNotHeld), ShouldBeTrue)
+		So(getter.GetById(context.TODO(), testCollectionName, "1", testVersion, &testCatalogItem), ShouldBeNil)
+		So(testCatalogItem, ShouldResemble, updated)
+
+		c, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+		lock, err = setter.GetAndLockById(c, testCollectionName, "1", &testCatalogItem)
+		So(err, ShouldBeNil)
+		So(setter.UpdateAndRelease(context.TODO(), lock, testCatalogItem1), ShouldBeNil)
+	})
+	Convey("Locking a non existent item", t, func() {
+		var testCatalogItem TestCatalogItem
+		_, err := setter.GetAndLockById(context.TODO(), testCollectionName, "9", &testCatalogItem)
+		So(err, ShouldNotBeNil)
+		So(err.IsNotFound(), ShouldBeTrue)
+	})
+}
+
+// testLockOptions runs against a storage whose locks lease for 300ms, whose lockers wait for at most 200ms and whose
+// updates are guarded.
+func testLockOptions(t *testing.T, getter cacheStorage.CacheStorageGetter, setter cacheStorage.CacheStorageSetter) {
+	var first cacheStorage.LockHandle
+	Convey("Locking a held item gives up after the max wait", t, func() {
+		var testCatalogItem TestCatalogItem
+		lock, err := setter.GetAndLockById(context.TODO(), testCollectionName, "1", &testCatalogItem)
+		So(err, ShouldBeNil)
+		first = lock
+		started := time.Now()
+		_, err = setter.GetAndLockById(context.TODO(), testCollectionName, "1", &testCatalogItem)
+		So(err, ShouldNotBeNil)
+		So(err.IsLockTimeout(), ShouldBeTrue)
+		So(err.IsRetryable(), ShouldBeTrue)
+		So(time.Since(started), ShouldBeLessThan, 2*time.Second)
+	})
+	Convey("Locking an item whose lease ran out takes it over", t, func() {
+		time.Sleep(300 * time.Millisecond)
+		var testCatalogItem TestCatalogItem
+		second, err := setter.GetAndLockById(context.TODO(), testCollectionName, "1", &testCatalogItem)
+		So(err, ShouldBeNil)
+		So(testCatalogItem, ShouldResemble, testCatalogItem1)
+		So(second.Fence, ShouldBeGreaterThan, first.Fence)
+		So(setter.ReleaseLockedById(context.TODO(), first), ShouldBeNil)
+		_, err = setter.GetAndLockById(context.TODO(), testCollectionName, "1", &testCatalogItem)
+		So(err, ShouldNotBeNil)
+		So(err.IsLockTimeout(), ShouldBeTrue)
+	})
+	Convey("Renewing a lock keeps it past its lease", t, func() {
+		time.Sleep(300 * time.Millisecond)
+		var testCatalogItem TestCatalogItem
+		lock, err := setter.GetAndLockById(context.TODO(), testCollectionName, "1", &testCatalogItem)
+		So(err, ShouldBeNil)
+		time.Sleep(200 * time.Millisecond)
+		So(setter.RenewLock(context.TODO(), lock), ShouldBeNil)
+		time.Sleep(200 * time.Millisecond)
+		c, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		_, err = setter.GetAndLockById(c, testCollectionName, "1", &testCatalogItem)
+		So(err, ShouldNotBeNil)
+		So(err.IsLockTimeout(), ShouldBeTrue)
+		So(setter.ReleaseLockedById(context.TODO(), lock), ShouldBeNil)
+	})
+	Convey("Renewing a lock whose lease ran out fails", t, func() {
+		var testCatalogItem TestCatalogItem
+		lock, err := setter.GetAndLockById(context.TODO(), testCollectionName, "1", &testCatalogItem)
+		So(err, ShouldBeNil)
+		time.Sleep(400 * time.Millisecond)
+		err = setter.RenewLock(context.TODO(), lock)
+		So(err, ShouldNotBeNil)
+		So(err.IsConflict(), ShouldBeTrue)
+		So(errors.Is(err, cacheStorage.ErrLockNotHeld), ShouldBeTrue)
+	})
+	Convey("Keeping a lock renews it until its context is done", t, func() {
+		var testCatalogItem TestCatalogItem
+		lock, err := setter.GetAndLockById(context.TODO(), testCollectionName, "1", &testCatalogItem)
+		So(err, ShouldBeNil)
+		c, cancel := context.WithCancel(context.Background())
+		lost := cacheStorage.KeepLock(c, setter, lock, 100*time.Millisecond)
+		time.Sleep(600 * time.Millisecond)
+		wait, cancelWait := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancelWait()
+		_, err = setter.GetAndLockById(wait, testCollectionName, "1", &testCatalogItem)
+		So(err, ShouldNotBeNil)
+		So(err.IsLockTimeout(), ShouldBeTrue)
+		cancel()
+		_, reported := <-lost
+		So(reported, ShouldBeFalse)
+		So(setter.ReleaseLockedById(context.TODO(), lock), ShouldBeNil)
+	})
+	Convey("Keeping a lock reports losing it", t, func() {
+		var testCatalogItem TestCatalogItem
+		lock, err := setter.GetAndLockById(context.TODO(), testCollectionName, "1", &testCatalogItem)
+		So(err, ShouldBeNil)
+		So(setter.ReleaseLockedById(context.TODO(), lock), ShouldBeNil)
+		c, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		var lostErr cacheStorage.CacheStorageError
+		select {
+		case lostErr = <-cacheStorage.KeepLock(c, setter, lock, 50*time.Millisecond):
+		case <-time.After(5 * time.Second):
+		}
+		So(lostErr, ShouldNotBeNil)
+		So(errors.Is(lostErr, cacheStorage.ErrLockNotHeld), ShouldBeTrue)
+	})
+	Convey("Updating and releasing an item whose lease ran out fails", t, func() {
+		var testCatalogItem TestCatalogItem
+		lock, err := setter.GetAndLockById(context.TODO(), testCollectionName, "1", &testCatalogItem)
+		So(err, ShouldBeNil)
+		time.Sleep(400 * time.Millisecond)
+		err = setter.UpdateAndRelease(context.TODO(), lock, TestCatalogItem{Id: "1", Name: "Item1 updated"})
+		So(err, ShouldNotBeNil)
+		So(errors.Is(err, cacheStorage.ErrLockNotHeld), ShouldBeTrue)
+		So(getter.GetById(context.TODO(), testCollectionName, "1", testVersion, &testCatalogItem), ShouldBeNil)
+		So(testCatalogItem, ShouldResemble, testCatalogItem1)
+	})
+	Convey("Guarded updates refuse to overwrite locked items", t, func() {
+		var testCatalogItem TestCatalogItem
+		lock, err := setter.GetAndLockById(context.TODO(), testCollectionName, "1", &testCatalogItem)
+		So(err, ShouldBeNil)
+		updated := TestCatalogItem{Id: "1", Name: "Item1 updated", Price: 11}
+		err = setter.Update(context.TODO(), testCollectionName, "1", testVersion, updated)
+		So(err, ShouldNotBeNil)
+		So(err.IsConflict(), ShouldBeTrue)
+		So(errors.Is(err, cacheStorage.ErrLockNotHeld), ShouldBeTrue)
+		err = setter.InsertOrUpdate(context.TODO(), testCollectionName, "1", testVersion, updated)
+		So(errors.Is(err, cacheStorage.ErrLockNotHeld), ShouldBeTrue)
+		So(getter.GetById(context.TODO(), testCollectionName, "1", testVersion, &testCatalogItem), ShouldBeNil)
+		So(testCatalogItem, ShouldResemble, testCatalogItem1)
+
+		So(setter.Update(context.TODO(), testCollectionName, "2", testVersion, testCatalogItem2), ShouldBeNil)
+		So(setter.Update(context.TODO(), testCollectionName, "9", testVersion, testCatalogItem2), ShouldBeNil)
+		So(setter.InsertOrUpdate(context.TODO(), testCollectionName, "9", testVersion, testCatalogItem2), ShouldBeNil)
+
+		So(setter.UpdateAndRelease(context.TODO(), lock, updated), ShouldBeNil)
+		So(setter.Update(context.TODO(), testCollectionName, "1", testVersion, testCatalogItem1), ShouldBeNil)
+	})
+	Convey("Guarded updates overwrite items whose lease ran out", t, func() {
+		var testCatalogItem TestCatalogItem
+		_, err := setter.GetAndLockById(context.TODO(), testCollectionName, "1", &testCatalogItem)
+		So(err, ShouldBeNil)
+		time.Sleep(400 * time.Millisecond)
+		So(setter.Update(context.TODO(), testCollectionName, "1", testVersion, testCatalogItem1), ShouldBeNil)
+		lock, err := setter.GetAndLockById(context.TODO(), testCollectionName, "1", &testCatalogItem)
+		So(err, ShouldBeNil)
+		So(setter.ReleaseLockedById(context.TODO(), lock), ShouldBeNil)
+	})
+}
+
+// testLocker runs against a storage whose locks lease for 300ms and whose lockers wait for at most 200ms.
+func testLocker(t *testing.T, cache cacheStorage.CacheStorage) {
+	locker := cache.GetLocker()
+	var held cacheStorage.LockHandle
+	Convey("Locking a free name returns the handle of the lock", t, func() {
+		lock, err := locker.Lock(context.TODO(), "reconciliation")
+		So(err, ShouldBeNil)
+		So(lock.Id, ShouldEqual, "reconciliation")
+		So(lock.Owner, ShouldNotBeEmpty)
+		So(lock.Fence, ShouldBeGreaterThan, 0)
+		held = lock
+	})
+	Convey("Locking a held name", t, func() {
+		_, locked, err := locker.TryLock(context.TODO(), "reconciliation")
+		So(err, ShouldBeNil)
+		So(locked, ShouldBeFalse)
+		_, err = locker.Lock(context.TODO(), "reconciliation")
+		So(err, ShouldNotBeNil)
+		So(err.IsLockTimeout(), ShouldBeTrue)
+	})
+	Convey("Named locks are apart from the items", t, func() {
+		lock, err := locker.Lock(context.TODO(), testCollectionName)
+		So(err, ShouldBeNil)
+		_, setter := cache.GetCacheStorageClient()
+		var testCatalogItem TestCatalogItem
+		itemLock, err := setter.GetAndLockById(context.TODO(), testCollectionName, "1", &testCatalogItem)
+		So(err, ShouldBeNil)
+		So(setter.ReleaseLockedById(context.TODO(), itemLock), ShouldBeNil)
+		So(locker.Unlock(context.TODO(), lock), ShouldBeNil)
+	})
+	Convey("Unlocking frees the name for the next owner", t, func() {
+		So(locker.Unlock(context.TODO(), held), ShouldBeNil)
+		lock, locked, err := locker.TryLock(context.TODO(), "reconciliation")
+		So(err, ShouldBeNil)
+		So(locked, ShouldBeTrue)
+		So(lock.Fence, ShouldBeGreaterThan, held.Fence)
+		So(locker.Unlock(context.TODO(), held), ShouldBeNil)
+		_, locked, err = locker.TryLock(context.TODO(), "reconciliation")
+		So(err, ShouldBeNil)
+		So(locked, ShouldBeFalse)
+		held = lock
+	})
+	Convey("Locking a name whose lease ran out takes it over", t, func() {
+		time.Sleep(400 * time.Millisecond)
+		err := locker.RenewLock(context.TODO(), held)
+		So(errors.Is(err, cacheStorage.ErrLockNotHeld), ShouldBeTrue)
+		lock, err := locker.Lock(context.TODO(), "reconciliation")
+		So(err, ShouldBeNil)
+		So(lock.Fence, ShouldBeGreaterThan, held.Fence)
+		held = lock
+	})
+	Convey("Keeping a named lock renews it", t, func() {
+		c, cancel := context.WithCancel(context.Background())
+		lost := cacheStorage.KeepLock(c, locker, held, 100*time.Millisecond)
+		time.Sleep(600 * time.Millisecond)
+		_, locked, err := locker.TryLock(context.TODO(), "reconciliation")
+		So(err, ShouldBeNil)
+		So(locked, ShouldBeFalse)
+		cancel()
+		_, reported := <-lost
+		So(reported, ShouldBeFalse)
+		So(locker.Unlock(context.TODO(), held), ShouldBeNil)
+	})
+	Convey("A semaphore lets up to n owners hold it", t, func() {
+		semaphore := locker.Semaphore("exports", 2)
+		first, acquired, err := semaphore.TryAcquire(context.TODO())
+		So(err, ShouldBeNil)
+		So(acquired, ShouldBeTrue)
+		second, err := semaphore.Acquire(context.TODO())
+		So(err, ShouldBeNil)
+		So(second.Owner, ShouldNotEqual, first.Owner)
+		_, acquired, err = semaphore.TryAcquire(context.TODO())
+		So(err, ShouldBeNil)
+		So(acquired, ShouldBeFalse)
+		_, err = semaphore.Acquire(context.TODO())
+		So(err, ShouldNotBeNil)
+		So(err.IsLockTimeout(), ShouldBeTrue)
+
+		So(semaphore.RenewLock(context.TODO(), first), ShouldBeNil)
+		So(semaphore.Release(context.TODO(), first), ShouldBeNil)
+		So(errors.Is(semaphore.RenewLock(context.TODO(), first), cacheStorage.ErrLockNotHeld), ShouldBeTrue)
+		third, acquired, err := semaphore.TryAcquire(context.TODO())
+		So(err, ShouldBeNil)
+		So(acquired, ShouldBeTrue)
+		So(semaphore.Release(context.TODO(), second), ShouldBeNil)
+		So(semaphore.Release(context.TODO(), third), ShouldBeNil)
+	})
+	Convey("A semaphore needs a slot", t, func() {
+		_, _, err := locker.Semaphore("exports", 0).TryAcquire(context.TODO())
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func testUpdateCacheVersion(t *testing.T, getter cacheStorage.CacheStorageGetter, setter cacheStorage.CacheStorageSetter) {
+	Convey("Updating the cache version of a collection keeps what the update does not change", t, func() {
+		err := cacheStorage.UpdateCacheVersion(context.TODO(), setter, "stores", func(cacheVersion *cacheStorage.CacheVersion) error {
+			cacheVersion.CacheType = "local"
+			return nil
+		})
+		So(err, ShouldBeNil)
+		version, err := getter.GetLatestCollectionVersion(context.TODO(), "stores")
+		So(err, ShouldBeNil)
+		So(version.CacheType, ShouldEqual, "local")
+		So(len(version.Versions), ShouldEqual, 1)
+		So(version.Versions[0].Version, ShouldEqual, "2")
+	})
+	Convey("Updating the cache version of a new collection creates it", t, func() {
+		err := cacheStorage.UpdateCacheVersion(context.TODO(), setter, "menus", func(cacheVersion *cacheStorage.CacheVersion) error {
+			So(cacheVersion.CollectionName, ShouldEqual, "menus")
+			So(cacheVersion.Versions, ShouldBeEmpty)
+			cacheVersion.Versions = append(cacheVersion.Versions, cacheStorage.Version{Version: "1", TimedTo: versionsTimedTo})
+			return nil
+		})
+		So(err, ShouldBeNil)
+		versions, err := getter.GetLatestVersions(context.TODO())
+		So(err, ShouldBeNil)
+		So(len(versions), ShouldEqual, 5)
+	})
+	Convey("Updating the cache version with a failing update writes nothing", t, func() {
+		failed := errors.New("failed")
+		err := cacheStorage.UpdateCacheVersion(context.TODO(), setter, "occasions", func(cacheVersion *cacheStorage.CacheVersion) error {
+			cacheVersion.Versions = nil
+			return failed
+		})
+		So(err, ShouldNotBeNil)
+		version, err := getter.GetLatestCollectionVersion(context.TODO(), "occasions")
+		So(err, ShouldBeNil)
+		So(len(version.Versions), ShouldEqual, 1)
+	})
+	Convey("Updating the cache version concurrently loses no update", t, func() {
+		const writers = 10
+		errs := make(chan cacheStorage.CacheStorageError, writers)
+		for i := 0; i < writers; i++ {
+			version := fmt.Sprint("v", i)
+			go func() {
+				errs <- cacheStorage.UpdateCacheVersion(context.TODO(), setter, "promotions", func(cacheVersion *cacheStorage.CacheVersion) error {
+					cacheVersion.Versions = append(cacheVersion.Versions, cacheStorage.Version{Version: version, TimedTo: versionsTimedTo})
+					return nil
+				})
+			}()
+		}
+		for i := 0; i < writers; i++ {
+			So(<-errs, ShouldBeNil)
+		}
+		version, err := getter.GetLatestCollectionVersion(context.TODO(), "promotions")
+		So(err, ShouldBeNil)
+		So(len(version.Versions), ShouldEqual, writers)
+		var entries []cacheStorage.CacheVersion
+		So(getter.GetArrayBySingleId(context.TODO(), CacheVersionsCollectionName, "promotions", "1", &entries), ShouldBeNil)
+		So(len(entries), ShouldEqual, 1)
+	})
+}
+
+func testMoveVersion(t *testing.T, getter cacheStorage.CacheStorageGetter, setter cacheStorage.CacheStorageSetter) {
+	Convey("Moving a version to an unused ver", t, func() {
+		moved, err := cacheStorage.MoveVersion(context.TODO(), setter, testCollectionName, testVersion, "2")
+		So(err, ShouldBeNil)
+		So(moved, ShouldEqual, 4)
+		items := make(map[string]TestCatalogItem)
+		So(getter.GetAll(context.TODO(), testCollectionName, "2", items), ShouldBeNil)
+		So(len(items), ShouldEqual, 4)
+		So(items["1"], ShouldResemble, testCatalogItem1)
+		items = make(map[string]TestCatalogItem)
+		So(getter.GetAll(context.TODO(), testCollectionName, testVersion, items), ShouldBeNil)
+		So(items, ShouldBeEmpty)
+		vers, err := cacheStorage.GetStoredVersions(context.TODO(), getter, testCollectionName)
+		So(err, ShouldBeNil)
+		So(vers, ShouldResemble, []string{"2", "3", "4"})
+	})
+	Convey("Moving a version keeps the items lockable", t, func() {
+		var testCatalogItem TestCatalogItem
+		lock, err := setter.GetAndLockById(context.TODO(), testCollectionName, "1", &testCatalogItem)
+		So(err, ShouldBeNil)
+		So(testCatalogItem, ShouldResemble, testCatalogItem1)
+		So(setter.ReleaseLockedById(context.TODO(), lock), ShouldBeNil)
+	})
+	Convey("Moving a version to a ver already holding items", t, func() {
+		_, err := cacheStorage.MoveVersion(context.TODO(), setter, testCollectionName, "2", "3")
+		So(err, ShouldNotBeNil)
+		var testCatalogItem TestCatalogItem
+		So(getter.GetById(context.TODO(), testCollectionName, "1", "2", &testCatalogItem), ShouldBeNil)
+	})
+	Convey("Moving a version without items", t, func() {
+		moved, err := cacheStorage.MoveVersion(context.TODO(), setter, testCollectionName, "9", "10")
+		So(err, ShouldBeNil)
+		So(moved, ShouldEqual, 0)
+	})
+}
@@ -0,0 +1,125 @@
+package cacheStorage
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/vmihailenco/msgpack/v5"
+	"go.mongodb.org/mongo-driver/bson"
+	"sync"
+)
+
+var ErrUnknownCodec = errors.New("Unknown codec")
+
+/*
+Codec encodes the items of a collection. Backends record its Name with every item they store and decode the item with
+the codec registered under that name, so a collection can switch codecs and still read the items written before.
+Items recorded without a codec name were written as JSON.
+*/
+type Codec interface {
+	Name() string
+	Marshal(item interface{}) ([]byte, error)
+	Unmarshal(data []byte, dest interface{}) error
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string {
+	return "json"
+}
+
+func (jsonCodec) Marshal(item interface{}) ([]byte, error) {
+	return json.Marshal(item)
+}
+
+func (jsonCodec) Unmarshal(data []byte, dest interface{}) error {
+	return json.Unmarshal(data, dest)
+}
+
+// gobCodec encodes items with encoding/gob. Items holding interface values need their concrete types gob.Register-ed.
+type gobCodec struct{}
+
+func (gobCodec) Name() string {
+	return "gob"
+}
+
+func (gobCodec) Marshal(item interface{}) ([]byte, error) {
+	var data bytes.Buffer
+	if err := gob.NewEncoder(&data).Encode(item); err != nil {
+		return nil, err
+	}
+	return data.Bytes(), nil
+}
+
+func (gobCodec) Unmarshal(data []byte, dest interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(dest)
+}
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) Name() string {
+	return "msgpack"
+}
+
+func (msgpackCodec) Marshal(item interface{}) ([]byte, error) {
+	return msgpack.Marshal(item)
+}
+
+func (msgpackCodec) Unmarshal(data []byte, dest interface{}) error {
+	return msgpack.Unmarshal(data, dest)
+}
+
+// bsonCodec encodes items as BSON documents, so only structs and maps can be encoded with it.
+type bsonCodec struct{}
+
+func (bsonCodec) Name() string {
+	return "bson"
+}
+
+func (bsonCodec) Marshal(item interface{}) ([]byte, error) {
+	return bson.Marshal(item)
+}
+
+func (bsonCodec) Unmarshal(data []byte, dest interface{}) error {
+	return bson.Unmarshal(data, dest)
+}
+
+var JSONCodec Codec = jsonCodec{}
+var GobCodec Codec = gobCodec{}
+var MsgpackCodec Codec = msgpackCodec{}
+var BSONCodec Codec = bsonCodec{}
+
+var codecs = struct {
+	mu     sync.RWMutex
+	byName map[string]Codec
+}{byName: map[string]Codec{
+	JSONCodec.Name():    JSONCodec,
+	GobCodec.Name():     GobCodec,
+	MsgpackCodec.Name(): MsgpackCodec,
+	BSONCodec.Name():    BSONCodec,
+}}
+
+// RegisterCodec makes codec available for decoding the items recorded with its name, replacing any codec registered
+// under the same name. The JSON, gob, MessagePack and BSON codecs are registered already.
+func RegisterCodec(codec Codec) {
+	codecs.mu.Lock()
+	defer codecs.mu.Unlock()
+	codecs.byName[codec.Name()] = codec
+}
+
+// LookupCodec returns the codec registered under name. An empty name is the JSON codec, which items written before
+// codecs were recorded used.
+func LookupCodec(name string) (Codec, error) {
+	if name == "" {
+		return JSONCodec, nil
+	}
+	codecs.mu.RLock()
+	defer codecs.mu.RUnlock()
+	codec, ok := codecs.byName[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownCodec, name)
+	}
+	return codec, nil
+}
@@ -0,0 +1,71 @@
+package cacheStorage
+
+import (
+	"context"
+	"fmt"
+)
+
+/*
+Collection is a typed view of a collection over any CacheStorageGetter and CacheStorageSetter. Its dests are built from
+T, so they always have a shape the backends accept and the InvalidDestType errors of the untyped getters can't happen.
+*/
+type Collection[T any] struct {
+	getter CacheStorageGetter
+	setter CacheStorageSetter
+	name   string
+}
+
+// NewCollection returns a typed view of collection. setter may be nil for a view that is only read.
+func NewCollection[T any](getter CacheStorageGetter, setter CacheStorageSetter, collection string) *Collection[T] {
+	return &Collection[T]{getter: getter, setter: setter, name: collection}
+}
+
+// Name returns the name of the viewed collection.
+func (col *Collection[T]) Name() string {
+	return col.name
+}
+
+func (col *Collection[T]) Get(c context.Context, id string, ver string) (T, CacheStorageError) {
+	var item T
+	if err := col.getter.GetById(c, col.name, id, ver, &item); err != nil {
+		var zero T
+		return zero, err
+	}
+	return item, nil
+}
+
+// GetMany returns the items of ids found in ver, keyed by id. When some are missing it returns the ones found along
+// with the not found error, as GetManyByIds does.
+func (col *Collection[T]) GetMany(c context.Context, ids []string, ver string) (map[string]T, CacheStorageError) {
+	items := make(map[string]T, len(ids))
+	err := col.getter.GetManyByIds(c, col.name, ids, ver, items)
+	return items, err
+}
+
+// All returns every item of ver, keyed by id.
+func (col *Collection[T]) All(c context.Context, ver string) (map[string]T, CacheStorageError) {
+	items := make(map[string]T)
+	if err := col.getter.GetAll(c, col.name, ver, items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// GetActive returns the item of id in the version of the collection active right now.
+func (col *Collection[T]) GetActive(c context.Context, id string) (T, CacheStorageError) {
+	var item T
+	if err := GetByIdActive(c, col.getter, col.name, id, &item); err != nil {
+		var zero T
+		return zero, err
+	}
+	return item, nil
+}
+
+// Put inserts item under id in ver, or replaces the item already there. It fails with ErrNotSupported on a view that
+// is only read.
+func (col *Collection[T]) Put(c context.Context, id string, ver string, item T) CacheStorageError {
+	if col.setter == nil {
+		return NewCacheStorageError(fmt.Errorf("%w: the view of collection %v is only read", ErrNotSupported, col.name))
+	}
+	return col.setter.InsertOrUpdate(c, col.name, id, ver, item)
+}
@@ -0,0 +1,62 @@
+package cacheStorage_test
+
+import (
+	"context"
+	"errors"
+	"github.com/orchestd/cacheStorage"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func TestCollection(t *testing.T) {
+	getter, setter := newTestSetter(t)
+	catalog := cacheStorage.NewCollection[TestCatalogItem](getter, setter, "catalog")
+	Convey("Putting and getting typed items", t, func() {
+		So(catalog.Put(context.TODO(), "1", "1", TestCatalogItem{Id: "1", Name: "Item1"}), ShouldBeNil)
+		So(catalog.Put(context.TODO(), "2", "1", TestCatalogItem{Id: "2", Name: "Item2"}), ShouldBeNil)
+		So(catalog.Put(context.TODO(), "1", "1", TestCatalogItem{Id: "1", Name: "Item1b"}), ShouldBeNil)
+
+		item, err := catalog.Get(context.TODO(), "1", "1")
+		So(err, ShouldBeNil)
+		So(item, ShouldResemble, TestCatalogItem{Id: "1", Name: "Item1b"})
+
+		items, err := catalog.GetMany(context.TODO(), []string{"1", "2"}, "1")
+		So(err, ShouldBeNil)
+		So(items, ShouldResemble, map[string]TestCatalogItem{
+			"1": {Id: "1", Name: "Item1b"},
+			"2": {Id: "2", Name: "Item2"},
+		})
+
+		all, err := catalog.All(context.TODO(), "1")
+		So(err, ShouldBeNil)
+		So(len(all), ShouldEqual, 2)
+	})
+	Convey("Getting many items with a missing one returns the ones found", t, func() {
+		items, err := catalog.GetMany(context.TODO(), []string{"1", "3"}, "1")
+		So(err, ShouldNotBeNil)
+		So(err.IsNotFound(), ShouldBeTrue)
+		So(items, ShouldResemble, map[string]TestCatalogItem{"1": {Id: "1", Name: "Item1b"}})
+	})
+	Convey("Getting a missing item returns the zero value", t, func() {
+		item, err := catalog.Get(context.TODO(), "3", "1")
+		So(err, ShouldNotBeNil)
+		So(err.IsNotFound(), ShouldBeTrue)
+		So(item, ShouldResemble, TestCatalogItem{})
+	})
+	Convey("Getting an item of the active version", t, func() {
+		So(cacheStorage.PublishVersion(context.TODO(), setter, "catalog", "1", time.Now().Add(-time.Minute)), ShouldBeNil)
+		item, err := catalog.GetActive(context.TODO(), "2")
+		So(err, ShouldBeNil)
+		So(item.Name, ShouldEqual, "Item2")
+	})
+	Convey("Typed views of pointer items", t, func() {
+		pointers := cacheStorage.NewCollection[*TestCatalogItem](getter, nil, "catalog")
+		item, err := pointers.Get(context.TODO(), "2", "1")
+		So(err, ShouldBeNil)
+		So(item, ShouldResemble, &TestCatalogItem{Id: "2", Name: "Item2"})
+		err = pointers.Put(context.TODO(), "3", "1", &TestCatalogItem{Id: "3"})
+		So(err, ShouldNotBeNil)
+		So(errors.Is(err, cacheStorage.ErrNotSupported), ShouldBeTrue)
+	})
+}
@@ -0,0 +1,130 @@
+package cacheStorage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+	"io/ioutil"
+	"sync"
+)
+
+var ErrUnknownCompressor = errors.New("Unknown compressor")
+
+// Compressor compresses encoded items. Like codecs, backends record its Name with every item it compressed and
+// decompress the item with the compressor registered under that name.
+type Compressor interface {
+	Name() string
+	Compress(data []byte) ([]byte, error)
+	Decompress(data []byte) ([]byte, error)
+}
+
+// Compression compresses the items whose encoding takes at least Threshold bytes with Compressor.
+type Compression struct {
+	Compressor Compressor
+	Threshold  int
+}
+
+type gzipCompressor struct{}
+
+func (gzipCompressor) Name() string {
+	return "gzip"
+}
+
+func (gzipCompressor) Compress(data []byte) ([]byte, error) {
+	var compressed bytes.Buffer
+	w := gzip.NewWriter(&compressed)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return compressed.Bytes(), nil
+}
+
+func (gzipCompressor) Decompress(data []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+// zstdCompressor shares a single encoder and decoder, whose EncodeAll and DecodeAll may be called concurrently.
+type zstdCompressor struct {
+	encoder *zstd.Encoder
+	decoder *zstd.Decoder
+}
+
+func newZstdCompressor() zstdCompressor {
+	encoder, err := zstd.NewWriter(nil)
+	if err != nil {
+		panic(err)
+	}
+	decoder, err := zstd.NewReader(nil)
+	if err != nil {
+		panic(err)
+	}
+	return zstdCompressor{encoder: encoder, decoder: decoder}
+}
+
+func (zstdCompressor) Name() string {
+	return "zstd"
+}
+
+func (z zstdCompressor) Compress(data []byte) ([]byte, error) {
+	return z.encoder.EncodeAll(data, nil), nil
+}
+
+func (z zstdCompressor) Decompress(data []byte) ([]byte, error) {
+	return z.decoder.DecodeAll(data, nil)
+}
+
+type snappyCompressor struct{}
+
+func (snappyCompressor) Name() string {
+	return "snappy"
+}
+
+func (snappyCompressor) Compress(data []byte) ([]byte, error) {
+	return snappy.Encode(nil, data), nil
+}
+
+func (snappyCompressor) Decompress(data []byte) ([]byte, error) {
+	return snappy.Decode(nil, data)
+}
+
+var GzipCompressor Compressor = gzipCompressor{}
+var ZstdCompressor Compressor = newZstdCompressor()
+var SnappyCompressor Compressor = snappyCompressor{}
+
+var compressors = struct {
+	mu     sync.RWMutex
+	byName map[string]Compressor
+}{byName: map[string]Compressor{
+	GzipCompressor.Name():   GzipCompressor,
+	ZstdCompressor.Name():   ZstdCompressor,
+	SnappyCompressor.Name(): SnappyCompressor,
+}}
+
+// RegisterCompressor makes compressor available for decompressing the items recorded with its name, replacing any
+// compressor registered under the same name. The gzip, zstd and snappy compressors are registered already.
+func RegisterCompressor(compressor Compressor) {
+	compressors.mu.Lock()
+	defer compressors.mu.Unlock()
+	compressors.byName[compressor.Name()] = compressor
+}
+
+func LookupCompressor(name string) (Compressor, error) {
+	compressors.mu.RLock()
+	defer compressors.mu.RUnlock()
+	compressor, ok := compressors.byName[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownCompressor, name)
+	}
+	return compressor, nil
+}
@@ -0,0 +1,120 @@
+package cacheStorage
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+var ErrUnknownKey = errors.New("Unknown encryption key")
+var ErrInvalidKey = errors.New("Invalid encryption key")
+
+/*
+KeyProvider hands out the AES keys items are encrypted with. Backends record the id of the key with every item they
+encrypted and decrypt the item with the key the provider returns for that id, so rotating to a new current key leaves
+the items encrypted before readable for as long as the provider still knows the old key. Key returns an error wrapping
+ErrUnknownKey for ids it does not know.
+*/
+type KeyProvider interface {
+	CurrentKey() (keyId string, key []byte, err error)
+	Key(keyId string) ([]byte, error)
+}
+
+// KeyRing is a KeyProvider holding its keys in memory. The key added last is the current one.
+type KeyRing struct {
+	mu      sync.RWMutex
+	current string
+	keys    map[string][]byte
+}
+
+func NewKeyRing() *KeyRing {
+	return &KeyRing{keys: make(map[string][]byte)}
+}
+
+// Add makes key, which must take 16, 24 or 32 bytes, the current key under keyId. The keys added before stay available
+// for decrypting.
+func (r *KeyRing) Add(keyId string, key []byte) error {
+	if keyId == "" {
+		return fmt.Errorf("%w: empty key id", ErrInvalidKey)
+	}
+	if _, err := aes.NewCipher(key); err != nil {
+		return fmt.Errorf("%w: %q: %v", ErrInvalidKey, keyId, err)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.keys[keyId] = append([]byte(nil), key...)
+	r.current = keyId
+	return nil
+}
+
+func (r *KeyRing) CurrentKey() (string, []byte, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.current == "" {
+		return "", nil, fmt.Errorf("%w: the key ring is empty", ErrUnknownKey)
+	}
+	return r.current, r.keys[r.current], nil
+}
+
+func (r *KeyRing) Key(keyId string) ([]byte, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	key, ok := r.keys[keyId]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownKey, keyId)
+	}
+	return key, nil
+}
+
+// encrypt seals data with AES-GCM under the current key of keys, prepending the random nonce it used.
+func encrypt(keys KeyProvider, data []byte) (keyId string, sealed []byte, err error) {
+	keyId, key, err := keys.CurrentKey()
+	if err != nil {
+		return "", nil, err
+	}
+	aead, err := newGCM(keyId, key)
+	if err != nil {
+		return "", nil, err
+	}
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(data)+aead.Overhead())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", nil, err
+	}
+	return keyId, aead.Seal(nonce, nonce, data, nil), nil
+}
+
+// decrypt opens what encrypt sealed under keyId.
+func decrypt(keys KeyProvider, keyId string, sealed []byte) ([]byte, error) {
+	if keys == nil {
+		return nil, fmt.Errorf("%w: %q, no key provider is configured", ErrUnknownKey, keyId)
+	}
+	key, err := keys.Key(keyId)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newGCM(keyId, key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, fmt.Errorf("item encrypted with key %q is truncated", keyId)
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	data, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, fmt.Errorf("decrypting with key %q: %w", keyId, err)
+	}
+	return data, nil
+}
+
+func newGCM(keyId string, key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %q: %v", ErrInvalidKey, keyId, err)
+	}
+	return cipher.NewGCM(block)
+}
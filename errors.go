@@ -0,0 +1,208 @@
+package cacheStorage
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"syscall"
+)
+
+var ErrNotFound = errors.New("Not found")
+var ErrInvalidDestType = errors.New("Invalid dest type")
+var ErrVerInUse = errors.New("Ver already holds items")
+var ErrSerialization = errors.New("Serialization failed")
+var ErrDuplicateKey = errors.New("Duplicate key")
+var ErrConnection = errors.New("Connection failed")
+var ErrLockTimeout = errors.New("Lock wait timed out")
+
+// ErrLockNotHeld is the error of using a lock that was released, or whose lease ran out, since it was taken.
+var ErrLockNotHeld = errors.New("Lock not held")
+
+// ErrNotSupported is the error of calling an optional operation the backend does not implement.
+var ErrNotSupported = errors.New("Not supported")
+
+// ErrConflict is the error of writes that lost a race with another writer, which may succeed when retried.
+var ErrConflict = errors.New("Conflict")
+
+// lockTimeoutError is ErrLockTimeout, and unwraps to why GetAndLockById stopped waiting.
+type lockTimeoutError struct {
+	collection string
+	id         string
+	cause      error
+}
+
+// NewLockTimeoutError returns the error of giving up waiting for the lock of item id of collection, or of the named lock
+// id when collection is empty, because of cause, the error of the context the locker was given most of the time.
+func NewLockTimeoutError(collection, id string, cause error) error {
+	return &lockTimeoutError{collection: collection, id: id, cause: cause}
+}
+
+func (e *lockTimeoutError) Error() string {
+	if e.collection == "" {
+		return fmt.Sprintf("%v: %v is locked by other owners: %v", ErrLockTimeout, e.id, e.cause)
+	}
+	return fmt.Sprintf("%v: item %v of collection %v is locked by another owner: %v", ErrLockTimeout, e.id, e.collection, e.cause)
+}
+
+func (e *lockTimeoutError) Is(target error) bool {
+	return target == ErrLockTimeout
+}
+
+func (e *lockTimeoutError) Unwrap() error {
+	return e.cause
+}
+
+// SerializationError reports every item of a batch that could not be encoded, by id, and is ErrSerialization.
+type SerializationError struct {
+	Collection string
+	Errs       map[string]error
+}
+
+// Ids returns the ids of the items that could not be encoded, sorted.
+func (e *SerializationError) Ids() []string {
+	ids := make([]string, 0, len(e.Errs))
+	for id := range e.Errs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func (e *SerializationError) Error() string {
+	ids := e.Ids()
+	reasons := make([]string, len(ids))
+	for i, id := range ids {
+		reasons[i] = fmt.Sprintf("%v: %v", id, e.Errs[id])
+	}
+	return fmt.Sprintf("%v: items %v of collection %v: %v", ErrSerialization, ids, e.Collection, strings.Join(reasons, "; "))
+}
+
+func (e *SerializationError) Unwrap() error {
+	return ErrSerialization
+}
+
+// joinedError is the first of errs, and also matches the rest of them for errors.Is and errors.As.
+type joinedError struct {
+	errs []error
+}
+
+// joinErrors returns err with the errors that followed it while handling it, leaving out the nil ones.
+func joinErrors(err error, more ...error) error {
+	joined := &joinedError{errs: []error{err}}
+	for _, e := range more {
+		if e != nil {
+			joined.errs = append(joined.errs, e)
+		}
+	}
+	if len(joined.errs) == 1 {
+		return err
+	}
+	return joined
+}
+
+func (e *joinedError) Error() string {
+	msgs := make([]string, len(e.errs))
+	for i, err := range e.errs {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func (e *joinedError) Unwrap() error {
+	return e.errs[0]
+}
+
+func (e *joinedError) Is(target error) bool {
+	for _, err := range e.errs[1:] {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *joinedError) As(target interface{}) bool {
+	for _, err := range e.errs[1:] {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+type cacheStorageError struct {
+	err error
+}
+
+func NewCacheStorageError(err error) *cacheStorageError {
+	return &cacheStorageError{err: err}
+}
+
+func (e cacheStorageError) Error() string {
+	return e.err.Error()
+}
+
+func (e cacheStorageError) Unwrap() error {
+	return e.err
+}
+
+func (e cacheStorageError) IsNotFound() bool {
+	return errors.Is(e.err, ErrNotFound)
+}
+
+func (e cacheStorageError) IsInvalidDestType() bool {
+	return errors.Is(e.err, ErrInvalidDestType)
+}
+
+func (e cacheStorageError) IsUnknownKey() bool {
+	return errors.Is(e.err, ErrUnknownKey)
+}
+
+func (e cacheStorageError) IsSerialization() bool {
+	return errors.Is(e.err, ErrSerialization)
+}
+
+func (e cacheStorageError) IsDuplicateKey() bool {
+	return errors.Is(e.err, ErrDuplicateKey)
+}
+
+func (e cacheStorageError) IsTimeout() bool {
+	var netErr net.Error
+	return errors.Is(e.err, context.DeadlineExceeded) || errors.Is(e.err, os.ErrDeadlineExceeded) ||
+		errors.As(e.err, &netErr) && netErr.Timeout()
+}
+
+func (e cacheStorageError) IsCanceled() bool {
+	return errors.Is(e.err, context.Canceled)
+}
+
+func (e cacheStorageError) IsConnection() bool {
+	var opErr *net.OpError
+	return errors.Is(e.err, ErrConnection) || errors.As(e.err, &opErr) ||
+		errors.Is(e.err, driver.ErrBadConn) || errors.Is(e.err, sql.ErrConnDone) ||
+		errors.Is(e.err, syscall.ECONNREFUSED) || errors.Is(e.err, syscall.ECONNRESET) || errors.Is(e.err, syscall.EPIPE)
+}
+
+func (e cacheStorageError) IsLockTimeout() bool {
+	return errors.Is(e.err, ErrLockTimeout)
+}
+
+func (e cacheStorageError) IsConflict() bool {
+	return errors.Is(e.err, ErrConflict) || errors.Is(e.err, ErrVerInUse) || errors.Is(e.err, ErrLockNotHeld) ||
+		errors.Is(e.err, ErrVersionAlreadyPublished) || errors.Is(e.err, ErrVersionActive)
+}
+
+// IsRetryable leaves out canceled operations, which their caller gave up on, and conflicts other than ErrConflict,
+// which stay as they are until someone changes the storage.
+func (e cacheStorageError) IsRetryable() bool {
+	if e.IsCanceled() {
+		return false
+	}
+	return e.IsTimeout() || e.IsConnection() || e.IsLockTimeout() || errors.Is(e.err, ErrConflict)
+}
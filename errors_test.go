@@ -0,0 +1,64 @@
+package cacheStorage_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/orchestd/cacheStorage"
+	. "github.com/smartystreets/goconvey/convey"
+	"net"
+	"syscall"
+	"testing"
+)
+
+func TestErrorClassification(t *testing.T) {
+	Convey("Errors are classified through the errors wrapping them", t, func() {
+		err := cacheStorage.NewCacheStorageError(fmt.Errorf("inserting: %w", cacheStorage.ErrDuplicateKey))
+		So(err.IsDuplicateKey(), ShouldBeTrue)
+		So(err.IsRetryable(), ShouldBeFalse)
+		So(errors.Is(err, cacheStorage.ErrDuplicateKey), ShouldBeTrue)
+	})
+	Convey("Deadlines are timeouts that may be retried", t, func() {
+		err := cacheStorage.NewCacheStorageError(context.DeadlineExceeded)
+		So(err.IsTimeout(), ShouldBeTrue)
+		So(err.IsCanceled(), ShouldBeFalse)
+		So(err.IsRetryable(), ShouldBeTrue)
+	})
+	Convey("Canceled operations are not retried", t, func() {
+		err := cacheStorage.NewCacheStorageError(cacheStorage.NewLockTimeoutError("catalog", "1", context.Canceled))
+		So(err.IsLockTimeout(), ShouldBeTrue)
+		So(err.IsCanceled(), ShouldBeTrue)
+		So(err.IsRetryable(), ShouldBeFalse)
+		So(err.Error(), ShouldContainSubstring, "item 1 of collection catalog")
+	})
+	Convey("Lock timeouts are timeouts when the deadline passed", t, func() {
+		err := cacheStorage.NewCacheStorageError(cacheStorage.NewLockTimeoutError("catalog", "1", context.DeadlineExceeded))
+		So(err.IsLockTimeout(), ShouldBeTrue)
+		So(err.IsTimeout(), ShouldBeTrue)
+		So(err.IsRetryable(), ShouldBeTrue)
+	})
+	Convey("Network failures are connection errors", t, func() {
+		err := cacheStorage.NewCacheStorageError(&net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED})
+		So(err.IsConnection(), ShouldBeTrue)
+		So(err.IsTimeout(), ShouldBeFalse)
+		So(err.IsRetryable(), ShouldBeTrue)
+		var opErr *net.OpError
+		So(errors.As(err, &opErr), ShouldBeTrue)
+	})
+	Convey("Only lost races are retryable conflicts", t, func() {
+		err := cacheStorage.NewCacheStorageError(cacheStorage.ErrConflict)
+		So(err.IsConflict(), ShouldBeTrue)
+		So(err.IsRetryable(), ShouldBeTrue)
+		err = cacheStorage.NewCacheStorageError(fmt.Errorf("%w: %q", cacheStorage.ErrVerInUse, "2"))
+		So(err.IsConflict(), ShouldBeTrue)
+		So(err.IsRetryable(), ShouldBeFalse)
+		err = cacheStorage.NewCacheStorageError(cacheStorage.ErrLockNotHeld)
+		So(err.IsConflict(), ShouldBeTrue)
+		So(err.IsRetryable(), ShouldBeFalse)
+	})
+	Convey("Not found errors are nothing else", t, func() {
+		err := cacheStorage.NewCacheStorageError(cacheStorage.ErrNotFound)
+		So(err.IsNotFound(), ShouldBeTrue)
+		So(err.IsConflict() || err.IsTimeout() || err.IsConnection() || err.IsRetryable(), ShouldBeFalse)
+	})
+}
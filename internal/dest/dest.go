@@ -0,0 +1,58 @@
+// Package dest holds the reflection helpers every backend uses to validate and fill the dest
+// argument of the cacheStorage getters, so they all accept and reject the same shapes.
+package dest
+
+import (
+	"fmt"
+	"reflect"
+)
+
+func Check(i interface{}, pointer, nonNil, isMap bool, isSlice bool) error {
+	value := reflect.ValueOf(i)
+	if pointer && value.Kind() != reflect.Ptr {
+		return fmt.Errorf("dest must be a pointer, not a value")
+	}
+	if nonNil && (!value.IsValid() || isNillable(value.Kind()) && value.IsNil()) {
+		return fmt.Errorf("dest must be a non nil pointer")
+	}
+	direct := reflect.Indirect(value)
+	if isMap && direct.Kind() != reflect.Map {
+		return fmt.Errorf("dest must be a map[string]yourCacheType")
+	}
+	if isSlice && (value.Kind() != reflect.Ptr || direct.Kind() != reflect.Slice) {
+		return fmt.Errorf("dest must be a Slice[]yourCacheType and not %v", direct.Kind())
+	}
+	return nil
+}
+
+func isNillable(k reflect.Kind) bool {
+	switch k {
+	case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Interface, reflect.Chan, reflect.Func:
+		return true
+	}
+	return false
+}
+
+// SetMapItem decodes a single item into a new value of dest's element type and stores it under id.
+// dest must already have passed Check as a map.
+func SetMapItem(dest interface{}, id string, decode func(interface{}) error) error {
+	destMap := reflect.Indirect(reflect.ValueOf(dest))
+	destItemP := reflect.New(destMap.Type().Elem())
+	if err := decode(destItemP.Interface()); err != nil {
+		return err
+	}
+	destMap.SetMapIndex(reflect.ValueOf(id), reflect.Indirect(destItemP))
+	return nil
+}
+
+// AppendSliceItem decodes a single item into a new value of dest's element type and appends it.
+// dest must already have passed Check as a slice.
+func AppendSliceItem(dest interface{}, decode func(interface{}) error) error {
+	destVal := reflect.ValueOf(dest).Elem()
+	destItemP := reflect.New(destVal.Type().Elem())
+	if err := decode(destItemP.Interface()); err != nil {
+		return err
+	}
+	destVal.Set(reflect.Append(destVal, reflect.Indirect(destItemP)))
+	return nil
+}
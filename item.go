@@ -0,0 +1,156 @@
+package cacheStorage
+
+import (
+	"encoding/base64"
+	"fmt"
+)
+
+/*
+EncodedItem is an item as backends store it, along with the names of the codec and compressor and the id of the key it
+takes to decode it.
+*/
+type EncodedItem struct {
+	Data []byte
+	// Codec is empty for items written before codecs were recorded, which are JSON.
+	Codec string
+	// Compression is empty for items that are not compressed.
+	Compression string
+	// KeyId is empty for items that are not encrypted.
+	KeyId string
+}
+
+/*
+EncodeItem encodes item with the codec of collection, compresses it when the collection's compression applies and
+encrypts it last when the collection is encrypted. Items the codec fails to encode are ErrSerialization.
+*/
+func (o StorageOptions) EncodeItem(collection string, item interface{}) (EncodedItem, error) {
+	codec := o.CodecFor(collection)
+	data, err := codec.Marshal(item)
+	if err != nil {
+		return EncodedItem{}, fmt.Errorf("%w: %q", ErrSerialization, err)
+	}
+	return o.encodeData(collection, codec, data)
+}
+
+// EncodeItems encodes the items of a batch for collection, failing with a *SerializationError naming every item that
+// could not be encoded rather than only the first.
+func (o StorageOptions) EncodeItems(collection string, items map[string]interface{}) (map[string]EncodedItem, error) {
+	codec := o.CodecFor(collection)
+	data := make(map[string][]byte, len(items))
+	failed := &SerializationError{Collection: collection}
+	for id, item := range items {
+		d, err := codec.Marshal(item)
+		if err != nil {
+			if failed.Errs == nil {
+				failed.Errs = make(map[string]error)
+			}
+			failed.Errs[id] = err
+			continue
+		}
+		data[id] = d
+	}
+	if failed.Errs != nil {
+		return nil, failed
+	}
+	encoded := make(map[string]EncodedItem, len(items))
+	for id, d := range data {
+		e, err := o.encodeData(collection, codec, d)
+		if err != nil {
+			return nil, err
+		}
+		encoded[id] = e
+	}
+	return encoded, nil
+}
+
+// encodeData compresses and encrypts the data codec encoded an item of collection into, as the collection says.
+func (o StorageOptions) encodeData(collection string, codec Codec, data []byte) (EncodedItem, error) {
+	encoded := EncodedItem{Data: data, Codec: codec.Name()}
+	var err error
+	if compression, ok := o.CompressionFor(collection); ok && len(data) >= compression.Threshold {
+		if encoded.Data, err = compression.Compressor.Compress(data); err != nil {
+			return EncodedItem{}, err
+		}
+		encoded.Compression = compression.Compressor.Name()
+	}
+	if keys, ok := o.EncryptionFor(collection); ok {
+		if encoded.KeyId, encoded.Data, err = encrypt(keys, encoded.Data); err != nil {
+			return EncodedItem{}, err
+		}
+	}
+	return encoded, nil
+}
+
+// DecodeItem decrypts encoded with the key it was encrypted with, if any, then decodes it into dest.
+func (o StorageOptions) DecodeItem(encoded EncodedItem, dest interface{}) error {
+	if encoded.KeyId != "" {
+		data, err := decrypt(o.Keys, encoded.KeyId, encoded.Data)
+		if err != nil {
+			return err
+		}
+		encoded.Data, encoded.KeyId = data, ""
+	}
+	return encoded.Decode(dest)
+}
+
+// Decode decodes an item that is not encrypted into dest; encrypted items take the keys DecodeItem has.
+func (e EncodedItem) Decode(dest interface{}) error {
+	if e.KeyId != "" {
+		_, err := decrypt(nil, e.KeyId, e.Data)
+		return err
+	}
+	data := e.Data
+	if e.Compression != "" {
+		compressor, err := LookupCompressor(e.Compression)
+		if err != nil {
+			return err
+		}
+		if data, err = compressor.Decompress(data); err != nil {
+			return err
+		}
+	}
+	codec, err := LookupCodec(e.Codec)
+	if err != nil {
+		return err
+	}
+	return codec.Unmarshal(data, dest)
+}
+
+// isText tells whether Data is text as it is, which only plain JSON is.
+func (e EncodedItem) isText() bool {
+	return (e.Codec == "" || e.Codec == JSONCodec.Name()) && e.Compression == "" && e.KeyId == ""
+}
+
+/*
+Text returns Data for backends that keep items as text. Plain JSON is kept as it is, so items stay readable, and
+anything else is base64 encoded.
+*/
+func (e EncodedItem) Text() string {
+	if e.isText() {
+		return string(e.Data)
+	}
+	return base64.StdEncoding.EncodeToString(e.Data)
+}
+
+// WithText returns e with the Data a backend kept as text, as Text returned it.
+func (e EncodedItem) WithText(text string) (EncodedItem, error) {
+	if e.isText() {
+		e.Data = []byte(text)
+		return e, nil
+	}
+	data, err := base64.StdEncoding.DecodeString(text)
+	if err != nil {
+		return EncodedItem{}, err
+	}
+	e.Data = data
+	return e, nil
+}
+
+// DecodeText decodes into dest the item a backend kept as text, recorded with the codec, compression and key of e.
+func (o StorageOptions) DecodeText(e EncodedItem, text string, dest interface{}) error {
+	encoded, err := e.WithText(text)
+	if err != nil {
+		return err
+	}
+	return o.DecodeItem(encoded, dest)
+}
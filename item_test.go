@@ -0,0 +1,134 @@
+package cacheStorage_test
+
+import (
+	"errors"
+	"github.com/orchestd/cacheStorage"
+	. "github.com/smartystreets/goconvey/convey"
+	"strings"
+	"testing"
+)
+
+func TestEncodedItem(t *testing.T) {
+	item := TestCatalogItem{Id: "1", Name: "Item1"}
+	Convey("JSON items are kept as they are", t, func() {
+		encoded, err := cacheStorage.NewStorageOptions().EncodeItem("catalog", item)
+		So(err, ShouldBeNil)
+		So(encoded.Codec, ShouldEqual, "json")
+		So(encoded.Text(), ShouldEqual, `{"Id":"1","Name":"Item1"}`)
+	})
+	Convey("Items of every codec decode with the codec they were recorded with", t, func() {
+		for _, codec := range []cacheStorage.Codec{cacheStorage.JSONCodec, cacheStorage.GobCodec, cacheStorage.MsgpackCodec, cacheStorage.BSONCodec} {
+			options := cacheStorage.NewStorageOptions(cacheStorage.WithCodec(codec))
+			encoded, err := options.EncodeItem("catalog", item)
+			So(err, ShouldBeNil)
+			var decoded TestCatalogItem
+			So(options.DecodeText(cacheStorage.EncodedItem{Codec: codec.Name()}, encoded.Text(), &decoded), ShouldBeNil)
+			So(decoded, ShouldResemble, item)
+		}
+	})
+	Convey("Items recorded without a codec are JSON", t, func() {
+		var decoded TestCatalogItem
+		So(cacheStorage.NewStorageOptions().DecodeText(cacheStorage.EncodedItem{}, `{"Id":"1","Name":"Item1"}`, &decoded), ShouldBeNil)
+		So(decoded, ShouldResemble, item)
+	})
+	Convey("Items recorded with an unknown codec", t, func() {
+		var decoded TestCatalogItem
+		err := cacheStorage.NewStorageOptions().DecodeText(cacheStorage.EncodedItem{Codec: "yaml"}, "SWQ6IDE=", &decoded)
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, cacheStorage.ErrUnknownCodec.Error())
+	})
+}
+
+func TestCompressedItem(t *testing.T) {
+	large := TestCatalogItem{Id: "1", Name: strings.Repeat("Item1", 100)}
+	small := TestCatalogItem{Id: "2", Name: "Item2"}
+	Convey("Items of every compressor decode with the compressor they were recorded with", t, func() {
+		for _, compressor := range []cacheStorage.Compressor{cacheStorage.GzipCompressor, cacheStorage.ZstdCompressor, cacheStorage.SnappyCompressor} {
+			options := cacheStorage.NewStorageOptions(cacheStorage.WithCompression(compressor, 0))
+			encoded, err := options.EncodeItem("catalog", large)
+			So(err, ShouldBeNil)
+			So(encoded.Compression, ShouldEqual, compressor.Name())
+			So(len(encoded.Data), ShouldBeLessThan, len(large.Name))
+			var decoded TestCatalogItem
+			So(options.DecodeText(cacheStorage.EncodedItem{Codec: encoded.Codec, Compression: encoded.Compression}, encoded.Text(), &decoded), ShouldBeNil)
+			So(decoded, ShouldResemble, large)
+		}
+	})
+	Convey("Only items reaching the threshold of their collection are compressed", t, func() {
+		options := cacheStorage.NewStorageOptions(
+			cacheStorage.WithCompression(cacheStorage.GzipCompressor, 100),
+			cacheStorage.WithCollectionCompression("stores", nil, 0),
+		)
+		encoded, err := options.EncodeItem("catalog", large)
+		So(err, ShouldBeNil)
+		So(encoded.Compression, ShouldEqual, "gzip")
+		encoded, err = options.EncodeItem("catalog", small)
+		So(err, ShouldBeNil)
+		So(encoded.Compression, ShouldBeEmpty)
+		So(encoded.Text(), ShouldEqual, `{"Id":"2","Name":"Item2"}`)
+		encoded, err = options.EncodeItem("stores", large)
+		So(err, ShouldBeNil)
+		So(encoded.Compression, ShouldBeEmpty)
+	})
+	Convey("Items recorded with an unknown compressor", t, func() {
+		var decoded TestCatalogItem
+		err := cacheStorage.NewStorageOptions().DecodeText(cacheStorage.EncodedItem{Codec: "json", Compression: "lz4"}, "AAAA", &decoded)
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, cacheStorage.ErrUnknownCompressor.Error())
+	})
+}
+
+func TestEncryptedItem(t *testing.T) {
+	item := TestCatalogItem{Id: "1", Name: "Item1"}
+	keys := cacheStorage.NewKeyRing()
+	if err := keys.Add("k1", []byte(strings.Repeat("1", 32))); err != nil {
+		t.Fatal(err)
+	}
+	options := cacheStorage.NewStorageOptions(cacheStorage.WithEncryption(keys, "customers"))
+	Convey("Only the items of encrypted collections are encrypted", t, func() {
+		encoded, err := options.EncodeItem("customers", item)
+		So(err, ShouldBeNil)
+		So(encoded.KeyId, ShouldEqual, "k1")
+		So(encoded.Text(), ShouldNotContainSubstring, "Item1")
+		var decoded TestCatalogItem
+		So(options.DecodeText(cacheStorage.EncodedItem{Codec: encoded.Codec, KeyId: encoded.KeyId}, encoded.Text(), &decoded), ShouldBeNil)
+		So(decoded, ShouldResemble, item)
+		encoded, err = options.EncodeItem("catalog", item)
+		So(err, ShouldBeNil)
+		So(encoded.KeyId, ShouldBeEmpty)
+	})
+	Convey("Items encrypted before a rotation decrypt with their own key", t, func() {
+		before, err := options.EncodeItem("customers", item)
+		So(err, ShouldBeNil)
+		So(keys.Add("k2", []byte(strings.Repeat("2", 32))), ShouldBeNil)
+		after, err := options.EncodeItem("customers", item)
+		So(err, ShouldBeNil)
+		So(after.KeyId, ShouldEqual, "k2")
+		for _, encoded := range []cacheStorage.EncodedItem{before, after} {
+			var decoded TestCatalogItem
+			So(options.DecodeItem(encoded, &decoded), ShouldBeNil)
+			So(decoded, ShouldResemble, item)
+		}
+	})
+	Convey("Items encrypted with an unknown key", t, func() {
+		encoded, err := options.EncodeItem("customers", item)
+		So(err, ShouldBeNil)
+		var decoded TestCatalogItem
+		err = cacheStorage.NewStorageOptions(cacheStorage.WithEncryption(cacheStorage.NewKeyRing())).DecodeItem(encoded, &decoded)
+		So(errors.Is(err, cacheStorage.ErrUnknownKey), ShouldBeTrue)
+		So(errors.Is(cacheStorage.NewStorageOptions().DecodeItem(encoded, &decoded), cacheStorage.ErrUnknownKey), ShouldBeTrue)
+		So(cacheStorage.NewCacheStorageError(err).IsUnknownKey(), ShouldBeTrue)
+	})
+	Convey("Tampered items do not decrypt", t, func() {
+		encoded, err := options.EncodeItem("customers", item)
+		So(err, ShouldBeNil)
+		encoded.Data[len(encoded.Data)-1] ^= 1
+		var decoded TestCatalogItem
+		err = options.DecodeItem(encoded, &decoded)
+		So(err, ShouldNotBeNil)
+		So(errors.Is(err, cacheStorage.ErrUnknownKey), ShouldBeFalse)
+	})
+	Convey("Keys must be AES keys", t, func() {
+		So(errors.Is(keys.Add("short", []byte("short")), cacheStorage.ErrInvalidKey), ShouldBeTrue)
+	})
+}
@@ -0,0 +1,194 @@
+package cacheStorage
+
+import (
+	"context"
+	crand "crypto/rand"
+	"encoding/hex"
+	"math/rand"
+	"time"
+)
+
+/*
+LockHandle proves holding the lock GetAndLockById took on an item, and is what ReleaseLockedById takes. Every
+GetAndLockById call locks for an owner of its own, so two callers never hold the same lock whatever their contexts hold.
+*/
+type LockHandle struct {
+	Collection string
+	Id         string
+	// Owner is the token of the holder, random for every lock taken.
+	Owner string
+	// Fence grows with every lock taken on the item for as long as the item is stored. Services the holder writes to can
+	// turn down the writes of a holder whose lease ran out and whose lock was taken over since, as its Fence is lower
+	// than the highest they saw.
+	Fence int64
+}
+
+// NewLockOwner returns a random owner token for a new lock.
+func NewLockOwner() string {
+	token := make([]byte, 16)
+	if _, err := crand.Read(token); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(token)
+}
+
+// LockRenewer renews the locks it took, CacheStorageSetter for the locks of GetAndLockById, and Locker and Semaphore
+// for theirs.
+type LockRenewer interface {
+	RenewLock(c context.Context, lock LockHandle) CacheStorageError
+}
+
+/*
+KeepLock renews lock every interval until c is done, for holders working on the item longer than a lease. Renewals
+failing with a retryable error are tried again at the next interval. The returned channel gets the error of the first
+renewal that failed otherwise, ErrLockNotHeld once the lock was lost, and is closed when KeepLock stops. Holders
+cancel c before releasing or updating the item, which KeepLock would otherwise report as a lost lock.
+*/
+func KeepLock(c context.Context, renewer LockRenewer, lock LockHandle, interval time.Duration) <-chan CacheStorageError {
+	lost := make(chan CacheStorageError, 1)
+	go func() {
+		defer close(lost)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-c.Done():
+				return
+			case <-ticker.C:
+			}
+			if err := renewer.RenewLock(c, lock); err != nil && !err.IsRetryable() {
+				if c.Err() == nil {
+					lost <- err
+				}
+				return
+			}
+		}
+	}()
+	return lost
+}
+
+// LockOptions configures how GetAndLockById locks items and waits for the items locked by other owners.
+type LockOptions struct {
+	// Lease is how long a lock holds before another owner may take the item over, 30 seconds by default.
+	Lease time.Duration
+	// MaxWait bounds how long GetAndLockById waits for an item locked by another owner. It waits for as long as its
+	// context allows when MaxWait is 0, the default.
+	MaxWait time.Duration
+	Backoff Backoff
+	// GuardUpdates makes Update and InsertOrUpdate fail with ErrLockNotHeld instead of overwriting an item whose lock
+	// is held and whose lease did not run out, the holder writing with UpdateAndRelease instead. Off by default, when
+	// they overwrite the item and release its lock whoever holds it.
+	GuardUpdates bool
+}
+
+/*
+Backoff spaces the attempts at locking an item another owner holds, doubling from Initial up to Max. Jitter is the
+share of every delay that is random, from 0 for none to 1, so owners waiting for the same item do not retry in step.
+*/
+type Backoff struct {
+	Initial time.Duration
+	Max     time.Duration
+	Jitter  float64
+}
+
+var DefaultLockOptions = LockOptions{
+	Lease:   30 * time.Second,
+	Backoff: Backoff{Initial: 50 * time.Millisecond, Max: time.Second, Jitter: 0.2},
+}
+
+// Delay returns how long to wait after the failed attempt numbered attempt, counting from 0. An Initial or Max that is
+// not positive is taken from DefaultLockOptions, so that a zero Backoff does not retry without pause.
+func (b Backoff) Delay(attempt int) time.Duration {
+	b = b.orDefaults()
+	delay := b.Initial
+	for i := 0; i < attempt && delay < b.Max; i++ {
+		delay *= 2
+	}
+	if delay > b.Max {
+		delay = b.Max
+	}
+	if b.Jitter > 0 {
+		delay -= time.Duration(b.Jitter * rand.Float64() * float64(delay))
+	}
+	return delay
+}
+
+// orDefaults takes the bounds that are not positive from DefaultLockOptions, raises Max to Initial and keeps Jitter
+// between 0 and 1.
+func (b Backoff) orDefaults() Backoff {
+	if b.Initial <= 0 {
+		b.Initial = DefaultLockOptions.Backoff.Initial
+	}
+	if b.Max <= 0 {
+		b.Max = DefaultLockOptions.Backoff.Max
+	}
+	if b.Max < b.Initial {
+		b.Max = b.Initial
+	}
+	if b.Jitter < 0 {
+		b.Jitter = 0
+	} else if b.Jitter > 1 {
+		b.Jitter = 1
+	}
+	return b
+}
+
+// orDefaults takes a Lease that is not positive from DefaultLockOptions, as a lock without a lease could be taken over
+// at once, and a negative MaxWait as 0.
+func (o LockOptions) orDefaults() LockOptions {
+	if o.Lease <= 0 {
+		o.Lease = DefaultLockOptions.Lease
+	}
+	if o.MaxWait < 0 {
+		o.MaxWait = 0
+	}
+	o.Backoff = o.Backoff.orDefaults()
+	return o
+}
+
+// LockWait paces the attempts of a single GetAndLockById call at an item locked by another owner.
+type LockWait struct {
+	options    LockOptions
+	collection string
+	id         string
+	deadline   time.Time
+	attempt    int
+}
+
+// NewLockWait starts waiting for item id of collection, whose MaxWait starts running now.
+func (o LockOptions) NewLockWait(collection, id string) *LockWait {
+	w := &LockWait{options: o, collection: collection, id: id}
+	if o.MaxWait > 0 {
+		w.deadline = time.Now().Add(o.MaxWait)
+	}
+	return w
+}
+
+/*
+Sleep waits out the backoff before the next attempt, or less when released fires, released being how backends that
+can tell an item was unlocked say so and nil for the others. It returns a lock timeout error instead once c is done or
+the wait has taken MaxWait.
+*/
+func (w *LockWait) Sleep(c context.Context, released <-chan struct{}) error {
+	delay := w.options.Backoff.Delay(w.attempt)
+	w.attempt++
+	expired := false
+	if !w.deadline.IsZero() {
+		if left := time.Until(w.deadline); left <= delay {
+			delay, expired = left, true
+		}
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-c.Done():
+		return NewLockTimeoutError(w.collection, w.id, c.Err())
+	case <-released:
+		return nil
+	case <-timer.C:
+		if expired {
+			return NewLockTimeoutError(w.collection, w.id, context.DeadlineExceeded)
+		}
+		return nil
+	}
+}
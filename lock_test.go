@@ -0,0 +1,74 @@
+package cacheStorage_test
+
+import (
+	"context"
+	"github.com/orchestd/cacheStorage"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	Convey("Delays double up to the max", t, func() {
+		backoff := cacheStorage.Backoff{Initial: 10 * time.Millisecond, Max: 50 * time.Millisecond}
+		So(backoff.Delay(0), ShouldEqual, 10*time.Millisecond)
+		So(backoff.Delay(1), ShouldEqual, 20*time.Millisecond)
+		So(backoff.Delay(2), ShouldEqual, 40*time.Millisecond)
+		So(backoff.Delay(3), ShouldEqual, 50*time.Millisecond)
+		So(backoff.Delay(100), ShouldEqual, 50*time.Millisecond)
+	})
+	Convey("Jitter takes up to its share off every delay", t, func() {
+		backoff := cacheStorage.Backoff{Initial: 100 * time.Millisecond, Max: 100 * time.Millisecond, Jitter: 0.5}
+		for i := 0; i < 100; i++ {
+			delay := backoff.Delay(i)
+			So(delay, ShouldBeBetweenOrEqual, 50*time.Millisecond, 100*time.Millisecond)
+		}
+	})
+	Convey("Bounds that are not positive fall back to the defaults", t, func() {
+		So(cacheStorage.Backoff{}.Delay(0), ShouldEqual, cacheStorage.DefaultLockOptions.Backoff.Initial)
+		So(cacheStorage.Backoff{}.Delay(100), ShouldEqual, cacheStorage.DefaultLockOptions.Backoff.Max)
+		backoff := cacheStorage.Backoff{Initial: 2 * time.Second, Max: -time.Second}
+		So(backoff.Delay(0), ShouldEqual, 2*time.Second)
+		So(backoff.Delay(100), ShouldEqual, 2*time.Second)
+	})
+}
+
+func TestLockOptions(t *testing.T) {
+	Convey("A lease that is not positive keeps the default", t, func() {
+		So(cacheStorage.NewStorageOptions(cacheStorage.WithLockLease(0)).Lock.Lease, ShouldEqual, cacheStorage.DefaultLockOptions.Lease)
+		So(cacheStorage.NewStorageOptions(cacheStorage.WithLockLease(-time.Second)).Lock.Lease, ShouldEqual, cacheStorage.DefaultLockOptions.Lease)
+		So(cacheStorage.NewStorageOptions(cacheStorage.WithLockLease(time.Second)).Lock.Lease, ShouldEqual, time.Second)
+	})
+	Convey("A negative max wait waits as long as the context allows", t, func() {
+		So(cacheStorage.NewStorageOptions(cacheStorage.WithLockWait(-time.Second)).Lock.MaxWait, ShouldEqual, 0)
+	})
+	Convey("A backoff out of range falls back to the defaults", t, func() {
+		backoff := cacheStorage.NewStorageOptions(cacheStorage.WithLockBackoff(0, -time.Second, 2)).Lock.Backoff
+		So(backoff, ShouldResemble, cacheStorage.Backoff{
+			Initial: cacheStorage.DefaultLockOptions.Backoff.Initial,
+			Max:     cacheStorage.DefaultLockOptions.Backoff.Max,
+			Jitter:  1,
+		})
+	})
+}
+
+func TestLockWait(t *testing.T) {
+	options := cacheStorage.LockOptions{MaxWait: 50 * time.Millisecond, Backoff: cacheStorage.Backoff{Initial: 20 * time.Millisecond, Max: 20 * time.Millisecond}}
+	Convey("Waiting stops once the max wait is spent", t, func() {
+		wait := options.NewLockWait("catalog", "1")
+		started := time.Now()
+		var err error
+		for err == nil {
+			err = wait.Sleep(context.Background(), nil)
+		}
+		So(cacheStorage.NewCacheStorageError(err).IsLockTimeout(), ShouldBeTrue)
+		So(time.Since(started), ShouldBeBetween, 40*time.Millisecond, time.Second)
+	})
+	Convey("Releases cut the wait short", t, func() {
+		released := make(chan struct{}, 1)
+		released <- struct{}{}
+		started := time.Now()
+		So(cacheStorage.LockOptions{Backoff: cacheStorage.Backoff{Initial: time.Hour, Max: time.Hour}}.NewLockWait("catalog", "1").Sleep(context.Background(), released), ShouldBeNil)
+		So(time.Since(started), ShouldBeLessThan, time.Second)
+	})
+}
@@ -0,0 +1,117 @@
+package cacheStorage
+
+import (
+	"context"
+	"fmt"
+)
+
+/*
+Leases keeps the named locks of Locker and Semaphore, apart from the cache items. A name has a number of slots, each
+held by at most one owner at a time for the lease of the storage's LockOptions, and each counting the leases taken on it
+in a fence of its own. Every backend provides Leases through the Locker its CacheStorage returns.
+*/
+type Leases interface {
+	// AcquireLease takes one of the slots of name for owner unless every slot is held by an unexpired lease, and returns
+	// the fence of the slot it took, or 0 when it took none.
+	AcquireLease(c context.Context, name string, slots int, owner string) (int64, CacheStorageError)
+	// ReleaseLease frees the slot of name held by owner, doing nothing when owner holds none.
+	ReleaseLease(c context.Context, name string, slots int, owner string) CacheStorageError
+	// RenewLease extends the lease of owner on a slot of name by a whole lease from now. It fails with ErrLockNotHeld
+	// once owner released the slot or its lease ran out.
+	RenewLease(c context.Context, name string, slots int, owner string) CacheStorageError
+}
+
+/*
+Locker takes named locks on resources that are not cache items, with the same leases, waits and fences GetAndLockById
+has. The handles it returns name the resource in Id and leave Collection empty.
+*/
+type Locker struct {
+	leases  Leases
+	options LockOptions
+}
+
+// NewLocker returns a Locker keeping its locks in leases, which lease them for options.Lease, and waiting for held
+// locks as options says.
+func NewLocker(leases Leases, options LockOptions) *Locker {
+	return &Locker{leases: leases, options: options}
+}
+
+// Lock takes the lock on name, waiting for it while another owner holds it.
+func (l *Locker) Lock(c context.Context, name string) (LockHandle, CacheStorageError) {
+	return l.acquire(c, name, 1)
+}
+
+// TryLock takes the lock on name if no one holds it, and reports whether it did without waiting.
+func (l *Locker) TryLock(c context.Context, name string) (LockHandle, bool, CacheStorageError) {
+	return l.tryAcquire(c, name, 1)
+}
+
+// Unlock releases lock, doing nothing when it was released already or taken over by another owner.
+func (l *Locker) Unlock(c context.Context, lock LockHandle) CacheStorageError {
+	return l.leases.ReleaseLease(c, lock.Id, 1, lock.Owner)
+}
+
+// RenewLock extends the lease of lock as CacheStorageSetter.RenewLock does, so KeepLock can keep it.
+func (l *Locker) RenewLock(c context.Context, lock LockHandle) CacheStorageError {
+	return l.leases.RenewLease(c, lock.Id, 1, lock.Owner)
+}
+
+// Semaphore returns the semaphore letting up to n owners hold name at once. Every Semaphore of the same name must take
+// the same n.
+func (l *Locker) Semaphore(name string, n int) *Semaphore {
+	return &Semaphore{locker: l, name: name, n: n}
+}
+
+func (l *Locker) acquire(c context.Context, name string, slots int) (LockHandle, CacheStorageError) {
+	wait := l.options.NewLockWait("", name)
+	for {
+		lock, acquired, err := l.tryAcquire(c, name, slots)
+		if err != nil || acquired {
+			return lock, err
+		}
+		if err := wait.Sleep(c, nil); err != nil {
+			return LockHandle{}, NewCacheStorageError(err)
+		}
+	}
+}
+
+func (l *Locker) tryAcquire(c context.Context, name string, slots int) (LockHandle, bool, CacheStorageError) {
+	if slots < 1 {
+		return LockHandle{}, false, NewCacheStorageError(fmt.Errorf("semaphore %v must have at least one slot, not %v", name, slots))
+	}
+	lock := LockHandle{Id: name, Owner: NewLockOwner()}
+	fence, err := l.leases.AcquireLease(c, name, slots, lock.Owner)
+	if err != nil || fence == 0 {
+		return LockHandle{}, false, err
+	}
+	lock.Fence = fence
+	return lock, true, nil
+}
+
+// Semaphore lets up to n owners hold a name at once. Each holder has a handle of its own, whose Fence counts the leases
+// taken on the slot it holds.
+type Semaphore struct {
+	locker *Locker
+	name   string
+	n      int
+}
+
+// Acquire takes a slot of the semaphore, waiting for one while n other owners hold them all.
+func (s *Semaphore) Acquire(c context.Context) (LockHandle, CacheStorageError) {
+	return s.locker.acquire(c, s.name, s.n)
+}
+
+// TryAcquire takes a slot of the semaphore if one is free, and reports whether it did without waiting.
+func (s *Semaphore) TryAcquire(c context.Context) (LockHandle, bool, CacheStorageError) {
+	return s.locker.tryAcquire(c, s.name, s.n)
+}
+
+// Release frees the slot lock holds, doing nothing when its lease ran out and another owner took it over.
+func (s *Semaphore) Release(c context.Context, lock LockHandle) CacheStorageError {
+	return s.locker.leases.ReleaseLease(c, s.name, s.n, lock.Owner)
+}
+
+// RenewLock extends the lease of lock, so KeepLock can keep it.
+func (s *Semaphore) RenewLock(c context.Context, lock LockHandle) CacheStorageError {
+	return s.locker.leases.RenewLease(c, s.name, s.n, lock.Owner)
+}
@@ -0,0 +1,56 @@
+package memory
+
+import (
+	"context"
+	"github.com/orchestd/cacheStorage"
+	"sync"
+)
+
+type memoryCacheStorage struct {
+	mu          sync.RWMutex
+	collections map[string]*collection
+	seq         uint64
+	leases      map[string][]*leaseSlot
+	options     cacheStorage.StorageOptions
+}
+
+// NewMemoryCacheStorage returns an in-process CacheStorage. Nothing is persisted, so it is meant for tests and
+// single node deployments; Connect ignores the host and credentials.
+func NewMemoryCacheStorage(options ...cacheStorage.StorageOption) cacheStorage.CacheStorage {
+	return &memoryCacheStorage{options: cacheStorage.NewStorageOptions(options...)}
+}
+
+func (s *memoryCacheStorage) Connect(c context.Context, host, userName, userPw, database string) error {
+	return nil
+}
+
+func (s *memoryCacheStorage) Close(c context.Context) error {
+	return nil
+}
+
+func (s *memoryCacheStorage) GetCacheStorageClient() (cacheStorage.CacheStorageGetter, cacheStorage.CacheStorageSetter) {
+	client := memoryClient{storage: s}
+	return client, client
+}
+
+func (s *memoryCacheStorage) GetLocker() *cacheStorage.Locker {
+	return cacheStorage.NewLocker(memoryLeases{storage: s}, s.options.Lock)
+}
+
+// collection must be called with s.mu held, for writing when create is true.
+func (s *memoryCacheStorage) collection(name string, create bool) *collection {
+	coll, ok := s.collections[name]
+	if !ok && create {
+		if s.collections == nil {
+			s.collections = make(map[string]*collection)
+		}
+		coll = &collection{vers: make(map[string]map[string][]*document)}
+		s.collections[name] = coll
+	}
+	return coll
+}
+
+func (s *memoryCacheStorage) nextSeq() uint64 {
+	s.seq++
+	return s.seq
+}
@@ -0,0 +1,433 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	. "github.com/orchestd/cacheStorage"
+	"github.com/orchestd/cacheStorage/internal/dest"
+	"sort"
+	"time"
+)
+
+const cacheVersionsCollectionName = "cacheVersions"
+
+type lock struct {
+	lockedAt time.Time
+	lockedBy string
+}
+
+type document struct {
+	seq    uint64
+	id     string
+	ver    string
+	item   EncodedItem
+	locked *lock
+	// fence counts the locks taken on the document, and outlives them.
+	fence int64
+}
+
+// collection keeps its documents by ver and then by id. Like a mongo collection without a unique index, the same
+// id+ver may hold more than one document; single item operations act on the first one inserted.
+type collection struct {
+	vers map[string]map[string][]*document
+}
+
+func (coll *collection) docs(id, ver string) []*document {
+	if coll == nil {
+		return nil
+	}
+	return coll.vers[ver][id]
+}
+
+// firstById returns the oldest document with the given id in any version, the same one FindOneAndUpdate by id would.
+func (coll *collection) firstById(id string, match func(*document) bool) *document {
+	if coll == nil {
+		return nil
+	}
+	var first *document
+	for _, ids := range coll.vers {
+		for _, doc := range ids[id] {
+			if match(doc) && (first == nil || doc.seq < first.seq) {
+				first = doc
+			}
+		}
+	}
+	return first
+}
+
+type memoryClient struct {
+	storage *memoryCacheStorage
+}
+
+// decode returns the func decoding item into its dest, with the keys of the storage when item is encrypted.
+func (m memoryClient) decode(item EncodedItem) func(interface{}) error {
+	return func(i interface{}) error {
+		return m.storage.options.DecodeItem(item, i)
+	}
+}
+
+func (m memoryClient) GetLatestVersions(c context.Context) ([]CacheVersion, CacheStorageError) {
+	cacheVersions := make(map[string]CacheVersion)
+	var versions []CacheVersion
+	err := m.GetAll(c, cacheVersionsCollectionName, "1", cacheVersions)
+	if err != nil {
+		return versions, err
+	}
+	for i := range cacheVersions {
+		versions = append(versions, cacheVersions[i])
+	}
+	return versions, nil
+}
+
+func (m memoryClient) GetLatestCollectionVersion(c context.Context, collection string) (CacheVersion, CacheStorageError) {
+	cacheVersion := CacheVersion{}
+	err := m.GetById(c, cacheVersionsCollectionName, collection, "1", &cacheVersion)
+	if err != nil {
+		return cacheVersion, err
+	}
+	return cacheVersion, nil
+}
+
+func (m memoryClient) GetStoredVersions(c context.Context, collectionName string) ([]string, CacheStorageError) {
+	m.storage.mu.RLock()
+	defer m.storage.mu.RUnlock()
+	var vers []string
+	if coll := m.storage.collection(collectionName, false); coll != nil {
+		for ver, ids := range coll.vers {
+			if len(ids) > 0 {
+				vers = append(vers, ver)
+			}
+		}
+	}
+	sort.Strings(vers)
+	return vers, nil
+}
+
+func (m memoryClient) GetById(ctx context.Context, collectionName string, id string, ver string, dst interface{}) CacheStorageError {
+	err := dest.Check(dst, true, true, false, false)
+	if err != nil {
+		return NewCacheStorageError(fmt.Errorf("%w: %q", ErrInvalidDestType, err))
+	}
+	m.storage.mu.RLock()
+	docs := m.storage.collection(collectionName, false).docs(id, ver)
+	var item EncodedItem
+	if len(docs) > 0 {
+		item = docs[0].item
+	}
+	m.storage.mu.RUnlock()
+	if item.Data == nil {
+		err := fmt.Errorf("element with id: %v not found in collection %v by version %v", id, collectionName, ver)
+		return NewCacheStorageError(fmt.Errorf("%w: %q", ErrNotFound, err))
+	}
+	if err := m.decode(item)(dst); err != nil {
+		return NewCacheStorageError(err)
+	}
+	return nil
+}
+
+func (m memoryClient) getMany(ctx context.Context, collectionName string, filterByIds []string, ver string, dst interface{}) CacheStorageError {
+	err := dest.Check(dst, false, true, true, false)
+	if err != nil {
+		return NewCacheStorageError(fmt.Errorf("%w: %q", ErrInvalidDestType, err))
+	}
+	type found struct {
+		id      string
+		encoded EncodedItem
+	}
+	var items []found
+	m.storage.mu.RLock()
+	coll := m.storage.collection(collectionName, false)
+	if len(filterByIds) > 0 {
+		for _, id := range filterByIds {
+			for _, doc := range coll.docs(id, ver) {
+				items = append(items, found{id: id, encoded: doc.item})
+			}
+		}
+	} else if coll != nil {
+		for id, docs := range coll.vers[ver] {
+			for _, doc := range docs {
+				items = append(items, found{id: id, encoded: doc.item})
+			}
+		}
+	}
+	m.storage.mu.RUnlock()
+
+	foundElementIds := make(map[string]bool)
+	for _, item := range items {
+		if err := dest.SetMapItem(dst, item.id, m.decode(item.encoded)); err != nil {
+			return NewCacheStorageError(err)
+		}
+		foundElementIds[item.id] = true
+	}
+	if len(foundElementIds) < len(filterByIds) {
+		var notFoundElements []string
+		for _, id := range filterByIds {
+			if _, ok := foundElementIds[id]; !ok {
+				notFoundElements = append(notFoundElements, id)
+			}
+		}
+		// len == 0 meaning the func got ids with duplicates
+		if len(notFoundElements) > 0 {
+			err := fmt.Errorf("elements with id: %v not found in collection %v by version %v", notFoundElements, collectionName, ver)
+			return NewCacheStorageError(fmt.Errorf("%w: %q", ErrNotFound, err))
+		}
+	}
+	return nil
+}
+
+func (m memoryClient) GetManyByIds(ctx context.Context, collectionName string, ids []string, ver string, dst interface{}) CacheStorageError {
+	if len(ids) == 0 {
+		return nil
+	}
+	return m.getMany(ctx, collectionName, ids, ver, dst)
+}
+
+func (m memoryClient) GetArrayBySingleId(ctx context.Context, collectionName string, id string, ver string, dst interface{}) CacheStorageError {
+	err := dest.Check(dst, false, true, false, true)
+	if err != nil {
+		return NewCacheStorageError(fmt.Errorf("%w: %q", ErrInvalidDestType, err))
+	}
+	var items []EncodedItem
+	m.storage.mu.RLock()
+	for _, doc := range m.storage.collection(collectionName, false).docs(id, ver) {
+		items = append(items, doc.item)
+	}
+	m.storage.mu.RUnlock()
+	for _, item := range items {
+		if err := dest.AppendSliceItem(dst, m.decode(item)); err != nil {
+			return NewCacheStorageError(err)
+		}
+	}
+	return nil
+}
+
+func (m memoryClient) GetAll(ctx context.Context, collectionName string, ver string, dst interface{}) CacheStorageError {
+	return m.getMany(ctx, collectionName, nil, ver, dst)
+}
+
+// insert must be called with m.storage.mu held for writing.
+func (m memoryClient) insert(collectionName string, id string, ver string, item EncodedItem) {
+	coll := m.storage.collection(collectionName, true)
+	ids, ok := coll.vers[ver]
+	if !ok {
+		ids = make(map[string][]*document)
+		coll.vers[ver] = ids
+	}
+	ids[id] = append(ids[id], &document{seq: m.storage.nextSeq(), id: id, ver: ver, item: item})
+}
+
+func (m memoryClient) Insert(ctx context.Context, collectionName string, id string, ver string, item interface{}) CacheStorageError {
+	encoded, err := m.storage.options.EncodeItem(collectionName, item)
+	if err != nil {
+		return NewCacheStorageError(err)
+	}
+	m.storage.mu.Lock()
+	defer m.storage.mu.Unlock()
+	m.insert(collectionName, id, ver, encoded)
+	return nil
+}
+
+func (m memoryClient) InsertMany(ctx context.Context, collectionName string, ver string, items map[string]interface{}) CacheStorageError {
+	encoded, err := m.storage.options.EncodeItems(collectionName, items)
+	if err != nil {
+		return NewCacheStorageError(err)
+	}
+	m.storage.mu.Lock()
+	defer m.storage.mu.Unlock()
+	for id, item := range encoded {
+		m.insert(collectionName, id, ver, item)
+	}
+	return nil
+}
+
+func (m memoryClient) InsertOrUpdate(ctx context.Context, collectionName string, id string, ver string, item interface{}) CacheStorageError {
+	encoded, err := m.storage.options.EncodeItem(collectionName, item)
+	if err != nil {
+		return NewCacheStorageError(err)
+	}
+	m.storage.mu.Lock()
+	defer m.storage.mu.Unlock()
+	if docs := m.storage.collection(collectionName, false).docs(id, ver); len(docs) > 0 {
+		if m.guarded(docs[0]) {
+			return NewCacheStorageError(fmt.Errorf("%w: item %v of collection %v is locked by another owner", ErrLockNotHeld, id, collectionName))
+		}
+		docs[0].item, docs[0].locked = encoded, nil
+	} else {
+		m.insert(collectionName, id, ver, encoded)
+	}
+	return nil
+}
+
+func (m memoryClient) Update(ctx context.Context, collectionName string, id string, ver string, item interface{}) CacheStorageError {
+	encoded, err := m.storage.options.EncodeItem(collectionName, item)
+	if err != nil {
+		return NewCacheStorageError(err)
+	}
+	m.storage.mu.Lock()
+	defer m.storage.mu.Unlock()
+	if docs := m.storage.collection(collectionName, false).docs(id, ver); len(docs) > 0 {
+		if m.guarded(docs[0]) {
+			return NewCacheStorageError(fmt.Errorf("%w: item %v of collection %v is locked by another owner", ErrLockNotHeld, id, collectionName))
+		}
+		docs[0].item, docs[0].locked = encoded, nil
+	}
+	return nil
+}
+
+// guarded tells whether doc holds a lock that Update must not overwrite, see LockOptions.GuardUpdates.
+func (m memoryClient) guarded(doc *document) bool {
+	return m.storage.options.Lock.GuardUpdates && doc.locked != nil && time.Since(doc.locked.lockedAt) <= m.storage.options.Lock.Lease
+}
+
+func (m memoryClient) Remove(ctx context.Context, collectionName string, id string, ver string) CacheStorageError {
+	m.storage.mu.Lock()
+	defer m.storage.mu.Unlock()
+	coll := m.storage.collection(collectionName, false)
+	if docs := coll.docs(id, ver); len(docs) > 1 {
+		coll.vers[ver][id] = docs[1:]
+	} else if len(docs) == 1 {
+		delete(coll.vers[ver], id)
+	}
+	return nil
+}
+
+func (m memoryClient) RemoveAll(ctx context.Context, collectionName string, ver string) CacheStorageError {
+	m.storage.mu.Lock()
+	defer m.storage.mu.Unlock()
+	if coll := m.storage.collection(collectionName, false); coll != nil {
+		delete(coll.vers, ver)
+	}
+	return nil
+}
+
+func (m memoryClient) GetAndLockById(c context.Context, collectionName string, id string, dst interface{}) (LockHandle, CacheStorageError) {
+	handle := LockHandle{Collection: collectionName, Id: id, Owner: NewLockOwner()}
+	wait := m.storage.options.Lock.NewLockWait(collectionName, id)
+	for {
+		m.storage.mu.Lock()
+		doc := m.storage.collection(collectionName, false).firstById(id, func(*document) bool { return true })
+		if doc == nil {
+			m.storage.mu.Unlock()
+			err := fmt.Errorf("element with id: %v not found in collection %v", id, collectionName)
+			return LockHandle{}, NewCacheStorageError(fmt.Errorf("%w: %q", ErrNotFound, err))
+		}
+		now := time.Now()
+		locked := doc.locked == nil || now.Sub(doc.locked.lockedAt) > m.storage.options.Lock.Lease
+		if locked {
+			doc.fence++
+			doc.locked = &lock{lockedAt: now, lockedBy: handle.Owner}
+			handle.Fence = doc.fence
+		}
+		item := doc.item
+		m.storage.mu.Unlock()
+
+		if locked {
+			if err := m.decode(item)(dst); err != nil {
+				return LockHandle{}, NewCacheStorageError(err)
+			}
+			return handle, nil
+		}
+		if err := wait.Sleep(c, nil); err != nil {
+			return LockHandle{}, NewCacheStorageError(err)
+		}
+	}
+}
+
+/*
+ReleaseLockedById in most cases will do nothing, cause UpdateAndRelease replaces the item without a lock and
+therefore "automatically releases" the item a specific session locked
+*/
+func (m memoryClient) ReleaseLockedById(c context.Context, lock LockHandle) CacheStorageError {
+	m.storage.mu.Lock()
+	defer m.storage.mu.Unlock()
+	doc := m.storage.collection(lock.Collection, false).firstById(lock.Id, func(doc *document) bool {
+		return doc.locked != nil && doc.locked.lockedBy == lock.Owner
+	})
+	if doc != nil {
+		doc.locked = nil
+	}
+	return nil
+}
+
+func (m memoryClient) UpdateAndRelease(c context.Context, lock LockHandle, item interface{}) CacheStorageError {
+	encoded, err := m.storage.options.EncodeItem(lock.Collection, item)
+	if err != nil {
+		return NewCacheStorageError(err)
+	}
+	m.storage.mu.Lock()
+	defer m.storage.mu.Unlock()
+	now := time.Now()
+	doc := m.storage.collection(lock.Collection, false).firstById(lock.Id, func(doc *document) bool {
+		return doc.locked != nil && doc.locked.lockedBy == lock.Owner && now.Sub(doc.locked.lockedAt) <= m.storage.options.Lock.Lease
+	})
+	if doc == nil {
+		return NewCacheStorageError(fmt.Errorf("%w: item %v of collection %v", ErrLockNotHeld, lock.Id, lock.Collection))
+	}
+	doc.item, doc.locked = encoded, nil
+	return nil
+}
+
+func (m memoryClient) RenewLock(c context.Context, lock LockHandle) CacheStorageError {
+	m.storage.mu.Lock()
+	defer m.storage.mu.Unlock()
+	now := time.Now()
+	doc := m.storage.collection(lock.Collection, false).firstById(lock.Id, func(doc *document) bool {
+		return doc.locked != nil && doc.locked.lockedBy == lock.Owner && now.Sub(doc.locked.lockedAt) <= m.storage.options.Lock.Lease
+	})
+	if doc == nil {
+		return NewCacheStorageError(fmt.Errorf("%w: item %v of collection %v", ErrLockNotHeld, lock.Id, lock.Collection))
+	}
+	doc.locked.lockedAt = now
+	return nil
+}
+
+func (m memoryClient) UpdateCacheVersion(c context.Context, collection string, update func(cacheVersion *CacheVersion) error) CacheStorageError {
+	m.storage.mu.Lock()
+	defer m.storage.mu.Unlock()
+	cacheVersion := CacheVersion{CollectionName: collection}
+	docs := m.storage.collection(cacheVersionsCollectionName, false).docs(collection, "1")
+	if len(docs) > 0 {
+		if err := m.decode(docs[0].item)(&cacheVersion); err != nil {
+			return NewCacheStorageError(err)
+		}
+	}
+	if err := update(&cacheVersion); err != nil {
+		return NewCacheStorageError(err)
+	}
+	encoded, err := m.storage.options.EncodeItem(cacheVersionsCollectionName, cacheVersion)
+	if err != nil {
+		return NewCacheStorageError(err)
+	}
+	if len(docs) > 0 {
+		docs[0].item = encoded
+	} else {
+		m.insert(cacheVersionsCollectionName, collection, "1", encoded)
+	}
+	return nil
+}
+
+func (m memoryClient) MoveVersion(c context.Context, collectionName string, fromVer string, toVer string) (int, CacheStorageError) {
+	m.storage.mu.Lock()
+	defer m.storage.mu.Unlock()
+	coll := m.storage.collection(collectionName, false)
+	if coll == nil {
+		return 0, nil
+	}
+	if len(coll.vers[toVer]) > 0 {
+		err := fmt.Errorf("ver %v of collection %v", toVer, collectionName)
+		return 0, NewCacheStorageError(fmt.Errorf("%w: %q", ErrVerInUse, err))
+	}
+	ids := coll.vers[fromVer]
+	delete(coll.vers, fromVer)
+	moved := 0
+	for _, docs := range ids {
+		for _, doc := range docs {
+			doc.ver = toVer
+			moved++
+		}
+	}
+	if len(ids) > 0 {
+		coll.vers[toVer] = ids
+	}
+	return moved, nil
+}
@@ -0,0 +1,18 @@
+package memory
+
+import (
+	"context"
+	"github.com/orchestd/cacheStorage"
+	"github.com/orchestd/cacheStorage/cacheStoragetest"
+	"testing"
+)
+
+func TestConformance(t *testing.T) {
+	cacheStoragetest.RunConformance(t, func(t *testing.T, options ...cacheStorage.StorageOption) cacheStorage.CacheStorage {
+		cache := NewMemoryCacheStorage(options...)
+		if err := cache.Connect(context.TODO(), "", "", "", "test"); err != nil {
+			t.Fatal(err)
+		}
+		return cache
+	})
+}
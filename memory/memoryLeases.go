@@ -0,0 +1,70 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	. "github.com/orchestd/cacheStorage"
+	"time"
+)
+
+// leaseSlot is one of the slots of a named lock, held by owner until expiresAt.
+type leaseSlot struct {
+	owner     string
+	expiresAt time.Time
+	fence     int64
+}
+
+type memoryLeases struct {
+	storage *memoryCacheStorage
+}
+
+// slots must be called with s.mu held for writing.
+func (m memoryLeases) slots(name string, n int) []*leaseSlot {
+	if m.storage.leases == nil {
+		m.storage.leases = make(map[string][]*leaseSlot)
+	}
+	slots := m.storage.leases[name]
+	for len(slots) < n {
+		slots = append(slots, &leaseSlot{})
+	}
+	m.storage.leases[name] = slots
+	return slots[:n]
+}
+
+func (m memoryLeases) AcquireLease(c context.Context, name string, slots int, owner string) (int64, CacheStorageError) {
+	m.storage.mu.Lock()
+	defer m.storage.mu.Unlock()
+	now := time.Now()
+	for _, s := range m.slots(name, slots) {
+		if s.owner == "" || now.After(s.expiresAt) {
+			s.owner, s.expiresAt = owner, now.Add(m.storage.options.Lock.Lease)
+			s.fence++
+			return s.fence, nil
+		}
+	}
+	return 0, nil
+}
+
+func (m memoryLeases) ReleaseLease(c context.Context, name string, slots int, owner string) CacheStorageError {
+	m.storage.mu.Lock()
+	defer m.storage.mu.Unlock()
+	for _, s := range m.slots(name, slots) {
+		if s.owner == owner {
+			s.owner = ""
+		}
+	}
+	return nil
+}
+
+func (m memoryLeases) RenewLease(c context.Context, name string, slots int, owner string) CacheStorageError {
+	m.storage.mu.Lock()
+	defer m.storage.mu.Unlock()
+	now := time.Now()
+	for _, s := range m.slots(name, slots) {
+		if s.owner == owner && !now.After(s.expiresAt) {
+			s.expiresAt = now.Add(m.storage.options.Lock.Lease)
+			return nil
+		}
+	}
+	return NewCacheStorageError(fmt.Errorf("%w: %v", ErrLockNotHeld, name))
+}
@@ -0,0 +1,207 @@
+package localcache
+
+import (
+	"context"
+	"github.com/orchestd/cacheStorage"
+	. "github.com/orchestd/cacheStorage"
+	"reflect"
+	"time"
+)
+
+const defaultMaxItems = 10000
+const defaultLatestTTL = 5 * time.Second
+const defaultVersionTTL = 5 * time.Minute
+
+const (
+	itemOp              = "item"
+	allOp               = "all"
+	arrayOp             = "array"
+	versionsOp          = "versions"
+	collectionVersionOp = "collectionVersion"
+)
+
+type LocalCacheConfiguration struct {
+	// MaxItems bounds the number of cached entries, a whole GetAll result counting as a single entry.
+	MaxItems int
+	// LatestTTL is how long reads of the Latest version and of the cache versions are served from memory.
+	LatestTTL time.Duration
+	// VersionTTL is how long reads of any other version are served from memory, bounding how long an item updated or
+	// removed in place stays stale.
+	VersionTTL time.Duration
+}
+
+type localCacheGetterWrapper struct {
+	cacheStorageGetter cacheStorage.CacheStorageGetter
+	conf               LocalCacheConfiguration
+	cache              *lru
+}
+
+/*
+NewLocalCacheGetterWrapper keeps the decoded results of the wrapped getter in an in-process LRU, keyed by collection,
+id, ver and dest type. Reads of the Latest version and of the cache versions expire after LatestTTL, and reads of any
+other ver after VersionTTL, since items of a fixed ver may still be updated, locked or removed. Errors, including not
+found, and empty results are never cached. Cached values are copied into dest shallowly, so callers must not modify
+slices, maps or pointers they hold.
+*/
+func NewLocalCacheGetterWrapper(conf LocalCacheConfiguration) CacheStorageGetterMiddleware {
+	if conf.MaxItems <= 0 {
+		conf.MaxItems = defaultMaxItems
+	}
+	if conf.LatestTTL <= 0 {
+		conf.LatestTTL = defaultLatestTTL
+	}
+	if conf.VersionTTL <= 0 {
+		conf.VersionTTL = defaultVersionTTL
+	}
+	return func(cacheStorageGetter cacheStorage.CacheStorageGetter) CacheStorageGetter {
+		return &localCacheGetterWrapper{cacheStorageGetter: cacheStorageGetter, conf: conf, cache: newLru(conf.MaxItems)}
+	}
+}
+
+func (m localCacheGetterWrapper) ttl(ver string) time.Duration {
+	if ver == Latest {
+		return m.conf.LatestTTL
+	}
+	return m.conf.VersionTTL
+}
+
+func isNonNilPtr(v reflect.Value, elemKind reflect.Kind) bool {
+	return v.Kind() == reflect.Ptr && !v.IsNil() && (elemKind == reflect.Invalid || v.Elem().Kind() == elemKind)
+}
+
+func isNonNilMap(v reflect.Value) bool {
+	v = reflect.Indirect(v)
+	return v.Kind() == reflect.Map && !v.IsNil()
+}
+
+func copyValue(v reflect.Value) reflect.Value {
+	c := reflect.New(v.Type()).Elem()
+	c.Set(v)
+	return c
+}
+
+func (m localCacheGetterWrapper) GetById(c context.Context, collectionName string, id string, ver string, dest interface{}) CacheStorageError {
+	destVal := reflect.ValueOf(dest)
+	if !isNonNilPtr(destVal, reflect.Invalid) {
+		return m.cacheStorageGetter.GetById(c, collectionName, id, ver, dest)
+	}
+	key := entryKey{op: itemOp, collection: collectionName, id: id, ver: ver, typ: destVal.Type().Elem()}
+	if cached, ok := m.cache.get(key); ok {
+		destVal.Elem().Set(cached)
+		return nil
+	}
+	if err := m.cacheStorageGetter.GetById(c, collectionName, id, ver, dest); err != nil {
+		return err
+	}
+	m.cache.set(key, copyValue(destVal.Elem()), m.ttl(ver))
+	return nil
+}
+
+func (m localCacheGetterWrapper) GetManyByIds(c context.Context, collectionName string, ids []string, ver string, dest interface{}) CacheStorageError {
+	destMap := reflect.Indirect(reflect.ValueOf(dest))
+	if len(ids) == 0 || !isNonNilMap(destMap) {
+		return m.cacheStorageGetter.GetManyByIds(c, collectionName, ids, ver, dest)
+	}
+	itemType := destMap.Type().Elem()
+	var missing []string
+	for _, id := range ids {
+		key := entryKey{op: itemOp, collection: collectionName, id: id, ver: ver, typ: itemType}
+		if cached, ok := m.cache.get(key); ok {
+			destMap.SetMapIndex(reflect.ValueOf(id), cached)
+		} else {
+			missing = append(missing, id)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	fetched := reflect.MakeMap(destMap.Type())
+	err := m.cacheStorageGetter.GetManyByIds(c, collectionName, missing, ver, fetched.Interface())
+	iter := fetched.MapRange()
+	for iter.Next() {
+		destMap.SetMapIndex(iter.Key(), iter.Value())
+		key := entryKey{op: itemOp, collection: collectionName, id: iter.Key().String(), ver: ver, typ: itemType}
+		m.cache.set(key, copyValue(iter.Value()), m.ttl(ver))
+	}
+	return err
+}
+
+func (m localCacheGetterWrapper) GetAll(c context.Context, collectionName string, ver string, dest interface{}) CacheStorageError {
+	destMap := reflect.Indirect(reflect.ValueOf(dest))
+	if !isNonNilMap(destMap) {
+		return m.cacheStorageGetter.GetAll(c, collectionName, ver, dest)
+	}
+	key := entryKey{op: allOp, collection: collectionName, ver: ver, typ: destMap.Type()}
+	if cached, ok := m.cache.get(key); ok {
+		iter := cached.MapRange()
+		for iter.Next() {
+			destMap.SetMapIndex(iter.Key(), iter.Value())
+		}
+		return nil
+	}
+	fetched := reflect.MakeMap(destMap.Type())
+	if err := m.cacheStorageGetter.GetAll(c, collectionName, ver, fetched.Interface()); err != nil {
+		return err
+	}
+	iter := fetched.MapRange()
+	for iter.Next() {
+		destMap.SetMapIndex(iter.Key(), iter.Value())
+	}
+	if fetched.Len() > 0 {
+		m.cache.set(key, fetched, m.ttl(ver))
+	}
+	return nil
+}
+
+func (m localCacheGetterWrapper) GetArrayBySingleId(c context.Context, collectionName string, id string, ver string, dest interface{}) CacheStorageError {
+	destVal := reflect.ValueOf(dest)
+	if !isNonNilPtr(destVal, reflect.Slice) {
+		return m.cacheStorageGetter.GetArrayBySingleId(c, collectionName, id, ver, dest)
+	}
+	destSlice := destVal.Elem()
+	key := entryKey{op: arrayOp, collection: collectionName, id: id, ver: ver, typ: destSlice.Type()}
+	if cached, ok := m.cache.get(key); ok {
+		destSlice.Set(reflect.AppendSlice(destSlice, cached))
+		return nil
+	}
+	fetched := reflect.New(destSlice.Type())
+	if err := m.cacheStorageGetter.GetArrayBySingleId(c, collectionName, id, ver, fetched.Interface()); err != nil {
+		return err
+	}
+	destSlice.Set(reflect.AppendSlice(destSlice, fetched.Elem()))
+	if fetched.Elem().Len() > 0 {
+		m.cache.set(key, fetched.Elem(), m.ttl(ver))
+	}
+	return nil
+}
+
+func (m localCacheGetterWrapper) GetLatestVersions(c context.Context) ([]CacheVersion, CacheStorageError) {
+	key := entryKey{op: versionsOp}
+	if cached, ok := m.cache.get(key); ok {
+		return append([]CacheVersion(nil), cached.Interface().([]CacheVersion)...), nil
+	}
+	versions, err := m.cacheStorageGetter.GetLatestVersions(c)
+	if err != nil || len(versions) == 0 {
+		return versions, err
+	}
+	m.cache.set(key, reflect.ValueOf(append([]CacheVersion(nil), versions...)), m.conf.LatestTTL)
+	return versions, nil
+}
+
+func (m localCacheGetterWrapper) GetLatestCollectionVersion(c context.Context, collection string) (CacheVersion, CacheStorageError) {
+	key := entryKey{op: collectionVersionOp, collection: collection}
+	if cached, ok := m.cache.get(key); ok {
+		return cached.Interface().(CacheVersion), nil
+	}
+	version, err := m.cacheStorageGetter.GetLatestCollectionVersion(c, collection)
+	if err != nil {
+		return version, err
+	}
+	m.cache.set(key, reflect.ValueOf(version), m.conf.LatestTTL)
+	return version, nil
+}
+
+// GetStoredVersions is not cached, it is meant for maintenance rather than for serving reads.
+func (m localCacheGetterWrapper) GetStoredVersions(c context.Context, collectionName string) ([]string, CacheStorageError) {
+	return GetStoredVersions(c, m.cacheStorageGetter, collectionName)
+}
@@ -0,0 +1,167 @@
+package localcache
+
+import (
+	"context"
+	"github.com/orchestd/cacheStorage"
+	"github.com/orchestd/cacheStorage/memory"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+type TestCatalogItem struct {
+	Id   string
+	Name string
+}
+
+type countingGetter struct {
+	cacheStorage.CacheStorageGetter
+	calls int
+}
+
+func (g *countingGetter) GetById(c context.Context, collectionName string, id string, ver string, dest interface{}) cacheStorage.CacheStorageError {
+	g.calls++
+	return g.CacheStorageGetter.GetById(c, collectionName, id, ver, dest)
+}
+
+func (g *countingGetter) GetManyByIds(c context.Context, collectionName string, ids []string, ver string, dest interface{}) cacheStorage.CacheStorageError {
+	g.calls++
+	return g.CacheStorageGetter.GetManyByIds(c, collectionName, ids, ver, dest)
+}
+
+func (g *countingGetter) GetAll(c context.Context, collectionName string, ver string, dest interface{}) cacheStorage.CacheStorageError {
+	g.calls++
+	return g.CacheStorageGetter.GetAll(c, collectionName, ver, dest)
+}
+
+func newTestGetter(t *testing.T, conf LocalCacheConfiguration) (*localCacheGetterWrapper, *countingGetter, cacheStorage.CacheStorageSetter) {
+	cache := memory.NewMemoryCacheStorage()
+	if err := cache.Connect(context.TODO(), "", "", "", "test"); err != nil {
+		t.Fatal(err)
+	}
+	getter, setter := cache.GetCacheStorageClient()
+	items := map[string]interface{}{
+		"1": TestCatalogItem{Id: "1", Name: "Item1"},
+		"2": TestCatalogItem{Id: "2", Name: "Item2"},
+	}
+	if err := setter.InsertMany(context.TODO(), "catalog", "1", items); err != nil {
+		t.Fatal(err)
+	}
+	if err := setter.Insert(context.TODO(), "catalog", "1", cacheStorage.Latest, TestCatalogItem{Id: "1", Name: "Latest"}); err != nil {
+		t.Fatal(err)
+	}
+	counting := &countingGetter{CacheStorageGetter: getter}
+	return NewLocalCacheGetterWrapper(conf)(counting).(*localCacheGetterWrapper), counting, setter
+}
+
+func TestGetById(t *testing.T) {
+	wrapper, counting, setter := newTestGetter(t, LocalCacheConfiguration{})
+	Convey("Getting an item of a fixed version twice reads it from the backend once", t, func() {
+		var item TestCatalogItem
+		So(wrapper.GetById(context.TODO(), "catalog", "1", "1", &item), ShouldBeNil)
+		So(setter.Update(context.TODO(), "catalog", "1", "1", TestCatalogItem{Id: "1", Name: "Changed"}), ShouldBeNil)
+		item = TestCatalogItem{}
+		So(wrapper.GetById(context.TODO(), "catalog", "1", "1", &item), ShouldBeNil)
+		So(item.Name, ShouldEqual, "Item1")
+		So(counting.calls, ShouldEqual, 1)
+	})
+	Convey("Getting a non existent item is not cached", t, func() {
+		var item TestCatalogItem
+		err := wrapper.GetById(context.TODO(), "catalog", "9", "1", &item)
+		So(err, ShouldNotBeNil)
+		So(err.IsNotFound(), ShouldBeTrue)
+		So(setter.Insert(context.TODO(), "catalog", "9", "1", TestCatalogItem{Id: "9"}), ShouldBeNil)
+		So(wrapper.GetById(context.TODO(), "catalog", "9", "1", &item), ShouldBeNil)
+	})
+	Convey("Getting an item with a non pointer dest is left to the backend", t, func() {
+		var item TestCatalogItem
+		err := wrapper.GetById(context.TODO(), "catalog", "1", "1", item)
+		So(err, ShouldNotBeNil)
+		So(err.IsInvalidDestType(), ShouldBeTrue)
+	})
+}
+
+func TestGetByIdLatest(t *testing.T) {
+	wrapper, counting, _ := newTestGetter(t, LocalCacheConfiguration{LatestTTL: time.Minute})
+	now := time.Now()
+	wrapper.cache.now = func() time.Time { return now }
+	Convey("Getting the latest version of an item expires after LatestTTL", t, func() {
+		var item TestCatalogItem
+		So(wrapper.GetById(context.TODO(), "catalog", "1", cacheStorage.Latest, &item), ShouldBeNil)
+		So(wrapper.GetById(context.TODO(), "catalog", "1", cacheStorage.Latest, &item), ShouldBeNil)
+		So(counting.calls, ShouldEqual, 1)
+		now = now.Add(time.Minute)
+		So(wrapper.GetById(context.TODO(), "catalog", "1", cacheStorage.Latest, &item), ShouldBeNil)
+		So(counting.calls, ShouldEqual, 2)
+		So(item.Name, ShouldEqual, "Latest")
+	})
+}
+
+func TestGetByIdVersionTTL(t *testing.T) {
+	wrapper, counting, setter := newTestGetter(t, LocalCacheConfiguration{VersionTTL: time.Minute})
+	now := time.Now()
+	wrapper.cache.now = func() time.Time { return now }
+	Convey("Getting an item of a fixed version expires after VersionTTL", t, func() {
+		var item TestCatalogItem
+		So(wrapper.GetById(context.TODO(), "catalog", "1", "1", &item), ShouldBeNil)
+		So(setter.Update(context.TODO(), "catalog", "1", "1", TestCatalogItem{Id: "1", Name: "Changed"}), ShouldBeNil)
+		now = now.Add(time.Minute)
+		So(wrapper.GetById(context.TODO(), "catalog", "1", "1", &item), ShouldBeNil)
+		So(counting.calls, ShouldEqual, 2)
+		So(item.Name, ShouldEqual, "Changed")
+	})
+}
+
+func TestGetManyByIds(t *testing.T) {
+	wrapper, counting, _ := newTestGetter(t, LocalCacheConfiguration{})
+	Convey("Getting many items only fetches the ones not cached yet", t, func() {
+		var item TestCatalogItem
+		So(wrapper.GetById(context.TODO(), "catalog", "1", "1", &item), ShouldBeNil)
+		items := make(map[string]TestCatalogItem)
+		So(wrapper.GetManyByIds(context.TODO(), "catalog", []string{"1", "2"}, "1", items), ShouldBeNil)
+		So(len(items), ShouldEqual, 2)
+		items = make(map[string]TestCatalogItem)
+		So(wrapper.GetManyByIds(context.TODO(), "catalog", []string{"1", "2"}, "1", items), ShouldBeNil)
+		So(len(items), ShouldEqual, 2)
+		So(counting.calls, ShouldEqual, 2)
+	})
+	Convey("Getting many items with a non existent one returns the found ones", t, func() {
+		items := make(map[string]TestCatalogItem)
+		err := wrapper.GetManyByIds(context.TODO(), "catalog", []string{"1", "9"}, "1", items)
+		So(err, ShouldNotBeNil)
+		So(err.IsNotFound(), ShouldBeTrue)
+		So(len(items), ShouldEqual, 1)
+	})
+}
+
+func TestGetAll(t *testing.T) {
+	wrapper, counting, setter := newTestGetter(t, LocalCacheConfiguration{})
+	Convey("Getting all items twice reads them from the backend once", t, func() {
+		items := make(map[string]TestCatalogItem)
+		So(wrapper.GetAll(context.TODO(), "catalog", "1", items), ShouldBeNil)
+		delete(items, "1")
+		items = make(map[string]TestCatalogItem)
+		So(wrapper.GetAll(context.TODO(), "catalog", "1", items), ShouldBeNil)
+		So(len(items), ShouldEqual, 2)
+		So(counting.calls, ShouldEqual, 1)
+	})
+	Convey("Getting all items of an empty version is not cached", t, func() {
+		items := make(map[string]TestCatalogItem)
+		wrapper.GetAll(context.TODO(), "catalog", "2", items)
+		So(len(items), ShouldEqual, 0)
+		So(setter.Insert(context.TODO(), "catalog", "1", "2", TestCatalogItem{Id: "1", Name: "Item1"}), ShouldBeNil)
+		So(wrapper.GetAll(context.TODO(), "catalog", "2", items), ShouldBeNil)
+		So(len(items), ShouldEqual, 1)
+	})
+}
+
+func TestEviction(t *testing.T) {
+	wrapper, counting, _ := newTestGetter(t, LocalCacheConfiguration{MaxItems: 1})
+	Convey("Getting more items than MaxItems evicts the least recently used", t, func() {
+		var item TestCatalogItem
+		So(wrapper.GetById(context.TODO(), "catalog", "1", "1", &item), ShouldBeNil)
+		So(wrapper.GetById(context.TODO(), "catalog", "2", "1", &item), ShouldBeNil)
+		So(wrapper.GetById(context.TODO(), "catalog", "1", "1", &item), ShouldBeNil)
+		So(counting.calls, ShouldEqual, 3)
+	})
+}
@@ -0,0 +1,72 @@
+package localcache
+
+import (
+	"container/list"
+	"reflect"
+	"sync"
+	"time"
+)
+
+type entryKey struct {
+	op         string
+	collection string
+	id         string
+	ver        string
+	typ        reflect.Type
+}
+
+type entry struct {
+	key       entryKey
+	value     reflect.Value
+	expiresAt time.Time
+}
+
+// lru keeps at most size entries, evicting the least recently used one. Entries with a zero expiresAt never expire.
+type lru struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List
+	entries map[entryKey]*list.Element
+	now     func() time.Time
+}
+
+func newLru(size int) *lru {
+	return &lru{size: size, order: list.New(), entries: make(map[entryKey]*list.Element), now: time.Now}
+}
+
+func (l *lru) get(key entryKey) (reflect.Value, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	el, ok := l.entries[key]
+	if !ok {
+		return reflect.Value{}, false
+	}
+	e := el.Value.(*entry)
+	if !e.expiresAt.IsZero() && !l.now().Before(e.expiresAt) {
+		l.order.Remove(el)
+		delete(l.entries, key)
+		return reflect.Value{}, false
+	}
+	l.order.MoveToFront(el)
+	return e.value, true
+}
+
+func (l *lru) set(key entryKey, value reflect.Value, ttl time.Duration) {
+	var expiresAt time.Time
+	if ttl > 0 {
+		expiresAt = l.now().Add(ttl)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if el, ok := l.entries[key]; ok {
+		el.Value = &entry{key: key, value: value, expiresAt: expiresAt}
+		l.order.MoveToFront(el)
+		return
+	}
+	l.entries[key] = l.order.PushFront(&entry{key: key, value: value, expiresAt: expiresAt})
+	for l.order.Len() > l.size {
+		oldest := l.order.Back()
+		l.order.Remove(oldest)
+		delete(l.entries, oldest.Value.(*entry).key)
+	}
+}
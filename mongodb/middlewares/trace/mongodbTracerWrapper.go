@@ -163,6 +163,18 @@ func (m mongoCacheStorageGetterWrapper) GetLatestCollectionVersion(c context.Con
 
 }
 
+func (m mongoCacheStorageGetterWrapper) GetStoredVersions(c context.Context, collectionName string) ([]string, CacheStorageError) {
+	var result []string
+	f := func(con context.Context) (err CacheStorageError) {
+		result, err = GetStoredVersions(con, m.cacheStorageGetter, collectionName)
+		return err
+	}
+	err := runMongoFuncWithTrace(c, "mongodb.driver/GetStoredVersions", m.tracer, m.conf, CacheTags{
+		collection: &collectionName,
+	}, f)
+	return result, err
+}
+
 type mongoCacheStorageSetterWrapper struct {
 	cacheStorageSetter cacheStorage.CacheStorageSetter
 	tracer             opentracing.Tracer
@@ -257,24 +269,70 @@ func (m mongoCacheStorageSetterWrapper) RemoveAll(c context.Context, collectionN
 	return err
 }
 
-func (m mongoCacheStorageSetterWrapper) GetAndLockById(c context.Context, collectionName string, id string, dest interface{}) CacheStorageError {
+func (m mongoCacheStorageSetterWrapper) GetAndLockById(c context.Context, collectionName string, id string, dest interface{}) (lock LockHandle, err CacheStorageError) {
 	f := func(con context.Context) (err CacheStorageError) {
-		err = m.cacheStorageSetter.GetAndLockById(con, collectionName, id, dest)
+		lock, err = m.cacheStorageSetter.GetAndLockById(con, collectionName, id, dest)
 		return err
 	}
-	err := runMongoFuncWithTrace(c, "mongodb.driver/getAndLockById", m.tracer, m.conf, CacheTags{
+	err = runMongoFuncWithTrace(c, "mongodb.driver/getAndLockById", m.tracer, m.conf, CacheTags{
 		collection: &collectionName,
 	}, f)
-	return err
+	return lock, err
 }
 
-func (m mongoCacheStorageSetterWrapper) ReleaseLockedById(c context.Context, collectionName string, id string) CacheStorageError {
+func (m mongoCacheStorageSetterWrapper) ReleaseLockedById(c context.Context, lock LockHandle) CacheStorageError {
 	f := func(con context.Context) (err CacheStorageError) {
-		err = m.cacheStorageSetter.ReleaseLockedById(con, collectionName, id)
+		err = m.cacheStorageSetter.ReleaseLockedById(con, lock)
 		return err
 	}
 	err := runMongoFuncWithTrace(c, "mongodb.driver/releaseLockedById", m.tracer, m.conf, CacheTags{
-		collection: &collectionName,
+		collection: &lock.Collection,
+	}, f)
+	return err
+}
+
+func (m mongoCacheStorageSetterWrapper) UpdateAndRelease(c context.Context, lock LockHandle, item interface{}) CacheStorageError {
+	f := func(con context.Context) (err CacheStorageError) {
+		err = m.cacheStorageSetter.UpdateAndRelease(con, lock, item)
+		return err
+	}
+	err := runMongoFuncWithTrace(c, "mongodb.driver/updateAndRelease", m.tracer, m.conf, CacheTags{
+		collection: &lock.Collection,
+	}, f)
+	return err
+}
+
+func (m mongoCacheStorageSetterWrapper) RenewLock(c context.Context, lock LockHandle) CacheStorageError {
+	f := func(con context.Context) (err CacheStorageError) {
+		err = m.cacheStorageSetter.RenewLock(con, lock)
+		return err
+	}
+	err := runMongoFuncWithTrace(c, "mongodb.driver/renewLock", m.tracer, m.conf, CacheTags{
+		collection: &lock.Collection,
+	}, f)
+	return err
+}
+
+func (m mongoCacheStorageSetterWrapper) UpdateCacheVersion(c context.Context, collection string, update func(cacheVersion *CacheVersion) error) CacheStorageError {
+	f := func(con context.Context) (err CacheStorageError) {
+		err = UpdateCacheVersion(con, m.cacheStorageSetter, collection, update)
+		return err
+	}
+	err := runMongoFuncWithTrace(c, "mongodb.driver/UpdateCacheVersion", m.tracer, m.conf, CacheTags{
+		collection: &collection,
 	}, f)
 	return err
 }
+
+func (m mongoCacheStorageSetterWrapper) MoveVersion(c context.Context, collectionName string, fromVer string, toVer string) (int, CacheStorageError) {
+	var result int
+	f := func(con context.Context) (err CacheStorageError) {
+		result, err = MoveVersion(con, m.cacheStorageSetter, collectionName, fromVer, toVer)
+		return err
+	}
+	err := runMongoFuncWithTrace(c, "mongodb.driver/MoveVersion", m.tracer, m.conf, CacheTags{
+		collection: &collectionName,
+		ver:        &toVer,
+	}, f)
+	return result, err
+}
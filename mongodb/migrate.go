@@ -0,0 +1,61 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"github.com/orchestd/cacheStorage"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+/*
+MigrateToDocuments rewrites the items of collectionName still kept as strings as embedded BSON documents, the way
+items are stored when the collection uses the BSON codec, and returns how many items it rewrote. Every item is decoded
+into a T and encoded back with the BSON codec, so its fields are named the way T is mapped to BSON rather than the way
+it was mapped to JSON. An item written while it was being rewritten is left as it is, and a later run picks it up.
+Encrypted items are never rewritten, as documents are kept in plaintext.
+
+storage must come from NewMongoDbCacheStorage and should already use the BSON codec for collectionName, otherwise
+items written after the migration are stored as strings again. Items stay readable throughout, whatever the codec.
+*/
+func MigrateToDocuments[T any](c context.Context, storage cacheStorage.CacheStorage, collectionName string) (int, cacheStorage.CacheStorageError) {
+	s, ok := storage.(*mongodbCacheStorage)
+	if !ok {
+		return 0, NewMongoCacheStorageError(fmt.Errorf("%T is not a mongodb cache storage", storage))
+	}
+	coll := s.database.Collection(collectionName)
+	cur, err := coll.Find(c, bson.M{"doc": bson.M{"$exists": false}, "keyId": bson.M{"$exists": false}})
+	if err != nil {
+		return 0, NewMongoCacheStorageError(err)
+	}
+	defer cur.Close(c)
+	migrated := 0
+	for cur.Next(c) {
+		var current struct {
+			ObjectId     primitive.ObjectID `bson:"_id"`
+			CacheWrapper `bson:",inline"`
+		}
+		if err := cur.Decode(&current); err != nil {
+			return migrated, NewMongoCacheStorageError(err)
+		}
+		var item T
+		if err := current.ExtractData(&item); err != nil {
+			return migrated, NewMongoCacheStorageError(fmt.Errorf("item %v of ver %v of collection %v: %w", current.Id, current.Ver, collectionName, err))
+		}
+		doc, err := cacheStorage.BSONCodec.Marshal(item)
+		if err != nil {
+			return migrated, NewMongoCacheStorageError(fmt.Errorf("item %v of ver %v of collection %v: %w", current.Id, current.Ver, collectionName, err))
+		}
+		unchanged := contentFilter(current.CacheWrapper)
+		unchanged["_id"] = current.ObjectId
+		res, err := coll.UpdateOne(c, unchanged, contentUpdate(CacheWrapper{Doc: doc, Codec: cacheStorage.BSONCodec.Name()}))
+		if err != nil {
+			return migrated, NewMongoCacheStorageError(err)
+		}
+		migrated += int(res.ModifiedCount)
+	}
+	if err := cur.Err(); err != nil {
+		return migrated, NewMongoCacheStorageError(err)
+	}
+	return migrated, nil
+}
@@ -1,9 +1,16 @@
 package mongodb
 
-import "errors"
+import (
+	"errors"
+	"github.com/orchestd/cacheStorage"
+	"go.mongodb.org/mongo-driver/mongo"
+)
 
-var NotFoundError = errors.New("Not found")
-var InvalidDestType = errors.New("Invalid dest type")
+var NotFoundError = cacheStorage.ErrNotFound
+var InvalidDestType = cacheStorage.ErrInvalidDestType
+
+// writeConflictCode is the code of the server error of a write that lost a race with another write.
+const writeConflictCode = 112
 
 type mongoCacheStorageError struct {
 	err error
@@ -17,6 +24,15 @@ func (e mongoCacheStorageError) Error() string {
 	return e.err.Error()
 }
 
+func (e mongoCacheStorageError) Unwrap() error {
+	return e.err
+}
+
+// classified classifies the errors that are not the driver's own the way every backend does.
+func (e mongoCacheStorageError) classified() cacheStorage.CacheStorageError {
+	return cacheStorage.NewCacheStorageError(e.err)
+}
+
 func (e mongoCacheStorageError) IsNotFound() bool {
 	return errors.Is(e.err, NotFoundError)
 }
@@ -24,3 +40,50 @@ func (e mongoCacheStorageError) IsNotFound() bool {
 func (e mongoCacheStorageError) IsInvalidDestType() bool {
 	return errors.Is(e.err, InvalidDestType)
 }
+
+func (e mongoCacheStorageError) IsUnknownKey() bool {
+	return errors.Is(e.err, cacheStorage.ErrUnknownKey)
+}
+
+func (e mongoCacheStorageError) IsSerialization() bool {
+	return errors.Is(e.err, cacheStorage.ErrSerialization)
+}
+
+func (e mongoCacheStorageError) IsDuplicateKey() bool {
+	return mongo.IsDuplicateKeyError(e.err) || e.classified().IsDuplicateKey()
+}
+
+func (e mongoCacheStorageError) IsTimeout() bool {
+	return mongo.IsTimeout(e.err) || e.classified().IsTimeout()
+}
+
+func (e mongoCacheStorageError) IsCanceled() bool {
+	return e.classified().IsCanceled()
+}
+
+func (e mongoCacheStorageError) IsConnection() bool {
+	return mongo.IsNetworkError(e.err) || errors.Is(e.err, mongo.ErrClientDisconnected) || e.classified().IsConnection()
+}
+
+func (e mongoCacheStorageError) IsLockTimeout() bool {
+	return e.classified().IsLockTimeout()
+}
+
+func (e mongoCacheStorageError) IsConflict() bool {
+	var serverErr mongo.ServerError
+	return errors.As(e.err, &serverErr) && serverErr.HasErrorCode(writeConflictCode) || e.classified().IsConflict()
+}
+
+// IsRetryable also takes the labels the server puts on the errors of writes and transactions that may be retried.
+func (e mongoCacheStorageError) IsRetryable() bool {
+	if e.IsCanceled() {
+		return false
+	}
+	var labeled interface{ HasErrorLabel(string) bool }
+	if errors.As(e.err, &labeled) && (labeled.HasErrorLabel("RetryableWriteError") || labeled.HasErrorLabel("TransientTransactionError")) {
+		return true
+	}
+	var serverErr mongo.ServerError
+	return e.IsTimeout() || e.IsConnection() || e.IsLockTimeout() || errors.Is(e.err, cacheStorage.ErrConflict) ||
+		errors.As(e.err, &serverErr) && serverErr.HasErrorCode(writeConflictCode)
+}
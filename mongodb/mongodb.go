@@ -10,10 +10,13 @@ import (
 type mongodbCacheStorage struct {
 	client   *mongo.Client
 	database *mongo.Database
+	options  cacheStorage.StorageOptions
 }
 
-func NewMongoDbCacheStorage() cacheStorage.CacheStorage {
-	return &mongodbCacheStorage{}
+// NewMongoDbCacheStorage returns a CacheStorage kept in mongodb. The items of collections using the BSON codec are
+// stored as embedded documents that can be queried on the server; MigrateToDocuments converts the items stored before.
+func NewMongoDbCacheStorage(storageOptions ...cacheStorage.StorageOption) cacheStorage.CacheStorage {
+	return &mongodbCacheStorage{options: cacheStorage.NewStorageOptions(storageOptions...)}
 }
 
 func (s *mongodbCacheStorage) Connect(c context.Context, host, userName, userPw, database string) error {
@@ -42,3 +45,7 @@ func (s *mongodbCacheStorage) GetCacheStorageClient() (cacheStorage.CacheStorage
 	client := mongodbClient{storage: s}
 	return client, client
 }
+
+func (s *mongodbCacheStorage) GetLocker() *cacheStorage.Locker {
+	return cacheStorage.NewLocker(mongodbLeases{storage: s}, s.options.Lock)
+}
@@ -2,18 +2,19 @@ package mongodb
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	. "github.com/orchestd/cacheStorage"
+	"github.com/orchestd/cacheStorage"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
-	"log"
 	"reflect"
+	"sort"
 	"time"
 )
 
-const Latest = "latest"
+// Latest is cacheStorage.Latest, kept for the callers naming it through this package.
+const Latest = cacheStorage.Latest
 
 const idField = "id"
 const verField = "ver"
@@ -26,43 +27,78 @@ type LockedItem struct {
 }
 
 type CacheWrapper struct {
-	Id     string      `json:"id"`
-	Ver    string      `json:"ver"`
-	Data   string      `json:"data"`
-	Locked *LockedItem `json:"locked"`
+	Id          string      `json:"id"`
+	Ver         string      `json:"ver"`
+	Data        string      `json:"data"`
+	Doc         bson.Raw    `json:"doc,omitempty" bson:"doc,omitempty"`
+	Codec       string      `json:"codec,omitempty" bson:"codec,omitempty"`
+	Compression string      `json:"compression,omitempty" bson:"compression,omitempty"`
+	KeyId       string      `json:"keyId,omitempty" bson:"keyId,omitempty"`
+	Locked      *LockedItem `json:"locked"`
+	// Fence counts the locks taken on the document, and outlives them.
+	Fence int64 `json:"fence,omitempty" bson:"fence,omitempty"`
 }
 
-/*
-func (w CacheWrapper) AddData(i interface{}) CacheWrapper {
-	gob.Register(i)
-	var data bytes.Buffer
-	err := gob.NewEncoder(&data).Encode(i)
+// AddData encodes i as JSON into w. Items that cannot be encoded are ErrSerialization.
+func (w CacheWrapper) AddData(i interface{}) (CacheWrapper, error) {
+	encoded, err := cacheStorage.NewStorageOptions().EncodeItem("", i)
 	if err != nil {
-		log.Fatal(err)
+		return w, err
 	}
-	w.Data = data.Bytes()
+	return w.AddEncodedData(encoded), nil
+}
+
+/*
+AddEncodedData keeps encoded in w. Items encoded with the BSON codec and left uncompressed and unencrypted are kept as
+an embedded document in Doc rather than as a string in Data, so they can be filtered, projected and indexed on the
+server.
+*/
+func (w CacheWrapper) AddEncodedData(encoded cacheStorage.EncodedItem) CacheWrapper {
+	w.Codec, w.Compression, w.KeyId = encoded.Codec, encoded.Compression, encoded.KeyId
+	if encoded.Codec == cacheStorage.BSONCodec.Name() && encoded.Compression == "" && encoded.KeyId == "" {
+		w.Doc = encoded.Data
+		return w
+	}
+	w.Data = encoded.Text()
 	return w
 }
 
+// ExtractData decodes the item of w into i. Encrypted items take the keys ExtractDataWith is given.
 func (w CacheWrapper) ExtractData(i interface{}) error {
-	data := bytes.NewBuffer(w.Data)
-	err := gob.NewDecoder(data).Decode(i)
-	return err
+	return w.ExtractDataWith(cacheStorage.NewStorageOptions(), i)
 }
-*/
 
-func (w CacheWrapper) AddData(i interface{}) CacheWrapper {
-	b, err := json.Marshal(i)
-	if err != nil {
-		log.Fatal(err)
+// ExtractDataWith decodes the item of w into i, decrypting it with the keys of options when it is encrypted.
+func (w CacheWrapper) ExtractDataWith(options cacheStorage.StorageOptions, i interface{}) error {
+	if w.Doc != nil {
+		return options.DecodeItem(cacheStorage.EncodedItem{Data: w.Doc, Codec: w.Codec}, i)
 	}
-	w.Data = string(b)
-	return w
+	return options.DecodeText(cacheStorage.EncodedItem{Codec: w.Codec, Compression: w.Compression, KeyId: w.KeyId}, w.Data, i)
 }
 
-func (w CacheWrapper) ExtractData(i interface{}) error {
-	err := json.Unmarshal([]byte(w.Data), i)
-	return err
+// contentFilter matches the documents whose item is still the one w holds.
+func contentFilter(w CacheWrapper) bson.M {
+	if w.Doc == nil {
+		return bson.M{"data": w.Data, "doc": bson.M{"$exists": false}}
+	}
+	return bson.M{"data": w.Data, "doc": w.Doc}
+}
+
+// contentUpdate replaces the item of a document with the one w holds, leaving its id, ver and lock as they are.
+func contentUpdate(w CacheWrapper) bson.M {
+	set := bson.M{"data": w.Data, "codec": w.Codec, "compression": w.Compression}
+	unset := bson.M{}
+	if w.Doc == nil {
+		unset["doc"] = ""
+	} else {
+		set["doc"] = w.Doc
+	}
+	if w.KeyId == "" {
+		unset["keyId"] = ""
+	} else {
+		set["keyId"] = w.KeyId
+	}
+	return bson.M{"$set": set, "$unset": unset}
 }
 
 func checkDestType(i interface{}, pointer, nonNil, isMap bool, isSlice bool) error {
@@ -91,9 +127,18 @@ type mongodbClient struct {
 	storage *mongodbCacheStorage
 }
 
-func (m mongodbClient) GetLatestVersions(c context.Context) ([]CacheVersion, CacheStorageError) {
-	cacheVersions := make(map[string]CacheVersion)
-	var versions []CacheVersion
+// wrap encodes item the way the items of collectionName are configured to be, into w.
+func (m mongodbClient) wrap(collectionName string, w CacheWrapper, item interface{}) (CacheWrapper, error) {
+	encoded, err := m.storage.options.EncodeItem(collectionName, item)
+	if err != nil {
+		return w, err
+	}
+	return w.AddEncodedData(encoded), nil
+}
+
+func (m mongodbClient) GetLatestVersions(c context.Context) ([]cacheStorage.CacheVersion, cacheStorage.CacheStorageError) {
+	cacheVersions := make(map[string]cacheStorage.CacheVersion)
+	var versions []cacheStorage.CacheVersion
 	err := m.GetAll(c, cacheVersionsCollectionName, "1", cacheVersions)
 	if err != nil {
 		return versions, err
@@ -104,8 +149,8 @@ func (m mongodbClient) GetLatestVersions(c context.Context) ([]CacheVersion, Cac
 	return versions, nil
 }
 
-func (m mongodbClient) GetLatestCollectionVersion(c context.Context, collection string) (CacheVersion, CacheStorageError) {
-	cacheVersion := CacheVersion{}
+func (m mongodbClient) GetLatestCollectionVersion(c context.Context, collection string) (cacheStorage.CacheVersion, cacheStorage.CacheStorageError) {
+	cacheVersion := cacheStorage.CacheVersion{}
 	err := m.GetById(c, cacheVersionsCollectionName, collection, "1", &cacheVersion)
 	if err != nil {
 		return cacheVersion, err
@@ -113,7 +158,22 @@ func (m mongodbClient) GetLatestCollectionVersion(c context.Context, collection
 	return cacheVersion, nil
 }
 
-func (m mongodbClient) GetById(ctx context.Context, collectionName string, id string, ver string, dest interface{}) CacheStorageError {
+func (m mongodbClient) GetStoredVersions(c context.Context, collectionName string) ([]string, cacheStorage.CacheStorageError) {
+	distinct, err := m.storage.database.Collection(collectionName).Distinct(c, verField, bson.M{})
+	if err != nil {
+		return nil, NewMongoCacheStorageError(err)
+	}
+	var vers []string
+	for _, ver := range distinct {
+		if ver, ok := ver.(string); ok {
+			vers = append(vers, ver)
+		}
+	}
+	sort.Strings(vers)
+	return vers, nil
+}
+
+func (m mongodbClient) GetById(ctx context.Context, collectionName string, id string, ver string, dest interface{}) cacheStorage.CacheStorageError {
 	err := checkDestType(dest, true, true, false, false)
 	if err != nil {
 		return NewMongoCacheStorageError(fmt.Errorf("%w: %q", InvalidDestType, err))
@@ -131,14 +191,14 @@ func (m mongodbClient) GetById(ctx context.Context, collectionName string, id st
 	if err != nil {
 		return NewMongoCacheStorageError(err)
 	}
-	err = wrap.ExtractData(dest)
+	err = wrap.ExtractDataWith(m.storage.options, dest)
 	if err != nil {
 		return NewMongoCacheStorageError(err)
 	}
 	return nil
 }
 
-func (m mongodbClient) getMany(ctx context.Context, collectionName string, filterByIds []string, ver string, dest interface{}) CacheStorageError {
+func (m mongodbClient) getMany(ctx context.Context, collectionName string, filterByIds []string, ver string, dest interface{}) cacheStorage.CacheStorageError {
 	err := checkDestType(dest, false, true, true, false)
 	if err != nil {
 		return NewMongoCacheStorageError(fmt.Errorf("%w: %q", InvalidDestType, err))
@@ -161,7 +221,7 @@ func (m mongodbClient) getMany(ctx context.Context, collectionName string, filte
 		destItemType := getMapValueType(dest)
 		destItemP := reflect.New(destItemType)
 		destItem := reflect.Indirect(destItemP)
-		err = wrap.ExtractData(destItemP.Interface())
+		err = wrap.ExtractDataWith(m.storage.options, destItemP.Interface())
 		if err != nil {
 			return NewMongoCacheStorageError(err)
 		}
@@ -184,14 +244,14 @@ func (m mongodbClient) getMany(ctx context.Context, collectionName string, filte
 	return nil
 }
 
-func (m mongodbClient) GetManyByIds(ctx context.Context, collectionName string, ids []string, ver string, dest interface{}) CacheStorageError {
+func (m mongodbClient) GetManyByIds(ctx context.Context, collectionName string, ids []string, ver string, dest interface{}) cacheStorage.CacheStorageError {
 	if len(ids) == 0 {
 		return nil
 	}
 	return m.getMany(ctx, collectionName, ids, ver, dest)
 }
 
-func (m mongodbClient) GetArrayBySingleId(ctx context.Context, collectionName string, id string, ver string, dest interface{}) CacheStorageError {
+func (m mongodbClient) GetArrayBySingleId(ctx context.Context, collectionName string, id string, ver string, dest interface{}) cacheStorage.CacheStorageError {
 	err := checkDestType(dest, false, true, false, true)
 	if err != nil {
 		return NewMongoCacheStorageError(fmt.Errorf("%w: %q", InvalidDestType, err))
@@ -210,7 +270,7 @@ func (m mongodbClient) GetArrayBySingleId(ctx context.Context, collectionName st
 		}
 		destItemP := reflect.New(destVal.Type().Elem())
 		destItem := reflect.Indirect(destItemP)
-		err = wrap.ExtractData(destItemP.Interface())
+		err = wrap.ExtractDataWith(m.storage.options, destItemP.Interface())
 		if err != nil {
 			return NewMongoCacheStorageError(err)
 		}
@@ -220,32 +280,39 @@ func (m mongodbClient) GetArrayBySingleId(ctx context.Context, collectionName st
 	return nil
 }
 
-func (m mongodbClient) GetAll(ctx context.Context, collectionName string, ver string, dest interface{}) CacheStorageError {
+func (m mongodbClient) GetAll(ctx context.Context, collectionName string, ver string, dest interface{}) cacheStorage.CacheStorageError {
 	return m.getMany(ctx, collectionName, nil, ver, dest)
 }
 
-func (m mongodbClient) Insert(ctx context.Context, collectionName string, id string, ver string, item interface{}) CacheStorageError {
-	wrap := CacheWrapper{Id: id, Ver: ver}.AddData(item)
-	_, err := m.storage.database.Collection(collectionName).InsertOne(ctx, wrap)
+func (m mongodbClient) Insert(ctx context.Context, collectionName string, id string, ver string, item interface{}) cacheStorage.CacheStorageError {
+	wrap, err := m.wrap(collectionName, CacheWrapper{Id: id, Ver: ver}, item)
+	if err != nil {
+		return NewMongoCacheStorageError(err)
+	}
+	_, err = m.storage.database.Collection(collectionName).InsertOne(ctx, wrap)
 	if err != nil {
 		return NewMongoCacheStorageError(err)
 	}
 	return nil
 }
 
-func (m mongodbClient) InsertMany(ctx context.Context, collectionName string, ver string, items map[string]interface{}) CacheStorageError {
+func (m mongodbClient) InsertMany(ctx context.Context, collectionName string, ver string, items map[string]interface{}) cacheStorage.CacheStorageError {
+	encoded, err := m.storage.options.EncodeItems(collectionName, items)
+	if err != nil {
+		return NewMongoCacheStorageError(err)
+	}
 	var wraps []interface{}
-	for id, v := range items {
-		wraps = append(wraps, CacheWrapper{Id: id, Ver: ver}.AddData(v))
+	for id, item := range encoded {
+		wraps = append(wraps, CacheWrapper{Id: id, Ver: ver}.AddEncodedData(item))
 	}
-	_, err := m.storage.database.Collection(collectionName).InsertMany(ctx, wraps)
+	_, err = m.storage.database.Collection(collectionName).InsertMany(ctx, wraps)
 	if err != nil {
 		return NewMongoCacheStorageError(err)
 	}
 	return nil
 }
 
-func (m mongodbClient) InsertOrUpdate(ctx context.Context, collectionName string, id string, ver string, item interface{}) CacheStorageError {
+func (m mongodbClient) InsertOrUpdate(ctx context.Context, collectionName string, id string, ver string, item interface{}) cacheStorage.CacheStorageError {
 	if count, err := m.storage.database.Collection(collectionName).CountDocuments(ctx, bson.M{idField: id, verField: ver}); err != nil {
 		return NewMongoCacheStorageError(err)
 	} else if count > 0 {
@@ -255,15 +322,45 @@ func (m mongodbClient) InsertOrUpdate(ctx context.Context, collectionName string
 	}
 }
 
-func (m mongodbClient) Update(ctx context.Context, collectionName string, id string, ver string, item interface{}) CacheStorageError {
-	_, err := m.storage.database.Collection(collectionName).ReplaceOne(ctx, bson.M{idField: id, verField: ver}, CacheWrapper{Id: id, Ver: ver}.AddData(item))
+func (m mongodbClient) Update(ctx context.Context, collectionName string, id string, ver string, item interface{}) cacheStorage.CacheStorageError {
+	wrap, err := m.wrap(collectionName, CacheWrapper{Id: id, Ver: ver}, item)
+	if err != nil {
+		return NewMongoCacheStorageError(err)
+	}
+	// the item is replaced while the fence of the document is kept, so it keeps counting the locks taken on the item
+	update := contentUpdate(wrap)
+	update["$unset"].(bson.M)["locked"] = ""
+	filter := bson.M{idField: id, verField: ver}
+	if m.storage.options.Lock.GuardUpdates {
+		filter["$expr"] = bson.M{"$not": bson.A{m.lockHeld()}}
+	}
+	coll := m.storage.database.Collection(collectionName)
+	res, err := coll.UpdateOne(ctx, filter, update)
 	if err != nil {
 		return NewMongoCacheStorageError(err)
 	}
+	if res.MatchedCount == 0 && m.storage.options.Lock.GuardUpdates {
+		// nothing was updated, either because the document is locked or because there is none
+		if count, err := coll.CountDocuments(ctx, bson.M{idField: id, verField: ver}); err != nil {
+			return NewMongoCacheStorageError(err)
+		} else if count > 0 {
+			return NewMongoCacheStorageError(fmt.Errorf("%w: item %v of collection %v is locked by another owner", cacheStorage.ErrLockNotHeld, id, collectionName))
+		}
+	}
 	return nil
 }
 
-func (m mongodbClient) Remove(ctx context.Context, collectionName string, id string, ver string) CacheStorageError {
+// lockHeld is the expression telling whether a document holds a lock whose lease did not run out.
+func (m mongodbClient) lockHeld() bson.M {
+	return bson.M{"$and": bson.A{
+		bson.M{"$eq": bson.A{bson.M{"$type": "$locked"}, "object"}},
+		bson.M{"$lte": bson.A{
+			bson.M{"$dateDiff": bson.M{"startDate": "$locked.lockedAt", "endDate": "$$NOW", "unit": "millisecond"}}, m.storage.options.Lock.Lease.Milliseconds()},
+		},
+	}}
+}
+
+func (m mongodbClient) Remove(ctx context.Context, collectionName string, id string, ver string) cacheStorage.CacheStorageError {
 	_, err := m.storage.database.Collection(collectionName).DeleteOne(ctx, bson.M{idField: id, verField: ver})
 	if err != nil {
 		return NewMongoCacheStorageError(err)
@@ -271,7 +368,7 @@ func (m mongodbClient) Remove(ctx context.Context, collectionName string, id str
 	return nil
 }
 
-func (m mongodbClient) RemoveAll(ctx context.Context, collectionName string, ver string) CacheStorageError {
+func (m mongodbClient) RemoveAll(ctx context.Context, collectionName string, ver string) cacheStorage.CacheStorageError {
 	_, err := m.storage.database.Collection(collectionName).DeleteMany(ctx, bson.M{"ver": ver})
 	if err != nil {
 		return NewMongoCacheStorageError(err)
@@ -279,69 +376,184 @@ func (m mongodbClient) RemoveAll(ctx context.Context, collectionName string, ver
 	return nil
 }
 
-func (m mongodbClient) GetAndLockById(c context.Context, collectionName string, id string, dest interface{}) CacheStorageError {
-	traceId := c.Value("Uber-Trace-Id")
+func (m mongodbClient) GetAndLockById(c context.Context, collectionName string, id string, dest interface{}) (cacheStorage.LockHandle, cacheStorage.CacheStorageError) {
+	handle := cacheStorage.LockHandle{Collection: collectionName, Id: id, Owner: cacheStorage.NewLockOwner()}
 	update := []bson.M{
 		{
 			"$set": bson.M{
-				"locked": bson.M{
-					"$cond": bson.M{
-						"if": bson.M{
-							"$or": []bson.M{
-								{"$eq": bson.A{"$locked", nil}},
-								{"$ne": bson.A{bson.M{"$type": "$locked"}, "object"}},
-								{"$gt": bson.A{
-									bson.M{"$dateDiff": bson.M{"startDate": "$locked.lockedAt", "endDate": "$$NOW", "unit": "second"}}, 30},
-								},
-							},
+				"acquired": bson.M{
+					"$or": []bson.M{
+						{"$eq": bson.A{"$locked", nil}},
+						{"$ne": bson.A{bson.M{"$type": "$locked"}, "object"}},
+						{"$gt": bson.A{
+							bson.M{"$dateDiff": bson.M{"startDate": "$locked.lockedAt", "endDate": "$$NOW", "unit": "millisecond"}}, m.storage.options.Lock.Lease.Milliseconds()},
 						},
-						"then": bson.M{"lockedAt": "$$NOW", "lockedBy": traceId},
-						"else": "$locked",
 					},
 				},
 			},
 		},
+		{
+			"$set": bson.M{
+				"locked": bson.M{"$cond": bson.A{"$acquired", bson.M{"lockedAt": "$$NOW", "lockedBy": handle.Owner}, "$locked"}},
+				"fence":  bson.M{"$cond": bson.A{"$acquired", bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$fence", 0}}, 1}}, "$fence"}},
+			},
+		},
+		{"$unset": "acquired"},
 	}
 	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
 
+	wait := m.storage.options.Lock.NewLockWait(collectionName, id)
 	for {
 		result := m.storage.database.Collection(collectionName).FindOneAndUpdate(c, bson.M{idField: id}, update, opts)
 		if result.Err() != nil {
 			if result.Err() == mongo.ErrNoDocuments {
-				return NewMongoCacheStorageError(fmt.Errorf("%w: %q", NotFoundError, result.Err()))
+				return cacheStorage.LockHandle{}, NewMongoCacheStorageError(fmt.Errorf("%w: %q", NotFoundError, result.Err()))
 			} else {
-				return NewMongoCacheStorageError(result.Err())
+				return cacheStorage.LockHandle{}, NewMongoCacheStorageError(result.Err())
 			}
 		}
 		var wrap CacheWrapper
 		err := result.Decode(&wrap)
 		if err != nil {
-			return NewMongoCacheStorageError(err)
+			return cacheStorage.LockHandle{}, NewMongoCacheStorageError(err)
 		}
-		if wrap.Locked.LockedBy != traceId {
-			time.Sleep(50 * time.Millisecond)
+		if wrap.Locked.LockedBy != handle.Owner {
+			if err := wait.Sleep(c, nil); err != nil {
+				return cacheStorage.LockHandle{}, NewMongoCacheStorageError(err)
+			}
 		} else {
-			err := wrap.ExtractData(dest)
+			err := wrap.ExtractDataWith(m.storage.options, dest)
 			if err != nil {
-				return NewMongoCacheStorageError(err)
+				return cacheStorage.LockHandle{}, NewMongoCacheStorageError(err)
 			}
-			return nil
+			handle.Fence = wrap.Fence
+			return handle, nil
 		}
 	}
 }
 
 /*
-ReleaseLockedById in most cases will do nothing, cause the "update" function inserts a record without a lock and
+ReleaseLockedById in most cases will do nothing, cause UpdateAndRelease writes the record without a lock and
 therefore "automatically releases" the record a specific session locked
 */
-func (m mongodbClient) ReleaseLockedById(c context.Context, collectionName string, id string) CacheStorageError {
-	traceId := c.Value("Uber-Trace-Id")
-
-	filter := bson.M{idField: id, "locked.lockedBy": traceId}
+func (m mongodbClient) ReleaseLockedById(c context.Context, lock cacheStorage.LockHandle) cacheStorage.CacheStorageError {
+	filter := bson.M{idField: lock.Id, "locked.lockedBy": lock.Owner}
 	update := []bson.M{{"$set": bson.M{"locked": nil}}}
-	_, err := m.storage.database.Collection(collectionName).UpdateOne(c, filter, update)
+	_, err := m.storage.database.Collection(lock.Collection).UpdateOne(c, filter, update)
 	if err != nil {
 		return NewMongoCacheStorageError(err)
 	}
 	return nil
 }
+
+func (m mongodbClient) UpdateAndRelease(c context.Context, lock cacheStorage.LockHandle, item interface{}) cacheStorage.CacheStorageError {
+	wrap, err := m.wrap(lock.Collection, CacheWrapper{Id: lock.Id}, item)
+	if err != nil {
+		return NewMongoCacheStorageError(err)
+	}
+	update := contentUpdate(wrap)
+	update["$unset"].(bson.M)["locked"] = ""
+	filter := bson.M{idField: lock.Id, "locked.lockedBy": lock.Owner, "$expr": m.lockHeld()}
+	res, err := m.storage.database.Collection(lock.Collection).UpdateOne(c, filter, update)
+	if err != nil {
+		return NewMongoCacheStorageError(err)
+	}
+	if res.MatchedCount == 0 {
+		return NewMongoCacheStorageError(fmt.Errorf("%w: item %v of collection %v", cacheStorage.ErrLockNotHeld, lock.Id, lock.Collection))
+	}
+	return nil
+}
+
+func (m mongodbClient) RenewLock(c context.Context, lock cacheStorage.LockHandle) cacheStorage.CacheStorageError {
+	filter := bson.M{idField: lock.Id, "locked.lockedBy": lock.Owner, "$expr": m.lockHeld()}
+	update := []bson.M{{"$set": bson.M{"locked.lockedAt": "$$NOW"}}}
+	res, err := m.storage.database.Collection(lock.Collection).UpdateOne(c, filter, update)
+	if err != nil {
+		return NewMongoCacheStorageError(err)
+	}
+	if res.MatchedCount == 0 {
+		return NewMongoCacheStorageError(fmt.Errorf("%w: item %v of collection %v", cacheStorage.ErrLockNotHeld, lock.Id, lock.Collection))
+	}
+	return nil
+}
+
+/*
+UpdateCacheVersion reads the entry and writes it back only if its data is still the one read, starting over when
+another writer changed it in between. Without a unique index two writers may both insert a missing entry, so an
+inserted entry that turns out not to be the first one under its id is deleted again and the update starts over.
+*/
+func (m mongodbClient) UpdateCacheVersion(c context.Context, collection string, update func(cacheVersion *cacheStorage.CacheVersion) error) cacheStorage.CacheStorageError {
+	coll := m.storage.database.Collection(cacheVersionsCollectionName)
+	filter := bson.M{idField: collection, verField: "1"}
+	for {
+		var current struct {
+			ObjectId     primitive.ObjectID `bson:"_id"`
+			CacheWrapper `bson:",inline"`
+		}
+		exists := true
+		if err := coll.FindOne(c, filter).Decode(&current); err == mongo.ErrNoDocuments {
+			exists = false
+		} else if err != nil {
+			return NewMongoCacheStorageError(err)
+		}
+		cacheVersion := cacheStorage.CacheVersion{CollectionName: collection}
+		if exists {
+			if err := current.ExtractDataWith(m.storage.options, &cacheVersion); err != nil {
+				return NewMongoCacheStorageError(err)
+			}
+		}
+		if err := update(&cacheVersion); err != nil {
+			return NewMongoCacheStorageError(err)
+		}
+		wrap, err := m.wrap(cacheVersionsCollectionName, CacheWrapper{Id: collection, Ver: "1"}, cacheVersion)
+		if err != nil {
+			return NewMongoCacheStorageError(err)
+		}
+		if exists {
+			unchanged := contentFilter(current.CacheWrapper)
+			unchanged["_id"] = current.ObjectId
+			res, err := coll.UpdateOne(c, unchanged, contentUpdate(wrap))
+			if err != nil {
+				return NewMongoCacheStorageError(err)
+			}
+			if res.MatchedCount > 0 {
+				return nil
+			}
+			continue
+		}
+		res, err := coll.InsertOne(c, wrap)
+		if err != nil {
+			return NewMongoCacheStorageError(err)
+		}
+		var first struct {
+			ObjectId primitive.ObjectID `bson:"_id"`
+		}
+		if err := coll.FindOne(c, filter).Decode(&first); err != nil {
+			return NewMongoCacheStorageError(err)
+		}
+		if first.ObjectId == res.InsertedID {
+			return nil
+		}
+		if _, err := coll.DeleteOne(c, bson.M{"_id": res.InsertedID}); err != nil {
+			return NewMongoCacheStorageError(err)
+		}
+	}
+}
+
+// MoveVersion updates the ver of the items one by one on the server, so readers of either ver may see some of them
+// moved before the rest are. toVer is checked to be empty before the update rather than along with it, so items another
+// writer inserts into toVer in between end up mixed with the moved ones.
+func (m mongodbClient) MoveVersion(c context.Context, collectionName string, fromVer string, toVer string) (int, cacheStorage.CacheStorageError) {
+	coll := m.storage.database.Collection(collectionName)
+	if count, err := coll.CountDocuments(c, bson.M{verField: toVer}, options.Count().SetLimit(1)); err != nil {
+		return 0, NewMongoCacheStorageError(err)
+	} else if count > 0 {
+		err := fmt.Errorf("ver %v of collection %v", toVer, collectionName)
+		return 0, NewMongoCacheStorageError(fmt.Errorf("%w: %q", cacheStorage.ErrVerInUse, err))
+	}
+	res, err := coll.UpdateMany(c, bson.M{verField: fromVer}, bson.M{"$set": bson.M{verField: toVer}})
+	if err != nil {
+		return 0, NewMongoCacheStorageError(err)
+	}
+	return int(res.ModifiedCount), nil
+}
@@ -4,8 +4,10 @@ import (
 	"context"
 	"fmt"
 	"github.com/orchestd/cacheStorage"
+	"github.com/orchestd/cacheStorage/cacheStoragetest"
 	"github.com/ory/dockertest"
 	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"log"
@@ -18,6 +20,9 @@ var testCollectionName = "catalog"
 
 var cache cacheStorage.CacheStorage
 
+var testHost string
+var testDatabases int
+
 type TestCatalogItem struct {
 	Id    string
 	Name  string
@@ -40,12 +45,22 @@ func trustedTimeParse(t, layout string) time.Time {
 
 var fakeNow = trustedTimeParse("2021-02-02 11:11:11", "2006-01-02 15:04:05")
 
+// mustAddData is AddData for fixtures that are known to encode.
+func mustAddData(w CacheWrapper, i interface{}) CacheWrapper {
+	w, err := w.AddData(i)
+	if err != nil {
+		panic(err)
+	}
+	return w
+}
+
 func initTestCollection(host string) error {
 	client, err := mongo.NewClient(options.Client().ApplyURI(host))
 	if err != nil {
 		return err
 	}
-	ctx, _ := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
 	err = client.Connect(ctx)
 	db := client.Database("test")
 	err = db.CreateCollection(ctx, testCollectionName)
@@ -59,31 +74,31 @@ func initTestCollection(host string) error {
 	collection := db.Collection(testCollectionName)
 
 	testCatalog := []interface{}{
-		CacheWrapper{Id: "1", Ver: testVersion}.AddData(testCatalogItem1),
-		CacheWrapper{Id: "2", Ver: testVersion}.AddData(testCatalogItem2),
-		CacheWrapper{Id: "3", Ver: testVersion}.AddData(testCatalogItem3),
-		CacheWrapper{Id: "4", Ver: testVersion}.AddData(testCatalogItem4),
-		CacheWrapper{Id: "5", Ver: "3"}.AddData(testCatalogItem5),
-		CacheWrapper{Id: "5", Ver: "4"}.AddData(testCatalogItem6),
+		mustAddData(CacheWrapper{Id: "1", Ver: testVersion}, testCatalogItem1),
+		mustAddData(CacheWrapper{Id: "2", Ver: testVersion}, testCatalogItem2),
+		mustAddData(CacheWrapper{Id: "3", Ver: testVersion}, testCatalogItem3),
+		mustAddData(CacheWrapper{Id: "4", Ver: testVersion}, testCatalogItem4),
+		mustAddData(CacheWrapper{Id: "5", Ver: "3"}, testCatalogItem5),
+		mustAddData(CacheWrapper{Id: "5", Ver: "4"}, testCatalogItem6),
 	}
 	_, err = collection.InsertMany(ctx, testCatalog)
 	if err != nil {
 		return err
 	}
 	testVersions := []interface{}{
-		CacheWrapper{Id: "stores", Ver: "1"}.AddData(cacheStorage.CacheVersion{
+		mustAddData(CacheWrapper{Id: "stores", Ver: "1"}, cacheStorage.CacheVersion{
 			CollectionName: "stores",
 			Versions:       []cacheStorage.Version{{Version: "2", TimedTo: trustedTimeParse("2021-01-01 00:00:00", "2006-01-02 15:04:05")}},
 		}),
-		CacheWrapper{Id: "storeOpeningHours", Ver: "1"}.AddData(cacheStorage.CacheVersion{
+		mustAddData(CacheWrapper{Id: "storeOpeningHours", Ver: "1"}, cacheStorage.CacheVersion{
 			CollectionName: "storeOpeningHours",
 			Versions:       []cacheStorage.Version{{Version: "4", TimedTo: trustedTimeParse("2021-01-01 00:00:00", "2006-01-02 15:04:05")}},
 		}),
-		CacheWrapper{Id: "occasions", Ver: "1"}.AddData(cacheStorage.CacheVersion{
+		mustAddData(CacheWrapper{Id: "occasions", Ver: "1"}, cacheStorage.CacheVersion{
 			CollectionName: "occasions",
 			Versions:       []cacheStorage.Version{{Version: "7", TimedTo: trustedTimeParse("2021-01-01 00:00:00", "2006-01-02 15:04:05")}},
 		}),
-		CacheWrapper{Id: testCollectionName, Ver: "1"}.AddData(cacheStorage.CacheVersion{
+		mustAddData(CacheWrapper{Id: testCollectionName, Ver: "1"}, cacheStorage.CacheVersion{
 			CollectionName: testCollectionName,
 			Versions:       []cacheStorage.Version{{Version: "4", TimedTo: trustedTimeParse("2021-01-01 00:00:00", "2006-01-02 15:04:05")}},
 		}),
@@ -113,9 +128,11 @@ func TestMain(m *testing.M) {
 		if err := initTestCollection(host); err != nil {
 			return err
 		}
+		testHost = host
 		cache = NewMongoDbCacheStorage()
-		ctx, _ := context.WithTimeout(context.Background(), 10*time.Second)
-		err := cache.Connect(ctx, host, "test")
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		err := cache.Connect(ctx, host, "", "", "test")
 		return err
 	}); err != nil {
 		log.Fatalf("Could not connect to docker: %s", err)
@@ -131,45 +148,26 @@ func TestMain(m *testing.M) {
 	os.Exit(code)
 }
 
-func TestGetLatestVersions(t *testing.T) {
-	cacheGetter, _ := cache.GetCacheStorageClient()
-	Convey("Getting cache versions", t, func() {
-		versions, err := cacheGetter.GetLatestVersions(context.TODO())
-		So(err, ShouldBeNil)
-		So(len(versions), ShouldEqual, 4)
-	})
-}
-
-func TestGetLatestCollectionVersion(t *testing.T) {
-	cacheGetter, _ := cache.GetCacheStorageClient()
-	Convey("Getting stores latest cache versions", t, func() {
-		version, err := cacheGetter.GetLatestCollectionVersion(context.TODO(), "stores")
-		So(err, ShouldBeNil)
-		So(version.CollectionName, ShouldEqual, "stores")
-		So(version.Versions[0].Version, ShouldEqual, "2")
+func TestConformance(t *testing.T) {
+	cacheStoragetest.RunConformance(t, func(t *testing.T, options ...cacheStorage.StorageOption) cacheStorage.CacheStorage {
+		testDatabases++
+		database := fmt.Sprintf("conformance%d", testDatabases)
+		cache := NewMongoDbCacheStorage(options...)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := cache.Connect(ctx, testHost, "", "", database); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			cache.Close(context.TODO())
+		})
+		return cache
 	})
 }
 
 func TestGetById(t *testing.T) {
 	cacheGetter, _ := cache.GetCacheStorageClient()
 	var testCatalogItem TestCatalogItem
-	Convey("Getting test item by ID = 1 and non pointer dest", t, func() {
-		err := cacheGetter.GetById(context.TODO(), testCollectionName, "1", testVersion, testCatalogItem)
-		So(err, ShouldNotBeNil)
-		So(err.IsInvalidDestType(), ShouldBeTrue)
-	})
-	Convey("Getting existing test item by ID = 1", t, func() {
-		err := cacheGetter.GetById(context.TODO(), testCollectionName, "1", testVersion, &testCatalogItem)
-		So(err, ShouldBeNil)
-		So(testCatalogItem.Id, ShouldEqual, testCatalogItem1.Id)
-		So(testCatalogItem.Name, ShouldEqual, testCatalogItem1.Name)
-		So(testCatalogItem.Price, ShouldEqual, testCatalogItem1.Price)
-	})
-	Convey("Getting non existent test item by ID = 9", t, func() {
-		err := cacheGetter.GetById(context.TODO(), testCollectionName, "9", testVersion, &testCatalogItem)
-		So(err, ShouldNotBeNil)
-		So(err.IsNotFound(), ShouldBeTrue)
-	})
 	Convey("Getting latest version of an item by ID = 5", t, func() {
 		err := cacheGetter.GetById(context.TODO(), testCollectionName, "5", Latest, &testCatalogItem)
 		So(err, ShouldBeNil)
@@ -178,158 +176,47 @@ func TestGetById(t *testing.T) {
 	})
 }
 
-func TestGetManyByIds(t *testing.T) {
-	cacheGetter, _ := cache.GetCacheStorageClient()
-	var testCatalogItem TestCatalogItem
-	Convey("Getting test item by ID = 1, 2, 3 and non map dest", t, func() {
-		err := cacheGetter.GetManyByIds(context.TODO(), testCollectionName, []string{"1"}, testVersion, &testCatalogItem)
-		So(err, ShouldNotBeNil)
-		So(err.IsInvalidDestType(), ShouldBeTrue)
-	})
-
-	Convey("Getting 3 existing test items by ID = 1, 2, 3", t, func() {
-		testCatalogItems := make(map[string]TestCatalogItem)
-		err := cacheGetter.GetManyByIds(context.TODO(), testCollectionName, []string{"1", "2", "3"}, testVersion, testCatalogItems)
-		So(err, ShouldBeNil)
-		So(len(testCatalogItems), ShouldEqual, 3)
-		So(testCatalogItems["1"].Id, ShouldEqual, testCatalogItem1.Id)
-		So(testCatalogItems["1"].Name, ShouldEqual, testCatalogItem1.Name)
-		So(testCatalogItems["1"].Price, ShouldEqual, testCatalogItem1.Price)
-	})
-
-	Convey("Getting 2 existing test items by ID = 1, 2 and one non existent item by ID = 9", t, func() {
-		testCatalogItems := make(map[string]TestCatalogItem)
-		err := cacheGetter.GetManyByIds(context.TODO(), testCollectionName, []string{"1", "2", "9"}, testVersion, testCatalogItems)
-		So(err, ShouldNotBeNil)
-		So(err.IsNotFound(), ShouldBeTrue)
-		So(len(testCatalogItems), ShouldEqual, 2)
-	})
-
-	Convey("Getting list of existing items with duplicates", t, func() {
-		testCatalogItems := make(map[string]TestCatalogItem)
-		err := cacheGetter.GetManyByIds(context.TODO(), testCollectionName, []string{"1", "1", "2"}, testVersion, testCatalogItems)
-		So(err, ShouldBeNil)
-		So(len(testCatalogItems), ShouldEqual, 2)
-	})
-}
-
-func TestGetAll(t *testing.T) {
-	testCatalogItems := make(map[string]TestCatalogItem)
-
-	cacheGetter, _ := cache.GetCacheStorageClient()
-	Convey("Getting all items from the test collection", t, func() {
-		err := cacheGetter.GetAll(context.TODO(), testCollectionName, testVersion, testCatalogItems)
-		So(err, ShouldBeNil)
-		So(len(testCatalogItems), ShouldEqual, 4)
-		So(testCatalogItems["1"].Id, ShouldEqual, testCatalogItem1.Id)
-		So(testCatalogItems["1"].Name, ShouldEqual, testCatalogItem1.Name)
-		So(testCatalogItems["1"].Price, ShouldEqual, testCatalogItem1.Price)
-	})
-}
-
-func TestInsert(t *testing.T) {
-	cacheGetter, cacheSetter := cache.GetCacheStorageClient()
-	testCatalogItem := TestCatalogItem{Id: "5", Name: "Item5", Price: 50.60}
-	Convey("Inserting test item with ID = 5", t, func() {
-		err := cacheSetter.Insert(context.TODO(), testCollectionName, "5", testVersion, testCatalogItem)
-		So(err, ShouldBeNil)
-	})
-
-	var insertedItem TestCatalogItem
-	Convey("Getting inserted test item with ID = 5", t, func() {
-		cacheGetter.GetById(context.TODO(), testCollectionName, "5", testVersion, &insertedItem)
-		So(insertedItem.Id, ShouldEqual, testCatalogItem.Id)
-		So(insertedItem.Name, ShouldEqual, testCatalogItem.Name)
-		So(insertedItem.Price, ShouldEqual, testCatalogItem.Price)
-	})
-}
-
-func TestInsertMany(t *testing.T) {
-	cacheGetter, cacheSetter := cache.GetCacheStorageClient()
-	testCatalogItems := map[string]interface{}{
-		"6": TestCatalogItem{Id: "6", Name: "Item6", Price: 50.60},
-		"7": TestCatalogItem{Id: "7", Name: "Item7", Price: 50.60},
-		"8": TestCatalogItem{Id: "8", Name: "Item8", Price: 50.60},
+func TestMigrateToDocuments(t *testing.T) {
+	testDatabases++
+	database := fmt.Sprintf("migration%d", testDatabases)
+	connect := func(options ...cacheStorage.StorageOption) cacheStorage.CacheStorage {
+		cache := NewMongoDbCacheStorage(options...)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := cache.Connect(ctx, testHost, "", "", database); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			cache.Close(context.TODO())
+		})
+		return cache
 	}
-	Convey("Inserting test items with ID = 6, 7, 8", t, func() {
-		err := cacheSetter.InsertMany(context.TODO(), testCollectionName, testVersion, testCatalogItems)
-		So(err, ShouldBeNil)
-	})
-	insertedItems := make(map[string]TestCatalogItem)
-	Convey("Getting inserted test items with ID = 6, 7, 8", t, func() {
-		cacheGetter.GetManyByIds(context.TODO(), testCollectionName, []string{"6", "7", "8"}, testVersion, insertedItems)
-		So(len(insertedItems), ShouldEqual, 3)
-	})
-}
-
-func TestUpdate(t *testing.T) {
-	cacheGetter, cacheSetter := cache.GetCacheStorageClient()
-	testCatalogItem1.Name = testCatalogItem1.Name + "!"
-	Convey("Updating existing test item with ID = 1", t, func() {
-		err := cacheSetter.Update(context.TODO(), testCollectionName, "1", testVersion, testCatalogItem1)
-		So(err, ShouldBeNil)
-	})
-
-	Convey("Getting updated test item with ID = 9 and name = Item9!", t, func() {
-		testCatalogItem := TestCatalogItem{}
-		cacheGetter.GetById(context.TODO(), testCollectionName, "1", testVersion, &testCatalogItem)
-		So(testCatalogItem.Id, ShouldEqual, testCatalogItem1.Id)
-		So(testCatalogItem.Name, ShouldEqual, testCatalogItem1.Name)
-		So(testCatalogItem.Price, ShouldEqual, testCatalogItem1.Price)
-	})
-}
-
-func TestInsertOrUpdate(t *testing.T) {
-	cacheGetter, cacheSetter := cache.GetCacheStorageClient()
-	testCatalogItem := TestCatalogItem{Id: "9", Name: "Item9", Price: 99.69}
-	Convey("Inserting or updating non exist test item with ID = 9", t, func() {
-		err := cacheSetter.InsertOrUpdate(context.TODO(), testCollectionName, "9", testVersion, testCatalogItem)
+	_, jsonSetter := connect().GetCacheStorageClient()
+	if err := jsonSetter.InsertMany(context.TODO(), testCollectionName, testVersion, map[string]interface{}{
+		"1": testCatalogItem1,
+		"2": testCatalogItem2,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	storage := connect(cacheStorage.WithCollectionCodec(testCollectionName, cacheStorage.BSONCodec))
+	cacheGetter, cacheSetter := storage.GetCacheStorageClient()
+	Convey("Migrating the items stored as JSON strings", t, func() {
+		So(cacheSetter.Insert(context.TODO(), testCollectionName, "3", testVersion, testCatalogItem3), ShouldBeNil)
+		migrated, err := MigrateToDocuments[TestCatalogItem](context.TODO(), storage, testCollectionName)
 		So(err, ShouldBeNil)
+		So(migrated, ShouldEqual, 2)
+		items := make(map[string]TestCatalogItem)
+		So(cacheGetter.GetAll(context.TODO(), testCollectionName, testVersion, items), ShouldBeNil)
+		So(items, ShouldResemble, map[string]TestCatalogItem{"1": testCatalogItem1, "2": testCatalogItem2, "3": testCatalogItem3})
 	})
-	var insertedItem TestCatalogItem
-	Convey("Getting inserted test item with ID = 9 and name = Item9", t, func() {
-		cacheGetter.GetById(context.TODO(), testCollectionName, "9", testVersion, &insertedItem)
-		So(insertedItem.Id, ShouldEqual, testCatalogItem.Id)
-		So(insertedItem.Name, ShouldEqual, testCatalogItem.Name)
-		So(insertedItem.Price, ShouldEqual, testCatalogItem.Price)
-	})
-
-	testCatalogItem.Name = testCatalogItem.Name + "!"
-	Convey("Inserting or updating exist test item with ID = 9", t, func() {
-		err := cacheSetter.InsertOrUpdate(context.TODO(), testCollectionName, "9", testVersion, testCatalogItem)
+	Convey("Filtering migrated items on the server", t, func() {
+		count, err := storage.(*mongodbCacheStorage).database.Collection(testCollectionName).CountDocuments(context.TODO(), bson.M{"doc.name": testCatalogItem2.Name})
 		So(err, ShouldBeNil)
+		So(count, ShouldEqual, 1)
 	})
-
-	Convey("Getting updated test item with ID = 9 and name = Item9!", t, func() {
-		cacheGetter.GetById(context.TODO(), testCollectionName, "9", testVersion, &insertedItem)
-		So(insertedItem.Id, ShouldEqual, testCatalogItem.Id)
-		So(insertedItem.Name, ShouldEqual, testCatalogItem.Name)
-		So(insertedItem.Price, ShouldEqual, testCatalogItem.Price)
-	})
-}
-
-func TestRemove(t *testing.T) {
-	cacheGetter, cacheSetter := cache.GetCacheStorageClient()
-	Convey("Removing test item with ID = 1", t, func() {
-		err := cacheSetter.Remove(context.TODO(), testCollectionName, "1", testVersion)
-		So(err, ShouldBeNil)
-	})
-	Convey("Getting removed test item with ID = 1", t, func() {
-		insertedItems := make(map[string]TestCatalogItem)
-		cacheGetter.GetManyByIds(context.TODO(), testCollectionName, []string{"1"}, testVersion, insertedItems)
-		So(len(insertedItems), ShouldEqual, 0)
-	})
-}
-
-func TestRemoveAll(t *testing.T) {
-	cacheGetter, cacheSetter := cache.GetCacheStorageClient()
-	Convey("Removing all items", t, func() {
-		err := cacheSetter.RemoveAll(context.TODO(), testCollectionName, testVersion)
+	Convey("Migrating again finds nothing left to migrate", t, func() {
+		migrated, err := MigrateToDocuments[TestCatalogItem](context.TODO(), storage, testCollectionName)
 		So(err, ShouldBeNil)
-	})
-	Convey("Getting all items", t, func() {
-		insertedItems := make(map[string]TestCatalogItem)
-		cacheGetter.GetAll(context.TODO(), testCollectionName, testVersion, insertedItems)
-		So(len(insertedItems), ShouldEqual, 0)
+		So(migrated, ShouldEqual, 0)
 	})
 }
@@ -0,0 +1,81 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"github.com/orchestd/cacheStorage"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+/*
+leasesCollectionName keeps a document for every slot of a named lock, inserted the first time the slot is tried, with
+{_id: {name, slot}, owner, expiresAt, fence}. owner is null while the slot is free.
+*/
+const leasesCollectionName = "_leases"
+
+type leaseSlot struct {
+	Fence int64 `bson:"fence"`
+}
+
+type mongodbLeases struct {
+	storage *mongodbCacheStorage
+}
+
+func (m mongodbLeases) AcquireLease(c context.Context, name string, slots int, owner string) (int64, cacheStorage.CacheStorageError) {
+	leases := m.storage.database.Collection(leasesCollectionName)
+	update := []bson.M{{"$set": bson.M{
+		"owner":     owner,
+		"expiresAt": bson.M{"$add": bson.A{"$$NOW", m.storage.options.Lock.Lease.Milliseconds()}},
+		"fence":     bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$fence", 0}}, 1}},
+	}}}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	for slot := 0; slot < slots; slot++ {
+		filter := bson.M{
+			"_id": bson.D{{Key: "name", Value: name}, {Key: "slot", Value: slot}},
+			"$expr": bson.M{"$or": bson.A{
+				bson.M{"$eq": bson.A{bson.M{"$ifNull": bson.A{"$owner", nil}}, nil}},
+				bson.M{"$lt": bson.A{"$expiresAt", "$$NOW"}},
+			}},
+		}
+		var taken leaseSlot
+		err := leases.FindOneAndUpdate(c, filter, update, opts).Decode(&taken)
+		if mongo.IsDuplicateKeyError(err) {
+			// the slot exists and is held, so the upsert tried to insert it again
+			continue
+		}
+		if err != nil {
+			return 0, NewMongoCacheStorageError(err)
+		}
+		return taken.Fence, nil
+	}
+	return 0, nil
+}
+
+func (m mongodbLeases) ReleaseLease(c context.Context, name string, slots int, owner string) cacheStorage.CacheStorageError {
+	filter := bson.M{"_id.name": name, "_id.slot": bson.M{"$lt": slots}, "owner": owner}
+	_, err := m.storage.database.Collection(leasesCollectionName).UpdateMany(c, filter, bson.M{"$set": bson.M{"owner": nil}})
+	if err != nil {
+		return NewMongoCacheStorageError(err)
+	}
+	return nil
+}
+
+func (m mongodbLeases) RenewLease(c context.Context, name string, slots int, owner string) cacheStorage.CacheStorageError {
+	filter := bson.M{
+		"_id.name": name,
+		"_id.slot": bson.M{"$lt": slots},
+		"owner":    owner,
+		"$expr":    bson.M{"$gte": bson.A{"$expiresAt", "$$NOW"}},
+	}
+	update := []bson.M{{"$set": bson.M{"expiresAt": bson.M{"$add": bson.A{"$$NOW", m.storage.options.Lock.Lease.Milliseconds()}}}}}
+	res, err := m.storage.database.Collection(leasesCollectionName).UpdateOne(c, filter, update)
+	if err != nil {
+		return NewMongoCacheStorageError(err)
+	}
+	if res.MatchedCount == 0 {
+		return NewMongoCacheStorageError(fmt.Errorf("%w: %v", cacheStorage.ErrLockNotHeld, name))
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package cacheStorage
+
+import "time"
+
+// StorageOptions holds what the backends let their users configure besides the connection itself.
+type StorageOptions struct {
+	// Codec encodes the items of every collection without a codec of its own, JSONCodec by default.
+	Codec Codec
+	// CollectionCodecs overrides Codec for the collections it holds.
+	CollectionCodecs map[string]Codec
+	// Compression compresses the items of every collection without a compression of its own, nothing by default.
+	Compression Compression
+	// CollectionCompressions overrides Compression for the collections it holds.
+	CollectionCompressions map[string]Compression
+	// Keys decrypts the items recorded with a key id, and encrypts the items of the collections EncryptionFor selects.
+	Keys KeyProvider
+	// EncryptAll encrypts the items of every collection rather than only those in EncryptedCollections.
+	EncryptAll           bool
+	EncryptedCollections map[string]bool
+	// Lock configures GetAndLockById, DefaultLockOptions by default.
+	Lock LockOptions
+}
+
+type StorageOption func(options *StorageOptions)
+
+// WithCodec encodes the items of every collection with codec, unless the collection has a codec of its own.
+func WithCodec(codec Codec) StorageOption {
+	return func(options *StorageOptions) {
+		options.Codec = codec
+	}
+}
+
+// WithCollectionCodec encodes the items of collection with codec.
+func WithCollectionCodec(collection string, codec Codec) StorageOption {
+	return func(options *StorageOptions) {
+		if options.CollectionCodecs == nil {
+			options.CollectionCodecs = make(map[string]Codec)
+		}
+		options.CollectionCodecs[collection] = codec
+	}
+}
+
+/*
+WithCompression compresses the items of every collection, unless the collection has a compression of its own, with
+compressor once they are encoded, provided their encoding takes at least threshold bytes.
+*/
+func WithCompression(compressor Compressor, threshold int) StorageOption {
+	return func(options *StorageOptions) {
+		options.Compression = Compression{Compressor: compressor, Threshold: threshold}
+	}
+}
+
+// WithCollectionCompression compresses the items of collection with compressor, provided their encoding takes at least
+// threshold bytes. A nil compressor leaves the items of collection uncompressed.
+func WithCollectionCompression(collection string, compressor Compressor, threshold int) StorageOption {
+	return func(options *StorageOptions) {
+		if options.CollectionCompressions == nil {
+			options.CollectionCompressions = make(map[string]Compression)
+		}
+		options.CollectionCompressions[collection] = Compression{Compressor: compressor, Threshold: threshold}
+	}
+}
+
+/*
+WithEncryption encrypts the items of collections, or of every collection when none are given, with AES-GCM under the
+current key of keys once they are encoded and compressed. Items encrypted before are decrypted with the key they were
+encrypted with whether or not their collection is still encrypted.
+*/
+func WithEncryption(keys KeyProvider, collections ...string) StorageOption {
+	return func(options *StorageOptions) {
+		options.Keys = keys
+		if len(collections) == 0 {
+			options.EncryptAll = true
+			return
+		}
+		if options.EncryptedCollections == nil {
+			options.EncryptedCollections = make(map[string]bool)
+		}
+		for _, collection := range collections {
+			options.EncryptedCollections[collection] = true
+		}
+	}
+}
+
+// WithLockLease lets other owners take over items locked for longer than lease. A lease that is not positive keeps
+// the one of DefaultLockOptions.
+func WithLockLease(lease time.Duration) StorageOption {
+	return func(options *StorageOptions) {
+		options.Lock.Lease = lease
+	}
+}
+
+// WithLockWait makes GetAndLockById give up waiting for an item locked by another owner after maxWait. A maxWait that
+// is not positive waits for as long as the context allows.
+func WithLockWait(maxWait time.Duration) StorageOption {
+	return func(options *StorageOptions) {
+		options.Lock.MaxWait = maxWait
+	}
+}
+
+// WithLockBackoff spaces the attempts of GetAndLockById at an item locked by another owner, see Backoff. Bounds that
+// are not positive are taken from DefaultLockOptions.
+func WithLockBackoff(initial, max time.Duration, jitter float64) StorageOption {
+	return func(options *StorageOptions) {
+		options.Lock.Backoff = Backoff{Initial: initial, Max: max, Jitter: jitter}
+	}
+}
+
+// WithGuardedUpdates makes Update and InsertOrUpdate refuse to overwrite locked items, see LockOptions.GuardUpdates.
+func WithGuardedUpdates() StorageOption {
+	return func(options *StorageOptions) {
+		options.Lock.GuardUpdates = true
+	}
+}
+
+// NewStorageOptions applies options over the defaults. Lock options out of their range fall back to DefaultLockOptions.
+func NewStorageOptions(options ...StorageOption) StorageOptions {
+	storageOptions := StorageOptions{Codec: JSONCodec, Lock: DefaultLockOptions}
+	for _, option := range options {
+		option(&storageOptions)
+	}
+	storageOptions.Lock = storageOptions.Lock.orDefaults()
+	return storageOptions
+}
+
+// CodecFor returns the codec the items of collection are encoded with.
+func (o StorageOptions) CodecFor(collection string) Codec {
+	if codec, ok := o.CollectionCodecs[collection]; ok {
+		return codec
+	}
+	if o.Codec == nil {
+		return JSONCodec
+	}
+	return o.Codec
+}
+
+// CompressionFor returns the compression of the items of collection, if they are compressed at all.
+func (o StorageOptions) CompressionFor(collection string) (Compression, bool) {
+	compression, ok := o.CollectionCompressions[collection]
+	if !ok {
+		compression = o.Compression
+	}
+	return compression, compression.Compressor != nil
+}
+
+// EncryptionFor returns the keys the items of collection are encrypted with, if they are encrypted at all.
+func (o StorageOptions) EncryptionFor(collection string) (KeyProvider, bool) {
+	if o.Keys == nil || !(o.EncryptAll || o.EncryptedCollections[collection]) {
+		return nil, false
+	}
+	return o.Keys, true
+}
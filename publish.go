@@ -0,0 +1,110 @@
+package cacheStorage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrVersionAlreadyPublished = errors.New("Version already published")
+var ErrVersionActive = errors.New("Version is active")
+var ErrInvalidCacheVersion = errors.New("Invalid cache version")
+var ErrDependencyVersionMissing = errors.New("Version missing from a dependency")
+
+// UpdateCacheVersion calls the UpdateCacheVersion of setter, failing with ErrNotSupported when setter is not a
+// CacheVersionUpdater.
+func UpdateCacheVersion(c context.Context, setter CacheStorageSetter, collection string, update func(cacheVersion *CacheVersion) error) CacheStorageError {
+	updater, ok := setter.(CacheVersionUpdater)
+	if !ok {
+		return NewCacheStorageError(fmt.Errorf("%w: %T can't update the cache version of collection %v", ErrNotSupported, setter, collection))
+	}
+	return updater.UpdateCacheVersion(c, collection, update)
+}
+
+/*
+PublishVersion schedules version of collection to become active at activateAt, appending it to the collection's
+cacheVersions entry, which is created on the first publish. An activateAt in the past activates the version right
+away. The LockVersionUpon and CacheType of the entry are kept as they are.
+
+A collection locking its version upon others only takes a version every one of them already published, failing with
+ErrDependencyVersionMissing otherwise. The entries of the dependencies are read once before the update, which checks
+them against the LockVersionUpon it finds; the backends update a single entry at a time, so a dependency unpublishing
+version right after is not caught. Checking dependencies needs setter to be a CacheStorageGetter as well, which the
+setters of every backend here are.
+*/
+func PublishVersion(c context.Context, setter CacheStorageSetter, collection string, version string, activateAt time.Time) CacheStorageError {
+	if version == "" {
+		return NewCacheStorageError(fmt.Errorf("%w: version of collection %v must not be empty", ErrInvalidCacheVersion, collection))
+	}
+	var cacheVersions []CacheVersion
+	getter, canGet := setter.(CacheStorageGetter)
+	if canGet {
+		var err CacheStorageError
+		if cacheVersions, err = getter.GetLatestVersions(c); err != nil {
+			return err
+		}
+	}
+	return UpdateCacheVersion(c, setter, collection, func(cacheVersion *CacheVersion) error {
+		if i, ok := findVersion(cacheVersion, version); ok {
+			timedTo := cacheVersion.Versions[i].TimedTo
+			return fmt.Errorf("%w: version %v of collection %v is timed to %v", ErrVersionAlreadyPublished, version, collection, timedTo)
+		}
+		if len(cacheVersion.LockVersionUpon) > 0 && !canGet {
+			return fmt.Errorf("%w: %T can't read the dependencies of collection %v", ErrNotSupported, setter, collection)
+		}
+		for _, dependency := range cacheVersion.LockVersionUpon {
+			if !publishedBy(cacheVersions, dependency, version) {
+				return fmt.Errorf("%w: collection %v locks its version upon %v, which did not publish version %v", ErrDependencyVersionMissing, collection, dependency, version)
+			}
+		}
+		cacheVersion.Versions = append(cacheVersion.Versions, Version{Version: version, TimedTo: activateAt})
+		return nil
+	})
+}
+
+// publishedBy tells whether the entry of collection among cacheVersions holds version.
+func publishedBy(cacheVersions []CacheVersion, collection string, version string) bool {
+	for i := range cacheVersions {
+		if cacheVersions[i].CollectionName == collection {
+			_, ok := findVersion(&cacheVersions[i], version)
+			return ok
+		}
+	}
+	return false
+}
+
+// UnpublishVersion removes version from the schedule of collection. The version active right now can't be removed.
+func UnpublishVersion(c context.Context, setter CacheStorageSetter, collection string, version string) CacheStorageError {
+	return UpdateCacheVersion(c, setter, collection, func(cacheVersion *CacheVersion) error {
+		if active, ok := cacheVersion.ActiveVersion(time.Now()); ok && active.Version == version {
+			return fmt.Errorf("%w: version %v of collection %v", ErrVersionActive, version, collection)
+		}
+		versions := cacheVersion.Versions[:0]
+		for _, published := range cacheVersion.Versions {
+			if published.Version != version {
+				versions = append(versions, published)
+			}
+		}
+		if len(versions) == len(cacheVersion.Versions) {
+			return versionNotPublished(collection, version)
+		}
+		cacheVersion.Versions = versions
+		return nil
+	})
+}
+
+// SetCacheVersionOptions sets the collections the versions of collection are locked upon and its cache type, keeping
+// its published versions.
+func SetCacheVersionOptions(c context.Context, setter CacheStorageSetter, collection string, lockVersionUpon []string, cacheType string) CacheStorageError {
+	for _, dependency := range lockVersionUpon {
+		if dependency == collection {
+			return NewCacheStorageError(fmt.Errorf("%w: collection %v can't lock its version upon itself", ErrInvalidCacheVersion, collection))
+		}
+	}
+	return UpdateCacheVersion(c, setter, collection, func(cacheVersion *CacheVersion) error {
+		cacheVersion.LockVersionUpon = append([]string(nil), lockVersionUpon...)
+		cacheVersion.CacheType = cacheType
+		return nil
+	})
+}
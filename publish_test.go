@@ -0,0 +1,114 @@
+package cacheStorage_test
+
+import (
+	"context"
+	"errors"
+	"github.com/orchestd/cacheStorage"
+	"github.com/orchestd/cacheStorage/memory"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func newTestSetter(t *testing.T) (cacheStorage.CacheStorageGetter, cacheStorage.CacheStorageSetter) {
+	cache := memory.NewMemoryCacheStorage()
+	if err := cache.Connect(context.TODO(), "", "", "", "test"); err != nil {
+		t.Fatal(err)
+	}
+	return cache.GetCacheStorageClient()
+}
+
+// basicSetter hides the optional methods of the setter it wraps, like the setters of external backends.
+type basicSetter struct {
+	cacheStorage.CacheStorageSetter
+}
+
+// basicGetter hides the optional methods of the getter it wraps.
+type basicGetter struct {
+	cacheStorage.CacheStorageGetter
+}
+
+func TestPublishVersion(t *testing.T) {
+	getter, setter := newTestSetter(t)
+	now := time.Now()
+	Convey("Publishing the first version of a collection", t, func() {
+		So(cacheStorage.PublishVersion(context.TODO(), setter, "catalog", "1", now.Add(-time.Hour)), ShouldBeNil)
+		active, err := cacheStorage.GetActiveVersion(context.TODO(), getter, "catalog", now)
+		So(err, ShouldBeNil)
+		So(active.Version, ShouldEqual, "1")
+	})
+	Convey("Publishing a version scheduled for the future", t, func() {
+		So(cacheStorage.SetCacheVersionOptions(context.TODO(), setter, "catalog", []string{"stores"}, "local"), ShouldBeNil)
+		So(cacheStorage.PublishVersion(context.TODO(), setter, "stores", "2", now.Add(time.Hour)), ShouldBeNil)
+		So(cacheStorage.PublishVersion(context.TODO(), setter, "catalog", "2", now.Add(time.Hour)), ShouldBeNil)
+		cacheVersion, err := getter.GetLatestCollectionVersion(context.TODO(), "catalog")
+		So(err, ShouldBeNil)
+		So(len(cacheVersion.Versions), ShouldEqual, 2)
+		So(cacheVersion.LockVersionUpon, ShouldResemble, []string{"stores"})
+		So(cacheVersion.CacheType, ShouldEqual, "local")
+		active, _ := cacheVersion.ActiveVersion(now)
+		So(active.Version, ShouldEqual, "1")
+	})
+	Convey("Publishing a version twice", t, func() {
+		err := cacheStorage.PublishVersion(context.TODO(), setter, "catalog", "2", now)
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, cacheStorage.ErrVersionAlreadyPublished.Error())
+	})
+	Convey("Publishing an empty version", t, func() {
+		So(cacheStorage.PublishVersion(context.TODO(), setter, "catalog", "", now), ShouldNotBeNil)
+	})
+	Convey("Publishing a version a dependency did not publish", t, func() {
+		err := cacheStorage.PublishVersion(context.TODO(), setter, "catalog", "3", now.Add(2*time.Hour))
+		So(err, ShouldNotBeNil)
+		So(errors.Is(err, cacheStorage.ErrDependencyVersionMissing), ShouldBeTrue)
+		cacheVersion, _ := getter.GetLatestCollectionVersion(context.TODO(), "catalog")
+		So(len(cacheVersion.Versions), ShouldEqual, 2)
+	})
+	Convey("Publishing a version locked upon a collection without any", t, func() {
+		So(cacheStorage.SetCacheVersionOptions(context.TODO(), setter, "catalog", []string{"stores", "prices"}, "local"), ShouldBeNil)
+		So(cacheStorage.PublishVersion(context.TODO(), setter, "stores", "3", now.Add(2*time.Hour)), ShouldBeNil)
+		err := cacheStorage.PublishVersion(context.TODO(), setter, "catalog", "3", now.Add(2*time.Hour))
+		So(errors.Is(err, cacheStorage.ErrDependencyVersionMissing), ShouldBeTrue)
+		So(cacheStorage.PublishVersion(context.TODO(), setter, "prices", "3", now.Add(2*time.Hour)), ShouldBeNil)
+		So(cacheStorage.PublishVersion(context.TODO(), setter, "catalog", "3", now.Add(2*time.Hour)), ShouldBeNil)
+	})
+}
+
+func TestUnpublishVersion(t *testing.T) {
+	getter, setter := newTestSetter(t)
+	now := time.Now()
+	Convey("Unpublishing a scheduled version", t, func() {
+		So(cacheStorage.PublishVersion(context.TODO(), setter, "catalog", "1", now.Add(-time.Hour)), ShouldBeNil)
+		So(cacheStorage.PublishVersion(context.TODO(), setter, "catalog", "2", now.Add(time.Hour)), ShouldBeNil)
+		So(cacheStorage.UnpublishVersion(context.TODO(), setter, "catalog", "2"), ShouldBeNil)
+		cacheVersion, err := getter.GetLatestCollectionVersion(context.TODO(), "catalog")
+		So(err, ShouldBeNil)
+		So(len(cacheVersion.Versions), ShouldEqual, 1)
+	})
+	Convey("Unpublishing the active version", t, func() {
+		So(cacheStorage.UnpublishVersion(context.TODO(), setter, "catalog", "1"), ShouldNotBeNil)
+	})
+	Convey("Unpublishing a version never published", t, func() {
+		err := cacheStorage.UnpublishVersion(context.TODO(), setter, "catalog", "9")
+		So(err, ShouldNotBeNil)
+		So(err.IsNotFound(), ShouldBeTrue)
+	})
+}
+
+func TestUpdateCacheVersionNotSupported(t *testing.T) {
+	_, setter := newTestSetter(t)
+	Convey("Publishing through a setter that can't update cache versions", t, func() {
+		err := cacheStorage.PublishVersion(context.TODO(), basicSetter{setter}, "catalog", "1", time.Now())
+		So(err, ShouldNotBeNil)
+		So(errors.Is(err, cacheStorage.ErrNotSupported), ShouldBeTrue)
+	})
+}
+
+func TestGetStoredVersionsNotSupported(t *testing.T) {
+	getter, _ := newTestSetter(t)
+	Convey("Listing the stored versions through a getter that can't list them", t, func() {
+		_, err := cacheStorage.GetStoredVersions(context.TODO(), basicGetter{getter}, "catalog")
+		So(err, ShouldNotBeNil)
+		So(errors.Is(err, cacheStorage.ErrNotSupported), ShouldBeTrue)
+	})
+}
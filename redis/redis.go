@@ -0,0 +1,149 @@
+package redis
+
+import (
+	"context"
+	goredis "github.com/go-redis/redis/v8"
+	"github.com/orchestd/cacheStorage"
+	"strings"
+	"sync"
+)
+
+type redisCacheStorage struct {
+	client   *goredis.Client
+	prefix   string
+	options  cacheStorage.StorageOptions
+	releases *releases
+}
+
+// NewRedisCacheStorage returns a CacheStorage kept in redis. Connect takes either a host:port address or a
+// redis:// url as host, and uses database as a prefix for every key it writes.
+func NewRedisCacheStorage(options ...cacheStorage.StorageOption) cacheStorage.CacheStorage {
+	return &redisCacheStorage{options: cacheStorage.NewStorageOptions(options...)}
+}
+
+func (s *redisCacheStorage) Connect(c context.Context, host, userName, userPw, database string) error {
+	opts := &goredis.Options{Addr: host}
+	if strings.Contains(host, "://") {
+		var err error
+		if opts, err = goredis.ParseURL(host); err != nil {
+			return err
+		}
+	}
+	if userName != "" {
+		opts.Username = userName
+	}
+	if userPw != "" {
+		opts.Password = userPw
+	}
+	client := goredis.NewClient(opts)
+	if err := client.Ping(c).Err(); err != nil {
+		client.Close()
+		return err
+	}
+	prefix := escapeKeyPart(database)
+	releases, err := subscribeReleases(c, client, prefix)
+	if err != nil {
+		client.Close()
+		return err
+	}
+	s.client = client
+	s.prefix = prefix
+	s.releases = releases
+	return nil
+}
+
+func (s redisCacheStorage) Close(c context.Context) error {
+	s.releases.sub.Close()
+	return s.client.Close()
+}
+
+func (s *redisCacheStorage) GetCacheStorageClient() (cacheStorage.CacheStorageGetter, cacheStorage.CacheStorageSetter) {
+	client := redisClient{storage: s}
+	return client, client
+}
+
+func (s *redisCacheStorage) GetLocker() *cacheStorage.Locker {
+	return cacheStorage.NewLocker(redisLeases{storage: s}, s.options.Lock)
+}
+
+// key joins the database prefix, the collection and parts into a single redis key. The collection is the key's hash
+// tag, so that every key of a collection falls into the same redis cluster slot and a script may touch them together.
+// Parts are escaped so that ids and versions holding ':', '{' or '}' can't collide with other keys or move the tag.
+func (s *redisCacheStorage) key(collection string, parts ...string) string {
+	escaped := make([]string, len(parts)+2)
+	escaped[0] = s.prefix
+	escaped[1] = "{" + escapeKeyPart(collection) + "}"
+	for i, part := range parts {
+		escaped[i+2] = escapeKeyPart(part)
+	}
+	return strings.Join(escaped, ":")
+}
+
+var keyPartEscaper = strings.NewReplacer(`\`, `\\`, `:`, `\:`, `{`, `\(`, `}`, `\)`)
+
+func escapeKeyPart(part string) string {
+	return keyPartEscaper.Replace(part)
+}
+
+var keyPartUnescaper = strings.NewReplacer(`\\`, `\`, `\:`, `:`, `\(`, `{`, `\)`, `}`)
+
+func unescapeKeyPart(part string) string {
+	return keyPartUnescaper.Replace(part)
+}
+
+var globEscaper = strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`, `]`, `\]`)
+
+// escapeGlob escapes key so it only matches itself in a SCAN or KEYS pattern.
+func escapeGlob(key string) string {
+	return globEscaper.Replace(key)
+}
+
+// releases dispatches the release notifications of every lock of the storage, received over a single subscription, to
+// the GetAndLockById calls waiting on them.
+type releases struct {
+	sub     *goredis.PubSub
+	mu      sync.Mutex
+	waiters map[string]map[chan struct{}]bool
+}
+
+func subscribeReleases(c context.Context, client *goredis.Client, prefix string) (*releases, error) {
+	sub := client.PSubscribe(c, escapeGlob(prefix+":")+"*")
+	if _, err := sub.Receive(c); err != nil {
+		sub.Close()
+		return nil, err
+	}
+	r := &releases{sub: sub, waiters: make(map[string]map[chan struct{}]bool)}
+	go func() {
+		for msg := range sub.Channel() {
+			r.mu.Lock()
+			for released := range r.waiters[msg.Channel] {
+				// a release may come while the previous one is still unread, which tells just as much
+				select {
+				case released <- struct{}{}:
+				default:
+				}
+			}
+			r.mu.Unlock()
+		}
+	}()
+	return r, nil
+}
+
+// wait returns the channel notified whenever lock is released, until the returned func is called.
+func (r *releases) wait(lock string) (<-chan struct{}, func()) {
+	released := make(chan struct{}, 1)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.waiters[lock] == nil {
+		r.waiters[lock] = make(map[chan struct{}]bool)
+	}
+	r.waiters[lock][released] = true
+	return released, func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		delete(r.waiters[lock], released)
+		if len(r.waiters[lock]) == 0 {
+			delete(r.waiters, lock)
+		}
+	}
+}
@@ -0,0 +1,692 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	goredis "github.com/go-redis/redis/v8"
+	. "github.com/orchestd/cacheStorage"
+	"github.com/orchestd/cacheStorage/internal/dest"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const cacheVersionsCollectionName = "cacheVersions"
+
+/*
+Every collection is kept under the following keys, all prefixed by the database and tagged by the collection:
+
+	{<collection>}:d:<id>:<ver>	list of the wrapped items stored under id+ver, in insertion order
+	{<collection>}:v:<ver>		set of the ids stored under ver, used by GetAll and RemoveAll
+	{<collection>}:i:<id>		sorted set of the versions holding id, scored by insertion order
+	{<collection>}:l:<id>		the lock owner of id, expiring after the lock lease
+	{<collection>}:f:<id>		the fence of id, counting the locks taken on it until its last version is removed
+	{<collection>}:seq			the insertion order of the collection
+
+Like a mongo collection without a unique index the same id+ver may hold more than one item; single item operations
+act on the first one. Locks belong to the first item inserted under id in any version, the one mongo would lock.
+
+Scripts only touch the keys passed to them, all of a single collection and so of a single cluster slot. Where a script
+acts on the first version of an id, the caller reads it beforehand and the script returns retryVer when it is no
+longer the first one.
+*/
+const (
+	docsKey    = "d"
+	verIdsKey  = "v"
+	idVersKey  = "i"
+	lockKey    = "l"
+	fenceKey   = "f"
+	seqKey     = "seq"
+	releaseMsg = "released"
+	retryVer   = -2
+)
+
+const luaRelease = `
+local function release(lock)
+	if redis.call('DEL', lock) == 1 then
+		redis.call('PUBLISH', lock, '` + releaseMsg + `')
+	end
+end
+`
+
+const luaInsert = `
+local function insert(docs, verIds, idVers, seq, id, ver, wrap)
+	redis.call('RPUSH', docs, wrap)
+	redis.call('SADD', verIds, id)
+	redis.call('ZADD', idVers, 'NX', redis.call('INCR', seq), ver)
+end
+`
+
+// KEYS: verIds, seq, then docs, idVers of every item. ARGV: ver, then id, wrap of every item.
+var insertScript = goredis.NewScript(luaInsert + `
+for i = 3, #KEYS, 2 do
+	insert(KEYS[i], KEYS[1], KEYS[i + 1], KEYS[2], ARGV[i - 1], ARGV[1], ARGV[i])
+end
+return 1
+`)
+
+// KEYS: docs, verIds, idVers, seq, lock. ARGV: id, ver, wrap, upsert, guard.
+// Returns -1 without writing when guard is set and the item holds a lock.
+var replaceScript = goredis.NewScript(luaRelease + luaInsert + `
+if redis.call('LLEN', KEYS[1]) > 0 then
+	local locked = redis.call('ZRANGE', KEYS[3], 0, 0)[1] == ARGV[2]
+	if locked and ARGV[5] == '1' and redis.call('EXISTS', KEYS[5]) == 1 then
+		return -1
+	end
+	redis.call('LSET', KEYS[1], 0, ARGV[3])
+	if locked then
+		release(KEYS[5])
+	end
+	return 1
+end
+if ARGV[4] ~= '1' then
+	return 0
+end
+insert(KEYS[1], KEYS[2], KEYS[3], KEYS[4], ARGV[1], ARGV[2], ARGV[3])
+return 1
+`)
+
+// KEYS: verIds, then docs, idVers, lock, fence of every id. ARGV: ver, all, then the ids.
+var removeScript = goredis.NewScript(luaRelease + `
+for i = 3, #ARGV do
+	local docs, idVers, lock, fence = KEYS[i * 4 - 10], KEYS[i * 4 - 9], KEYS[i * 4 - 8], KEYS[i * 4 - 7]
+	local first = redis.call('ZRANGE', idVers, 0, 0)[1] == ARGV[1]
+	local removed = true
+	if ARGV[2] == '1' then
+		redis.call('DEL', docs)
+	else
+		removed = redis.call('LPOP', docs)
+	end
+	if removed then
+		if first then
+			release(lock)
+		end
+		if redis.call('LLEN', docs) == 0 then
+			redis.call('SREM', KEYS[1], ARGV[i])
+			redis.call('ZREM', idVers, ARGV[1])
+			if redis.call('EXISTS', idVers) == 0 then
+				redis.call('DEL', fence)
+			end
+		end
+	end
+end
+return 1
+`)
+
+// KEYS: idVers, lock, fence, docs of ver. ARGV: ver, owner, lease in milliseconds.
+// Returns {0} when id does not exist, {1, wrap, fence} once locked by owner, {2} while locked by someone else or
+// {retryVer} when ver is no longer the first version of id.
+var lockScript = goredis.NewScript(`
+local ver = redis.call('ZRANGE', KEYS[1], 0, 0)[1]
+if not ver then
+	return {0}
+end
+if ver ~= ARGV[1] then
+	return {` + strconv.Itoa(retryVer) + `}
+end
+local owner = redis.call('GET', KEYS[2])
+if owner then
+	return {2}
+end
+local wrap = redis.call('LINDEX', KEYS[4], 0)
+if not wrap then
+	return {0}
+end
+redis.call('SET', KEYS[2], ARGV[2], 'PX', ARGV[3])
+return {1, wrap, redis.call('INCR', KEYS[3])}
+`)
+
+// KEYS: lock. ARGV: owner.
+var releaseScript = goredis.NewScript(luaRelease + `
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	release(KEYS[1])
+end
+return 1
+`)
+
+// KEYS: idVers, lock, docs of ver. ARGV: ver, owner, wrap without its ver.
+// Returns 0 without writing when owner does not hold the lock, or retryVer when ver is no longer the first version of id.
+var updateAndReleaseScript = goredis.NewScript(luaRelease + `
+if redis.call('GET', KEYS[2]) ~= ARGV[2] then
+	return 0
+end
+local ver = redis.call('ZRANGE', KEYS[1], 0, 0)[1]
+if not ver then
+	return 0
+end
+if ver ~= ARGV[1] then
+	return ` + strconv.Itoa(retryVer) + `
+end
+if redis.call('LLEN', KEYS[3]) == 0 then
+	return 0
+end
+local wrap = cjson.decode(ARGV[3])
+wrap.ver = ver
+redis.call('LSET', KEYS[3], 0, cjson.encode(wrap))
+release(KEYS[2])
+return 1
+`)
+
+// KEYS: lock. ARGV: owner, lease in milliseconds. Returns 0 when owner does not hold the lock.
+var renewScript = goredis.NewScript(`
+if redis.call('GET', KEYS[1]) ~= ARGV[1] then
+	return 0
+end
+redis.call('PEXPIRE', KEYS[1], ARGV[2])
+return 1
+`)
+
+// KEYS: docs, verIds, idVers, seq. ARGV: id, ver, the expected first wrap of id+ver (empty if none), wrap.
+// Returns 0 without writing when the first wrap under id+ver is not the expected one.
+var compareAndSwapScript = goredis.NewScript(luaInsert + `
+local current = redis.call('LINDEX', KEYS[1], 0)
+if (current or '') ~= ARGV[3] then
+	return 0
+end
+if current then
+	redis.call('LSET', KEYS[1], 0, ARGV[4])
+else
+	insert(KEYS[1], KEYS[2], KEYS[3], KEYS[4], ARGV[1], ARGV[2], ARGV[4])
+end
+return 1
+`)
+
+// KEYS: ids of from ver, ids of to ver, then docs of from ver, docs of to ver, idVers of every id. ARGV: from ver,
+// to ver, then the ids. Returns -1 when to ver already holds items, retryVer when the ids of from ver are not the ones
+// passed, otherwise how many items were moved.
+var moveScript = goredis.NewScript(`
+if redis.call('EXISTS', KEYS[2]) == 1 then
+	return -1
+end
+if redis.call('SCARD', KEYS[1]) ~= #ARGV - 2 then
+	return ` + strconv.Itoa(retryVer) + `
+end
+for i = 3, #ARGV do
+	if redis.call('SISMEMBER', KEYS[1], ARGV[i]) == 0 then
+		return ` + strconv.Itoa(retryVer) + `
+	end
+end
+local moved = 0
+for i = 3, #ARGV do
+	local from, to, idVers = KEYS[i * 3 - 6], KEYS[i * 3 - 5], KEYS[i * 3 - 4]
+	local wraps = redis.call('LRANGE', from, 0, -1)
+	for j, wrapped in ipairs(wraps) do
+		local wrap = cjson.decode(wrapped)
+		wrap.ver = ARGV[2]
+		redis.call('LSET', from, j - 1, cjson.encode(wrap))
+	end
+	redis.call('RENAME', from, to)
+	moved = moved + #wraps
+	local score = redis.call('ZSCORE', idVers, ARGV[1])
+	redis.call('ZREM', idVers, ARGV[1])
+	redis.call('ZADD', idVers, score, ARGV[2])
+end
+if moved > 0 then
+	redis.call('RENAME', KEYS[1], KEYS[2])
+end
+return moved
+`)
+
+type cacheWrapper struct {
+	Id          string `json:"id"`
+	Ver         string `json:"ver"`
+	Data        string `json:"data"`
+	Codec       string `json:"codec,omitempty"`
+	Compression string `json:"compression,omitempty"`
+	KeyId       string `json:"keyId,omitempty"`
+}
+
+type redisClient struct {
+	storage *redisCacheStorage
+}
+
+// unwrap returns the func decoding the wrapped item into its dest, with the keys of the storage when it is encrypted.
+func (m redisClient) unwrap(wrapped string) func(interface{}) error {
+	return func(i interface{}) error {
+		var w cacheWrapper
+		if err := json.Unmarshal([]byte(wrapped), &w); err != nil {
+			return err
+		}
+		return m.storage.options.DecodeText(EncodedItem{Codec: w.Codec, Compression: w.Compression, KeyId: w.KeyId}, w.Data, i)
+	}
+}
+
+// wrap encodes item the way the items of collectionName are configured to be, and wraps it.
+func (m redisClient) wrap(collectionName, id, ver string, item interface{}) (string, error) {
+	encoded, err := m.storage.options.EncodeItem(collectionName, item)
+	if err != nil {
+		return "", err
+	}
+	return wrapEncoded(id, ver, encoded)
+}
+
+func wrapEncoded(id, ver string, encoded EncodedItem) (string, error) {
+	w := cacheWrapper{Id: id, Ver: ver, Data: encoded.Text(), Codec: encoded.Codec, Compression: encoded.Compression, KeyId: encoded.KeyId}
+	b, err := json.Marshal(w)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+func (m redisClient) GetLatestVersions(c context.Context) ([]CacheVersion, CacheStorageError) {
+	cacheVersions := make(map[string]CacheVersion)
+	var versions []CacheVersion
+	err := m.GetAll(c, cacheVersionsCollectionName, "1", cacheVersions)
+	if err != nil {
+		return versions, err
+	}
+	for i := range cacheVersions {
+		versions = append(versions, cacheVersions[i])
+	}
+	return versions, nil
+}
+
+func (m redisClient) GetLatestCollectionVersion(c context.Context, collection string) (CacheVersion, CacheStorageError) {
+	cacheVersion := CacheVersion{}
+	err := m.GetById(c, cacheVersionsCollectionName, collection, "1", &cacheVersion)
+	if err != nil {
+		return cacheVersion, err
+	}
+	return cacheVersion, nil
+}
+
+// GetStoredVersions scans for the ids sets of collectionName's vers, so it reads through every key of the database.
+func (m redisClient) GetStoredVersions(c context.Context, collectionName string) ([]string, CacheStorageError) {
+	prefix := m.storage.key(collectionName, verIdsKey) + ":"
+	var vers []string
+	iter := m.storage.client.Scan(c, 0, escapeGlob(prefix)+"*", 0).Iterator()
+	for iter.Next(c) {
+		vers = append(vers, unescapeKeyPart(strings.TrimPrefix(iter.Val(), prefix)))
+	}
+	if err := iter.Err(); err != nil {
+		return nil, NewCacheStorageError(err)
+	}
+	sort.Strings(vers)
+	return vers, nil
+}
+
+func (m redisClient) GetById(ctx context.Context, collectionName string, id string, ver string, dst interface{}) CacheStorageError {
+	err := dest.Check(dst, true, true, false, false)
+	if err != nil {
+		return NewCacheStorageError(fmt.Errorf("%w: %q", ErrInvalidDestType, err))
+	}
+	wrapped, err := m.storage.client.LIndex(ctx, m.storage.key(collectionName, docsKey, id, ver), 0).Result()
+	if err != nil {
+		if err == goredis.Nil {
+			return NewCacheStorageError(fmt.Errorf("%w: %q", ErrNotFound, err))
+		}
+		return NewCacheStorageError(err)
+	}
+	if err := m.unwrap(wrapped)(dst); err != nil {
+		return NewCacheStorageError(err)
+	}
+	return nil
+}
+
+func (m redisClient) getMany(ctx context.Context, collectionName string, filterByIds []string, ver string, dst interface{}) CacheStorageError {
+	err := dest.Check(dst, false, true, true, false)
+	if err != nil {
+		return NewCacheStorageError(fmt.Errorf("%w: %q", ErrInvalidDestType, err))
+	}
+	ids := filterByIds
+	if len(ids) == 0 {
+		if ids, err = m.storage.client.SMembers(ctx, m.storage.key(collectionName, verIdsKey, ver)).Result(); err != nil {
+			return NewCacheStorageError(err)
+		}
+	}
+	cmds := make([]*goredis.StringSliceCmd, len(ids))
+	_, err = m.storage.client.Pipelined(ctx, func(pipe goredis.Pipeliner) error {
+		for i, id := range ids {
+			cmds[i] = pipe.LRange(ctx, m.storage.key(collectionName, docsKey, id, ver), 0, -1)
+		}
+		return nil
+	})
+	if err != nil {
+		return NewCacheStorageError(err)
+	}
+	foundElementIds := make(map[string]bool)
+	for i, cmd := range cmds {
+		for _, wrapped := range cmd.Val() {
+			if err := dest.SetMapItem(dst, ids[i], m.unwrap(wrapped)); err != nil {
+				return NewCacheStorageError(err)
+			}
+			foundElementIds[ids[i]] = true
+		}
+	}
+	if len(foundElementIds) < len(filterByIds) {
+		var notFoundElements []string
+		for _, id := range filterByIds {
+			if _, ok := foundElementIds[id]; !ok {
+				notFoundElements = append(notFoundElements, id)
+			}
+		}
+		// len == 0 meaning the func got ids with duplicates
+		if len(notFoundElements) > 0 {
+			err := fmt.Errorf("elements with id: %v not found in collection %v by version %v", notFoundElements, collectionName, ver)
+			return NewCacheStorageError(fmt.Errorf("%w: %q", ErrNotFound, err))
+		}
+	}
+	return nil
+}
+
+func (m redisClient) GetManyByIds(ctx context.Context, collectionName string, ids []string, ver string, dst interface{}) CacheStorageError {
+	if len(ids) == 0 {
+		return nil
+	}
+	return m.getMany(ctx, collectionName, ids, ver, dst)
+}
+
+func (m redisClient) GetArrayBySingleId(ctx context.Context, collectionName string, id string, ver string, dst interface{}) CacheStorageError {
+	err := dest.Check(dst, false, true, false, true)
+	if err != nil {
+		return NewCacheStorageError(fmt.Errorf("%w: %q", ErrInvalidDestType, err))
+	}
+	wraps, err := m.storage.client.LRange(ctx, m.storage.key(collectionName, docsKey, id, ver), 0, -1).Result()
+	if err != nil {
+		return NewCacheStorageError(err)
+	}
+	for _, wrapped := range wraps {
+		if err := dest.AppendSliceItem(dst, m.unwrap(wrapped)); err != nil {
+			return NewCacheStorageError(err)
+		}
+	}
+	return nil
+}
+
+func (m redisClient) GetAll(ctx context.Context, collectionName string, ver string, dst interface{}) CacheStorageError {
+	return m.getMany(ctx, collectionName, nil, ver, dst)
+}
+
+func (m redisClient) itemKeys(collectionName, id, ver string) []string {
+	return []string{
+		m.storage.key(collectionName, docsKey, id, ver),
+		m.storage.key(collectionName, verIdsKey, ver),
+		m.storage.key(collectionName, idVersKey, id),
+	}
+}
+
+func (m redisClient) Insert(ctx context.Context, collectionName string, id string, ver string, item interface{}) CacheStorageError {
+	wrapped, err := m.wrap(collectionName, id, ver, item)
+	if err != nil {
+		return NewCacheStorageError(err)
+	}
+	return m.insert(ctx, collectionName, ver, map[string]string{id: wrapped})
+}
+
+// insert appends every wrap to the items of its id+ver in a single script.
+func (m redisClient) insert(ctx context.Context, collectionName string, ver string, wraps map[string]string) CacheStorageError {
+	keys := []string{m.storage.key(collectionName, verIdsKey, ver), m.storage.key(collectionName, seqKey)}
+	args := []interface{}{ver}
+	for id, wrapped := range wraps {
+		keys = append(keys, m.storage.key(collectionName, docsKey, id, ver), m.storage.key(collectionName, idVersKey, id))
+		args = append(args, id, wrapped)
+	}
+	if err := insertScript.Run(ctx, m.storage.client, keys, args...).Err(); err != nil {
+		return NewCacheStorageError(err)
+	}
+	return nil
+}
+
+func (m redisClient) InsertMany(ctx context.Context, collectionName string, ver string, items map[string]interface{}) CacheStorageError {
+	if len(items) == 0 {
+		return nil
+	}
+	encoded, err := m.storage.options.EncodeItems(collectionName, items)
+	if err != nil {
+		return NewCacheStorageError(err)
+	}
+	wraps := make(map[string]string, len(items))
+	for id, item := range encoded {
+		wrapped, err := wrapEncoded(id, ver, item)
+		if err != nil {
+			return NewCacheStorageError(err)
+		}
+		wraps[id] = wrapped
+	}
+	return m.insert(ctx, collectionName, ver, wraps)
+}
+
+func (m redisClient) replace(ctx context.Context, collectionName string, id string, ver string, item interface{}, upsert bool) CacheStorageError {
+	wrapped, err := m.wrap(collectionName, id, ver, item)
+	if err != nil {
+		return NewCacheStorageError(err)
+	}
+	keys := append(m.itemKeys(collectionName, id, ver), m.storage.key(collectionName, seqKey), m.storage.key(collectionName, lockKey, id))
+	upsertArg, guardArg := "0", "0"
+	if upsert {
+		upsertArg = "1"
+	}
+	if m.storage.options.Lock.GuardUpdates {
+		guardArg = "1"
+	}
+	replaced, err := replaceScript.Run(ctx, m.storage.client, keys, id, ver, wrapped, upsertArg, guardArg).Int()
+	if err != nil {
+		return NewCacheStorageError(err)
+	}
+	if replaced == -1 {
+		return NewCacheStorageError(fmt.Errorf("%w: item %v of collection %v is locked by another owner", ErrLockNotHeld, id, collectionName))
+	}
+	return nil
+}
+
+func (m redisClient) InsertOrUpdate(ctx context.Context, collectionName string, id string, ver string, item interface{}) CacheStorageError {
+	return m.replace(ctx, collectionName, id, ver, item, true)
+}
+
+func (m redisClient) Update(ctx context.Context, collectionName string, id string, ver string, item interface{}) CacheStorageError {
+	return m.replace(ctx, collectionName, id, ver, item, false)
+}
+
+func (m redisClient) Remove(ctx context.Context, collectionName string, id string, ver string) CacheStorageError {
+	return m.remove(ctx, collectionName, []string{id}, ver, false)
+}
+
+// remove removes the first item of every id+ver in a single script, or all of them.
+func (m redisClient) remove(ctx context.Context, collectionName string, ids []string, ver string, all bool) CacheStorageError {
+	keys := []string{m.storage.key(collectionName, verIdsKey, ver)}
+	args := []interface{}{ver, "0"}
+	if all {
+		args[1] = "1"
+	}
+	for _, id := range ids {
+		keys = append(keys,
+			m.storage.key(collectionName, docsKey, id, ver),
+			m.storage.key(collectionName, idVersKey, id),
+			m.storage.key(collectionName, lockKey, id),
+			m.storage.key(collectionName, fenceKey, id),
+		)
+		args = append(args, id)
+	}
+	if err := removeScript.Run(ctx, m.storage.client, keys, args...).Err(); err != nil {
+		return NewCacheStorageError(err)
+	}
+	return nil
+}
+
+func (m redisClient) RemoveAll(ctx context.Context, collectionName string, ver string) CacheStorageError {
+	ids, err := m.storage.client.SMembers(ctx, m.storage.key(collectionName, verIdsKey, ver)).Result()
+	if err != nil {
+		return NewCacheStorageError(err)
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	return m.remove(ctx, collectionName, ids, ver, true)
+}
+
+// firstVer returns the version id was first inserted under, which holds the item its lock belongs to.
+func (m redisClient) firstVer(c context.Context, collectionName string, id string) (string, bool, error) {
+	vers, err := m.storage.client.ZRange(c, m.storage.key(collectionName, idVersKey, id), 0, 0).Result()
+	if err != nil || len(vers) == 0 {
+		return "", false, err
+	}
+	return vers[0], true, nil
+}
+
+/*
+GetAndLockById listens to the lock's release notifications, received over the storage's single subscription, before
+trying to take it. While another owner holds the lock it retries after the jittered backoff of the storage's
+LockOptions, waking up early when the holder releases or overwrites the item. A lease running out is not notified, so
+an expired lock is only taken over on the next retry.
+*/
+func (m redisClient) GetAndLockById(c context.Context, collectionName string, id string, dst interface{}) (LockHandle, CacheStorageError) {
+	handle := LockHandle{Collection: collectionName, Id: id, Owner: NewLockOwner()}
+	lock := m.storage.key(collectionName, lockKey, id)
+	released, stop := m.storage.releases.wait(lock)
+	defer stop()
+
+	wait := m.storage.options.Lock.NewLockWait(collectionName, id)
+	for waited := false; ; waited = true {
+		ver, found, err := m.firstVer(c, collectionName, id)
+		var res []interface{}
+		if err == nil && found {
+			keys := []string{m.storage.key(collectionName, idVersKey, id), lock, m.storage.key(collectionName, fenceKey, id), m.storage.key(collectionName, docsKey, id, ver)}
+			res, err = lockScript.Run(c, m.storage.client, keys, ver, handle.Owner, m.storage.options.Lock.Lease.Milliseconds()).Slice()
+		}
+		if err != nil && waited && c.Err() != nil {
+			// c ran out while retrying rather than while waiting, which is still giving up on a held lock
+			return LockHandle{}, NewCacheStorageError(NewLockTimeoutError(collectionName, id, c.Err()))
+		}
+		if err != nil {
+			return LockHandle{}, NewCacheStorageError(err)
+		}
+		if !found || res[0].(int64) == 0 {
+			err := fmt.Errorf("element with id: %v not found in collection %v", id, collectionName)
+			return LockHandle{}, NewCacheStorageError(fmt.Errorf("%w: %q", ErrNotFound, err))
+		}
+		switch res[0].(int64) {
+		case retryVer:
+			continue
+		case 1:
+			if err := m.unwrap(res[1].(string))(dst); err != nil {
+				return LockHandle{}, NewCacheStorageError(err)
+			}
+			handle.Fence = res[2].(int64)
+			return handle, nil
+		}
+		if err := wait.Sleep(c, released); err != nil {
+			return LockHandle{}, NewCacheStorageError(err)
+		}
+	}
+}
+
+/*
+ReleaseLockedById in most cases will do nothing, cause UpdateAndRelease overwrites the item and
+therefore "automatically releases" the item a specific session locked
+*/
+func (m redisClient) ReleaseLockedById(c context.Context, lock LockHandle) CacheStorageError {
+	key := m.storage.key(lock.Collection, lockKey, lock.Id)
+	if err := releaseScript.Run(c, m.storage.client, []string{key}, lock.Owner).Err(); err != nil {
+		return NewCacheStorageError(err)
+	}
+	return nil
+}
+
+func (m redisClient) UpdateAndRelease(c context.Context, lock LockHandle, item interface{}) CacheStorageError {
+	wrapped, err := m.wrap(lock.Collection, lock.Id, "", item)
+	if err != nil {
+		return NewCacheStorageError(err)
+	}
+	for {
+		ver, found, err := m.firstVer(c, lock.Collection, lock.Id)
+		if err != nil {
+			return NewCacheStorageError(err)
+		}
+		if !found {
+			return NewCacheStorageError(fmt.Errorf("%w: item %v of collection %v", ErrLockNotHeld, lock.Id, lock.Collection))
+		}
+		keys := []string{m.storage.key(lock.Collection, idVersKey, lock.Id), m.storage.key(lock.Collection, lockKey, lock.Id), m.storage.key(lock.Collection, docsKey, lock.Id, ver)}
+		updated, err := updateAndReleaseScript.Run(c, m.storage.client, keys, ver, lock.Owner, wrapped).Int()
+		if err != nil {
+			return NewCacheStorageError(err)
+		}
+		if updated == retryVer {
+			continue
+		}
+		if updated == 0 {
+			return NewCacheStorageError(fmt.Errorf("%w: item %v of collection %v", ErrLockNotHeld, lock.Id, lock.Collection))
+		}
+		return nil
+	}
+}
+
+func (m redisClient) RenewLock(c context.Context, lock LockHandle) CacheStorageError {
+	key := m.storage.key(lock.Collection, lockKey, lock.Id)
+	renewed, err := renewScript.Run(c, m.storage.client, []string{key}, lock.Owner, m.storage.options.Lock.Lease.Milliseconds()).Int()
+	if err != nil {
+		return NewCacheStorageError(err)
+	}
+	if renewed == 0 {
+		return NewCacheStorageError(fmt.Errorf("%w: item %v of collection %v", ErrLockNotHeld, lock.Id, lock.Collection))
+	}
+	return nil
+}
+
+/*
+UpdateCacheVersion reads the entry and writes it back with a compare and swap script, which fails when another writer
+changed the entry in between, and then starts over.
+*/
+func (m redisClient) UpdateCacheVersion(c context.Context, collection string, update func(cacheVersion *CacheVersion) error) CacheStorageError {
+	keys := append(m.itemKeys(cacheVersionsCollectionName, collection, "1"), m.storage.key(cacheVersionsCollectionName, seqKey))
+	for {
+		current, err := m.storage.client.LIndex(c, keys[0], 0).Result()
+		if err != nil && err != goredis.Nil {
+			return NewCacheStorageError(err)
+		}
+		cacheVersion := CacheVersion{CollectionName: collection}
+		if err == nil {
+			if err := m.unwrap(current)(&cacheVersion); err != nil {
+				return NewCacheStorageError(err)
+			}
+		}
+		if err := update(&cacheVersion); err != nil {
+			return NewCacheStorageError(err)
+		}
+		wrapped, err := m.wrap(cacheVersionsCollectionName, collection, "1", cacheVersion)
+		if err != nil {
+			return NewCacheStorageError(err)
+		}
+		swapped, err := compareAndSwapScript.Run(c, m.storage.client, keys, collection, "1", current, wrapped).Int()
+		if err != nil {
+			return NewCacheStorageError(err)
+		}
+		if swapped == 1 {
+			return nil
+		}
+	}
+}
+
+/*
+MoveVersion reads the ids of fromVer and passes their keys to a script, which starts over when the ids of fromVer
+changed in between.
+*/
+func (m redisClient) MoveVersion(c context.Context, collectionName string, fromVer string, toVer string) (int, CacheStorageError) {
+	fromIds := m.storage.key(collectionName, verIdsKey, fromVer)
+	moved := retryVer
+	for moved == retryVer {
+		ids, err := m.storage.client.SMembers(c, fromIds).Result()
+		if err != nil {
+			return 0, NewCacheStorageError(err)
+		}
+		keys := []string{fromIds, m.storage.key(collectionName, verIdsKey, toVer)}
+		args := []interface{}{fromVer, toVer}
+		for _, id := range ids {
+			keys = append(keys,
+				m.storage.key(collectionName, docsKey, id, fromVer),
+				m.storage.key(collectionName, docsKey, id, toVer),
+				m.storage.key(collectionName, idVersKey, id),
+			)
+			args = append(args, id)
+		}
+		if moved, err = moveScript.Run(c, m.storage.client, keys, args...).Int(); err != nil {
+			return 0, NewCacheStorageError(err)
+		}
+	}
+	if moved < 0 {
+		err := fmt.Errorf("ver %v of collection %v", toVer, collectionName)
+		return 0, NewCacheStorageError(fmt.Errorf("%w: %q", ErrVerInUse, err))
+	}
+	return moved, nil
+}
@@ -0,0 +1,113 @@
+package redis
+
+import (
+	"context"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/orchestd/cacheStorage"
+	"github.com/orchestd/cacheStorage/cacheStoragetest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConformance(t *testing.T) {
+	cacheStoragetest.RunConformance(t, func(t *testing.T, options ...cacheStorage.StorageOption) cacheStorage.CacheStorage {
+		server, err := miniredis.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(server.Close)
+		// miniredis only expires keys as far as it is fast forwarded, so keep it in step with the clock for lock leases
+		ticker := time.NewTicker(10 * time.Millisecond)
+		done := make(chan struct{})
+		t.Cleanup(func() {
+			ticker.Stop()
+			close(done)
+		})
+		go func() {
+			for {
+				select {
+				case <-done:
+					return
+				case <-ticker.C:
+					server.FastForward(10 * time.Millisecond)
+				}
+			}
+		}()
+		cache := NewRedisCacheStorage(options...)
+		if err := cache.Connect(context.TODO(), server.Addr(), "", "", "test"); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			cache.Close(context.TODO())
+		})
+		return cache
+	})
+}
+
+func TestKeySlot(t *testing.T) {
+	s := &redisCacheStorage{prefix: escapeKeyPart("te{st")}
+	for _, key := range []string{
+		s.key("cat}alog", docsKey, "{1}", "2"),
+		s.key("cat}alog", verIdsKey, "2"),
+		s.key("cat}alog", seqKey),
+	} {
+		start := strings.Index(key, "{")
+		end := strings.Index(key[start+1:], "}")
+		if start < 0 || end < 0 {
+			t.Fatalf("%v has no hash tag", key)
+		}
+		if tag := key[start+1 : start+1+end]; tag != escapeKeyPart("cat}alog") {
+			t.Errorf("%v is tagged by %v", key, tag)
+		}
+	}
+	prefix := s.key("cat}alog", verIdsKey) + ":"
+	if ver := unescapeKeyPart(strings.TrimPrefix(s.key("cat}alog", verIdsKey, "{2}"), prefix)); ver != "{2}" {
+		t.Errorf("unescaped ver %v", ver)
+	}
+}
+
+func TestScriptFlush(t *testing.T) {
+	server, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	cache := NewRedisCacheStorage()
+	if err := cache.Connect(context.TODO(), server.Addr(), "", "", "test"); err != nil {
+		t.Fatal(err)
+	}
+	defer cache.Close(context.TODO())
+	cacheGetter, cacheSetter := cache.GetCacheStorageClient()
+	client := cache.(*redisCacheStorage).client
+
+	// a flush or a failover to a replica drops the scripts loaded so far
+	if err := cacheSetter.InsertMany(context.TODO(), "catalog", "1", map[string]interface{}{"1": "a", "2": "b"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.ScriptFlush(context.TODO()).Err(); err != nil {
+		t.Fatal(err)
+	}
+	if err := cacheSetter.InsertMany(context.TODO(), "catalog", "2", map[string]interface{}{"1": "c", "2": "d"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.ScriptFlush(context.TODO()).Err(); err != nil {
+		t.Fatal(err)
+	}
+	if err := cacheSetter.RemoveAll(context.TODO(), "catalog", "1"); err != nil {
+		t.Fatal(err)
+	}
+	items := make(map[string]string)
+	if err := cacheGetter.GetAll(context.TODO(), "catalog", "1", items); err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 0 {
+		t.Errorf("ver 1 still holds %v", items)
+	}
+	if err := cacheGetter.GetAll(context.TODO(), "catalog", "2", items); err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 2 || items["1"] != "c" || items["2"] != "d" {
+		t.Errorf("ver 2 holds %v", items)
+	}
+}
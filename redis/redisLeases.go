@@ -0,0 +1,94 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	goredis "github.com/go-redis/redis/v8"
+	. "github.com/orchestd/cacheStorage"
+	"strconv"
+)
+
+/*
+Named locks are kept next to the collections, under the following keys prefixed by the database and tagged by the name:
+
+	{<name>}:s:<slot>	the owner of slot of name, expiring after the lock lease
+	{<name>}:n:<slot>	the fence of slot of name
+
+Collections never use these second parts, so a lock may share its name with a collection.
+*/
+const (
+	leaseKey      = "s"
+	leaseFenceKey = "n"
+)
+
+// KEYS: the owner of every slot, then the fence of every slot. ARGV: owner, lease in milliseconds.
+// Returns the fence of the slot taken, or 0.
+var acquireLeaseScript = goredis.NewScript(`
+local slots = #KEYS / 2
+for slot = 1, slots do
+	if redis.call('SET', KEYS[slot], ARGV[1], 'NX', 'PX', ARGV[2]) then
+		return redis.call('INCR', KEYS[slots + slot])
+	end
+end
+return 0
+`)
+
+// KEYS: the owner of every slot. ARGV: owner.
+var releaseLeaseScript = goredis.NewScript(`
+for _, lease in ipairs(KEYS) do
+	if redis.call('GET', lease) == ARGV[1] then
+		redis.call('DEL', lease)
+	end
+end
+return 1
+`)
+
+// KEYS: the owner of every slot. ARGV: owner, lease in milliseconds. Returns 0 when owner holds no slot.
+var renewLeaseScript = goredis.NewScript(`
+for _, lease in ipairs(KEYS) do
+	if redis.call('GET', lease) == ARGV[1] then
+		redis.call('PEXPIRE', lease, ARGV[2])
+		return 1
+	end
+end
+return 0
+`)
+
+type redisLeases struct {
+	storage *redisCacheStorage
+}
+
+// slotKeys returns the keys of every slot of name, kept under part.
+func (m redisLeases) slotKeys(name string, slots int, part string) []string {
+	keys := make([]string, slots)
+	for slot := range keys {
+		keys[slot] = m.storage.key(name, part, strconv.Itoa(slot))
+	}
+	return keys
+}
+
+func (m redisLeases) AcquireLease(c context.Context, name string, slots int, owner string) (int64, CacheStorageError) {
+	fence, err := acquireLeaseScript.Run(c, m.storage.client, append(m.slotKeys(name, slots, leaseKey), m.slotKeys(name, slots, leaseFenceKey)...), owner, m.storage.options.Lock.Lease.Milliseconds()).Int64()
+	if err != nil {
+		return 0, NewCacheStorageError(err)
+	}
+	return fence, nil
+}
+
+func (m redisLeases) ReleaseLease(c context.Context, name string, slots int, owner string) CacheStorageError {
+	if err := releaseLeaseScript.Run(c, m.storage.client, m.slotKeys(name, slots, leaseKey), owner).Err(); err != nil {
+		return NewCacheStorageError(err)
+	}
+	return nil
+}
+
+func (m redisLeases) RenewLease(c context.Context, name string, slots int, owner string) CacheStorageError {
+	renewed, err := renewLeaseScript.Run(c, m.storage.client, m.slotKeys(name, slots, leaseKey), owner, m.storage.options.Lock.Lease.Milliseconds()).Int()
+	if err != nil {
+		return NewCacheStorageError(err)
+	}
+	if renewed == 0 {
+		return NewCacheStorageError(fmt.Errorf("%w: %v", ErrLockNotHeld, name))
+	}
+	return nil
+}
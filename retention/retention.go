@@ -0,0 +1,274 @@
+// Package retention removes the items of cache versions nobody reads anymore, following the cacheVersions schedule.
+package retention
+
+import (
+	"context"
+	"errors"
+	"github.com/orchestd/cacheStorage"
+	"sort"
+	"sync"
+	"time"
+)
+
+const cacheVersionsCollectionName = "cacheVersions"
+
+const defaultInterval = time.Hour
+
+// errUnchanged leaves a cacheVersions entry GC has nothing to drop from unwritten.
+var errUnchanged = errors.New("unchanged")
+
+type Policy struct {
+	// KeepVersions is how many of the versions superseded most recently are kept for rolling back to.
+	KeepVersions int
+	// GracePeriod keeps a superseded version at least this long after it was superseded, so readers that resolved it
+	// just before the switch can finish reading it.
+	GracePeriod time.Duration
+	// Collections limits GC to these collections, it covers every collection in cacheVersions when empty.
+	Collections []string
+}
+
+// Report holds the vers removed from every collection.
+type Report map[string][]string
+
+type Configuration struct {
+	// Interval is how often Run collects, an hour by default.
+	Interval time.Duration
+	// OnReport is called after every pass of Run, with what it removed even if the pass failed halfway.
+	OnReport func(report Report, err error)
+}
+
+type Collector struct {
+	getter cacheStorage.CacheStorageGetter
+	setter cacheStorage.CacheStorageSetter
+	now    func() time.Time
+
+	mu sync.Mutex
+	// seen is when each stored ver that is not in its collection's schedule was first found, by collection and ver.
+	seen map[string]map[string]time.Time
+	// pending holds the vers dropped from the schedule whose items are not all removed yet, by collection.
+	pending map[string]map[string]bool
+}
+
+func NewCollector(getter cacheStorage.CacheStorageGetter, setter cacheStorage.CacheStorageSetter) *Collector {
+	return &Collector{
+		getter:  getter,
+		setter:  setter,
+		now:     time.Now,
+		seen:    make(map[string]map[string]time.Time),
+		pending: make(map[string]map[string]bool),
+	}
+}
+
+/*
+GC removes, from every collection policy covers, the items of the versions that dropped out of use: the ones neither
+active, scheduled, pinned, nor among the KeepVersions versions superseded most recently, once superseded for
+GracePeriod. They are first dropped from the collection's schedule, checking the pin and the schedule as they are at
+that moment, and only then are their items removed, so no reader is sent to a version whose items are gone.
+
+Stored vers that are not in the schedule are removed too: rolled back versions once rolled back for GracePeriod, and
+vers never published, such as abandoned uploads, once GracePeriod has passed since an earlier pass first found them, so
+a single pass never removes an upload in progress. Versions being built by a VersionBuilder are left alone. Those
+sightings are kept by the Collector, so a new Collector waits another GracePeriod before removing unpublished vers.
+Stored vers are only listed on backends whose getter is a StoredVersionsLister. An unpublished ver must be published
+within GracePeriod of its upload, or it may be removed as it is being published.
+*/
+func (gc *Collector) GC(c context.Context, policy Policy) (Report, error) {
+	gc.mu.Lock()
+	defer gc.mu.Unlock()
+	cacheVersions, err := gc.getter.GetLatestVersions(c)
+	if err != nil {
+		return nil, err
+	}
+	collections := policy.Collections
+	if len(collections) == 0 {
+		for _, cacheVersion := range cacheVersions {
+			collections = append(collections, cacheVersion.CollectionName)
+		}
+	}
+	report := make(Report)
+	for _, collection := range collections {
+		if collection == cacheVersionsCollectionName {
+			continue
+		}
+		removed, err := gc.collect(c, cacheVersions, collection, policy)
+		if len(removed) > 0 {
+			report[collection] = removed
+		}
+		if err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
+
+func (gc *Collector) collect(c context.Context, cacheVersions []cacheStorage.CacheVersion, collection string, policy Policy) ([]string, error) {
+	stored, err := cacheStorage.GetStoredVersions(c, gc.getter, collection)
+	if err != nil && !errors.Is(err, cacheStorage.ErrNotSupported) {
+		return nil, err
+	}
+	now := gc.now()
+	seen := gc.seen[collection]
+	pending := gc.pending[collection]
+	if pending == nil {
+		pending = make(map[string]bool)
+		gc.pending[collection] = pending
+	}
+	// vers whose removal failed are retried even where stored vers can't be listed
+	candidates := stored
+	for ver := range pending {
+		if !contains(stored, ver) {
+			candidates = append(candidates, ver)
+		}
+	}
+	var dropped, orphans []string
+	unpublished := make(map[string]time.Time)
+	err = cacheStorage.UpdateCacheVersion(c, gc.setter, collection, func(cacheVersion *cacheStorage.CacheVersion) error {
+		dropped, orphans = nil, nil
+		unpublished = make(map[string]time.Time)
+		kept := gc.kept(current(cacheVersions, *cacheVersion), *cacheVersion, now, policy)
+		scheduled := make(map[string]bool, len(cacheVersion.Versions))
+		versions := cacheVersion.Versions[:0]
+		for _, version := range cacheVersion.Versions {
+			scheduled[version.Version] = true
+			if kept[version.Version] {
+				versions = append(versions, version)
+			} else {
+				dropped = append(dropped, version.Version)
+			}
+		}
+		cacheVersion.Versions = versions
+		rolledBackAt := make(map[string]time.Time, len(cacheVersion.RolledBack))
+		for _, rolledBack := range cacheVersion.RolledBack {
+			rolledBackAt[rolledBack.Version.Version] = rolledBack.RolledBackAt
+		}
+		for _, ver := range candidates {
+			if scheduled[ver] || kept[ver] {
+				continue
+			}
+			if at, ok := rolledBackAt[ver]; ok {
+				if now.Sub(at) >= policy.GracePeriod {
+					orphans = append(orphans, ver)
+				}
+				continue
+			}
+			at, ok := seen[ver]
+			if !ok {
+				at = now
+			}
+			unpublished[ver] = at
+			if pending[ver] || ok && now.Sub(at) >= policy.GracePeriod {
+				orphans = append(orphans, ver)
+			}
+		}
+		if len(dropped) == 0 {
+			return errUnchanged
+		}
+		return nil
+	})
+	// only the vers still unpublished are remembered, a ver published in between starts over once unpublished again
+	gc.seen[collection] = unpublished
+	if err != nil && !errors.Is(err, errUnchanged) {
+		return nil, err
+	}
+	var removed []string
+	for _, ver := range append(dropped, orphans...) {
+		pending[ver] = true
+		if err := gc.setter.RemoveAll(c, collection, ver); err != nil {
+			return removed, err
+		}
+		delete(pending, ver)
+		delete(unpublished, ver)
+		removed = append(removed, ver)
+	}
+	return removed, nil
+}
+
+func contains(vers []string, ver string) bool {
+	for _, v := range vers {
+		if v == ver {
+			return true
+		}
+	}
+	return false
+}
+
+// current returns cacheVersions with the entry of fresh's collection replaced by fresh.
+func current(cacheVersions []cacheStorage.CacheVersion, fresh cacheStorage.CacheVersion) []cacheStorage.CacheVersion {
+	result := make([]cacheStorage.CacheVersion, 0, len(cacheVersions)+1)
+	for _, cacheVersion := range cacheVersions {
+		if cacheVersion.CollectionName != fresh.CollectionName {
+			result = append(result, cacheVersion)
+		}
+	}
+	return append(result, fresh)
+}
+
+// kept returns the versions of cacheVersion readers may still resolve to, or roll back to, at now.
+func (gc *Collector) kept(cacheVersions []cacheStorage.CacheVersion, cacheVersion cacheStorage.CacheVersion, now time.Time, policy Policy) map[string]bool {
+	kept := retained(cacheVersion, now, policy)
+	// a collection locking its version upon others may still be on a version its schedule superseded
+	vers, err := cacheStorage.ResolveCacheVersions(cacheVersions, now, cacheVersion.CollectionName)
+	if err == nil {
+		kept[vers[cacheVersion.CollectionName]] = true
+	} else if len(cacheVersion.LockVersionUpon) > 0 {
+		// there is no telling which version readers resolve to, keep them all
+		for _, version := range cacheVersion.Versions {
+			kept[version.Version] = true
+		}
+	}
+	return kept
+}
+
+// retained returns the versions to keep out of a collection's schedule at now.
+func retained(cacheVersion cacheStorage.CacheVersion, now time.Time, policy Policy) map[string]bool {
+	kept := make(map[string]bool)
+	if cacheVersion.Pin != nil {
+		kept[cacheVersion.Pin.Version] = true
+	}
+	for _, staged := range cacheVersion.Staged {
+		// a committing builder moves its items to the version's own ver before publishing it
+		kept[staged.Ver] = true
+		kept[staged.Version] = true
+	}
+	active, hasActive := cacheVersion.ScheduledVersion(now)
+	var superseded []cacheStorage.Version
+	for _, version := range cacheVersion.Versions {
+		if version.TimedTo.After(now) || (hasActive && version.Version == active.Version) {
+			kept[version.Version] = true
+		} else {
+			superseded = append(superseded, version)
+		}
+	}
+	sort.SliceStable(superseded, func(i, j int) bool {
+		return superseded[i].TimedTo.After(superseded[j].TimedTo)
+	})
+	// every version was superseded when the one timed after it became active
+	supersededAt := active.TimedTo
+	for i, version := range superseded {
+		if i < policy.KeepVersions || now.Sub(supersededAt) < policy.GracePeriod {
+			kept[version.Version] = true
+		}
+		supersededAt = version.TimedTo
+	}
+	return kept
+}
+
+// Run collects every Interval until c is done.
+func (gc *Collector) Run(c context.Context, policy Policy, conf Configuration) {
+	if conf.Interval <= 0 {
+		conf.Interval = defaultInterval
+	}
+	ticker := time.NewTicker(conf.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.Done():
+			return
+		case <-ticker.C:
+			report, err := gc.GC(c, policy)
+			if conf.OnReport != nil {
+				conf.OnReport(report, err)
+			}
+		}
+	}
+}
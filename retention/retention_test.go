@@ -0,0 +1,194 @@
+package retention
+
+import (
+	"context"
+	"github.com/orchestd/cacheStorage"
+	"github.com/orchestd/cacheStorage/memory"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+type TestCatalogItem struct {
+	Id   string
+	Name string
+}
+
+var scheduleStart = time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// newTestCollector stores vers 1 to 5 of catalog, all published an hour apart except 5, which is an upload not
+// published yet, and an unpublished stores collection. The collector's clock is in between versions 3 and 4.
+func newTestCollector(t *testing.T) (*Collector, cacheStorage.CacheStorageGetter) {
+	cache := memory.NewMemoryCacheStorage()
+	if err := cache.Connect(context.TODO(), "", "", "", "test"); err != nil {
+		t.Fatal(err)
+	}
+	getter, setter := cache.GetCacheStorageClient()
+	for i, ver := range []string{"1", "2", "3", "4", "5"} {
+		if err := setter.Insert(context.TODO(), "catalog", "1", ver, TestCatalogItem{Id: "1", Name: ver}); err != nil {
+			t.Fatal(err)
+		}
+		if ver == "5" {
+			continue
+		}
+		activateAt := scheduleStart.Add(time.Duration(i) * time.Hour)
+		if err := cacheStorage.PublishVersion(context.TODO(), setter, "catalog", ver, activateAt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := setter.Insert(context.TODO(), "stores", "1", "1", TestCatalogItem{Id: "1"}); err != nil {
+		t.Fatal(err)
+	}
+	collector := NewCollector(getter, setter)
+	collector.now = func() time.Time { return scheduleStart.Add(150 * time.Minute) }
+	return collector, getter
+}
+
+func TestGC(t *testing.T) {
+	collector, getter := newTestCollector(t)
+	Convey("Collecting without keeping superseded versions", t, func() {
+		report, err := collector.GC(context.TODO(), Policy{})
+		So(err, ShouldBeNil)
+		So(report, ShouldResemble, Report{"catalog": {"1", "2"}})
+		vers, err := cacheStorage.GetStoredVersions(context.TODO(), getter, "catalog")
+		So(err, ShouldBeNil)
+		So(vers, ShouldResemble, []string{"3", "4", "5"})
+		cacheVersion, err := getter.GetLatestCollectionVersion(context.TODO(), "catalog")
+		So(err, ShouldBeNil)
+		So(len(cacheVersion.Versions), ShouldEqual, 2)
+	})
+	Convey("Collecting a collection that was never published", t, func() {
+		report, err := collector.GC(context.TODO(), Policy{Collections: []string{"stores"}})
+		So(err, ShouldBeNil)
+		So(report, ShouldBeEmpty)
+		vers, err := cacheStorage.GetStoredVersions(context.TODO(), getter, "stores")
+		So(err, ShouldBeNil)
+		So(vers, ShouldResemble, []string{"1"})
+	})
+}
+
+func TestGCKeepVersions(t *testing.T) {
+	collector, getter := newTestCollector(t)
+	Convey("Collecting while keeping the last superseded version", t, func() {
+		report, err := collector.GC(context.TODO(), Policy{KeepVersions: 1})
+		So(err, ShouldBeNil)
+		So(report, ShouldResemble, Report{"catalog": {"1"}})
+		vers, _ := cacheStorage.GetStoredVersions(context.TODO(), getter, "catalog")
+		So(vers, ShouldResemble, []string{"2", "3", "4", "5"})
+	})
+}
+
+func TestGCGracePeriod(t *testing.T) {
+	collector, getter := newTestCollector(t)
+	Convey("Collecting keeps versions superseded within the grace period", t, func() {
+		report, err := collector.GC(context.TODO(), Policy{GracePeriod: 45 * time.Minute})
+		So(err, ShouldBeNil)
+		So(report, ShouldResemble, Report{"catalog": {"1"}})
+		vers, _ := cacheStorage.GetStoredVersions(context.TODO(), getter, "catalog")
+		So(vers, ShouldResemble, []string{"2", "3", "4", "5"})
+	})
+}
+
+func TestGCPinned(t *testing.T) {
+	collector, getter := newTestCollector(t)
+	Convey("Collecting a pinned collection keeps both the pinned and the scheduled version", t, func() {
+		So(cacheStorage.PinVersion(context.TODO(), collector.setter, "catalog", "1", "dana", "bad upload"), ShouldBeNil)
+		report, err := collector.GC(context.TODO(), Policy{})
+		So(err, ShouldBeNil)
+		So(report, ShouldResemble, Report{"catalog": {"2"}})
+		vers, _ := cacheStorage.GetStoredVersions(context.TODO(), getter, "catalog")
+		So(vers, ShouldResemble, []string{"1", "3", "4", "5"})
+	})
+}
+
+func TestGCStaged(t *testing.T) {
+	collector, getter := newTestCollector(t)
+	Convey("Collecting leaves versions being built alone", t, func() {
+		builder, err := cacheStorage.OpenVersion(context.TODO(), collector.setter, "catalog", "6")
+		So(err, ShouldBeNil)
+		So(builder.Insert(context.TODO(), "1", TestCatalogItem{Id: "1", Name: "6"}), ShouldBeNil)
+		_, gcErr := collector.GC(context.TODO(), Policy{})
+		So(gcErr, ShouldBeNil)
+		So(builder.Commit(context.TODO(), scheduleStart.Add(4*time.Hour), 1), ShouldBeNil)
+		vers, _ := cacheStorage.GetStoredVersions(context.TODO(), getter, "catalog")
+		So(vers, ShouldResemble, []string{"3", "4", "5", "6"})
+	})
+}
+
+func TestGCUnpublished(t *testing.T) {
+	collector, getter := newTestCollector(t)
+	policy := Policy{GracePeriod: 30 * time.Minute}
+	Convey("Collecting leaves an upload alone the first time it finds it", t, func() {
+		So(collector.setter.InsertMany(context.TODO(), "catalog", "7", map[string]interface{}{
+			"1": TestCatalogItem{Id: "1", Name: "7"},
+			"2": TestCatalogItem{Id: "2", Name: "7"},
+		}), ShouldBeNil)
+		report, err := collector.GC(context.TODO(), policy)
+		So(err, ShouldBeNil)
+		So(report, ShouldResemble, Report{"catalog": {"1", "2"}})
+		items := make(map[string]TestCatalogItem)
+		So(getter.GetAll(context.TODO(), "catalog", "7", items), ShouldBeNil)
+		So(len(items), ShouldEqual, 2)
+	})
+	Convey("Collecting removes vers still unpublished a grace period after they were found", t, func() {
+		So(cacheStorage.PublishVersion(context.TODO(), collector.setter, "catalog", "7", scheduleStart.Add(5*time.Hour)), ShouldBeNil)
+		collector.now = func() time.Time { return scheduleStart.Add(180 * time.Minute) }
+		report, err := collector.GC(context.TODO(), policy)
+		So(err, ShouldBeNil)
+		So(report, ShouldResemble, Report{"catalog": {"5"}})
+		vers, _ := cacheStorage.GetStoredVersions(context.TODO(), getter, "catalog")
+		So(vers, ShouldResemble, []string{"3", "4", "7"})
+	})
+}
+
+func TestGCRolledBack(t *testing.T) {
+	collector, getter := newTestCollector(t)
+	policy := Policy{GracePeriod: 30 * time.Minute}
+	Convey("Collecting keeps a version rolled back within the grace period", t, func() {
+		So(cacheStorage.RollbackVersion(context.TODO(), collector.setter, "catalog", "3", "dana", "bad upload"), ShouldBeNil)
+		report, err := collector.GC(context.TODO(), policy)
+		So(err, ShouldBeNil)
+		So(report, ShouldResemble, Report{"catalog": {"1", "2"}})
+		vers, _ := cacheStorage.GetStoredVersions(context.TODO(), getter, "catalog")
+		So(vers, ShouldResemble, []string{"3", "4", "5"})
+	})
+	Convey("Collecting removes a version rolled back before the grace period", t, func() {
+		collector.now = func() time.Time { return time.Now().Add(time.Hour) }
+		report, err := collector.GC(context.TODO(), policy)
+		So(err, ShouldBeNil)
+		So(report, ShouldResemble, Report{"catalog": {"4", "5"}})
+		vers, _ := cacheStorage.GetStoredVersions(context.TODO(), getter, "catalog")
+		So(vers, ShouldResemble, []string{"3"})
+	})
+}
+
+// staleGetter returns the cache versions as they were before a concurrent change.
+type staleGetter struct {
+	cacheStorage.CacheStorageGetter
+	cacheVersions []cacheStorage.CacheVersion
+}
+
+func (g staleGetter) GetLatestVersions(c context.Context) ([]cacheStorage.CacheVersion, cacheStorage.CacheStorageError) {
+	return g.cacheVersions, nil
+}
+
+func (g staleGetter) GetStoredVersions(c context.Context, collectionName string) ([]string, cacheStorage.CacheStorageError) {
+	return cacheStorage.GetStoredVersions(c, g.CacheStorageGetter, collectionName)
+}
+
+func TestGCPinnedConcurrently(t *testing.T) {
+	collector, getter := newTestCollector(t)
+	Convey("Collecting keeps a version pinned after the cache versions were read", t, func() {
+		cacheVersions, err := getter.GetLatestVersions(context.TODO())
+		So(err, ShouldBeNil)
+		So(cacheStorage.PinVersion(context.TODO(), collector.setter, "catalog", "1", "dana", "bad upload"), ShouldBeNil)
+		collector.getter = staleGetter{CacheStorageGetter: getter, cacheVersions: cacheVersions}
+		report, gcErr := collector.GC(context.TODO(), Policy{})
+		So(gcErr, ShouldBeNil)
+		So(report, ShouldResemble, Report{"catalog": {"2"}})
+		vers, _ := cacheStorage.GetStoredVersions(context.TODO(), getter, "catalog")
+		So(vers, ShouldResemble, []string{"1", "3", "4", "5"})
+		cacheVersion, _ := getter.GetLatestCollectionVersion(context.TODO(), "catalog")
+		So(cacheVersion.Versions[0].Version, ShouldEqual, "1")
+	})
+}
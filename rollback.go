@@ -0,0 +1,86 @@
+package cacheStorage
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+func findVersion(cacheVersion *CacheVersion, version string) (int, bool) {
+	for i, published := range cacheVersion.Versions {
+		if published.Version == version {
+			return i, true
+		}
+	}
+	return -1, false
+}
+
+func versionNotPublished(collection, version string) error {
+	err := fmt.Errorf("version %v of collection %v is not published", version, collection)
+	return fmt.Errorf("%w: %q", ErrNotFound, err)
+}
+
+/*
+PinVersion keeps version of collection active regardless of its schedule, until UnpinVersion is called. The pin is
+part of the collection's CacheVersion, so every reader resolving the active version follows it. version must be
+published, and author, and optionally reason, are kept with the pin.
+*/
+func PinVersion(c context.Context, setter CacheStorageSetter, collection string, version string, author string, reason string) CacheStorageError {
+	if author == "" {
+		return NewCacheStorageError(fmt.Errorf("%w: pinning collection %v requires an author", ErrInvalidCacheVersion, collection))
+	}
+	return UpdateCacheVersion(c, setter, collection, func(cacheVersion *CacheVersion) error {
+		if _, ok := findVersion(cacheVersion, version); !ok {
+			return versionNotPublished(collection, version)
+		}
+		cacheVersion.Pin = &VersionPin{Version: version, Author: author, Reason: reason, PinnedAt: time.Now()}
+		return nil
+	})
+}
+
+// UnpinVersion returns collection to its schedule. It does nothing if the collection is not pinned.
+func UnpinVersion(c context.Context, setter CacheStorageSetter, collection string) CacheStorageError {
+	return UpdateCacheVersion(c, setter, collection, func(cacheVersion *CacheVersion) error {
+		cacheVersion.Pin = nil
+		return nil
+	})
+}
+
+/*
+RollbackVersion makes version of collection, which must have been active before, the scheduled version again. Every
+version that became active after it is taken out of the schedule and kept in the collection's RolledBack with author
+and reason; versions scheduled for the future are left as they are. A pin still overrides the schedule after a
+rollback.
+*/
+func RollbackVersion(c context.Context, setter CacheStorageSetter, collection string, version string, author string, reason string) CacheStorageError {
+	if author == "" {
+		return NewCacheStorageError(fmt.Errorf("%w: rolling back collection %v requires an author", ErrInvalidCacheVersion, collection))
+	}
+	return UpdateCacheVersion(c, setter, collection, func(cacheVersion *CacheVersion) error {
+		now := time.Now()
+		target, ok := findVersion(cacheVersion, version)
+		if !ok {
+			return versionNotPublished(collection, version)
+		}
+		timedTo := cacheVersion.Versions[target].TimedTo
+		if timedTo.After(now) {
+			return fmt.Errorf("%w: version %v of collection %v is timed to %v and was never active", ErrInvalidCacheVersion, version, collection, timedTo)
+		}
+		versions := make([]Version, 0, len(cacheVersion.Versions))
+		for i, published := range cacheVersion.Versions {
+			// a version timed to the same moment but listed after the target wins over it, so it goes too
+			newer := published.TimedTo.After(timedTo) || (published.TimedTo.Equal(timedTo) && i > target)
+			if newer && !published.TimedTo.After(now) {
+				rolledBack := RolledBackVersion{Version: published, Author: author, Reason: reason, RolledBackAt: now}
+				cacheVersion.RolledBack = append(cacheVersion.RolledBack, rolledBack)
+			} else {
+				versions = append(versions, published)
+			}
+		}
+		if len(versions) == len(cacheVersion.Versions) {
+			return fmt.Errorf("%w: version %v of collection %v is already the scheduled version", ErrInvalidCacheVersion, version, collection)
+		}
+		cacheVersion.Versions = versions
+		return nil
+	})
+}
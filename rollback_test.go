@@ -0,0 +1,75 @@
+package cacheStorage_test
+
+import (
+	"context"
+	"github.com/orchestd/cacheStorage"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func publishTestVersions(t *testing.T, setter cacheStorage.CacheStorageSetter, now time.Time) {
+	for i, version := range []string{"1", "2", "3"} {
+		if err := cacheStorage.PublishVersion(context.TODO(), setter, "catalog", version, now.Add(time.Duration(i-2)*time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := cacheStorage.PublishVersion(context.TODO(), setter, "catalog", "4", now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPinVersion(t *testing.T) {
+	getter, setter := newTestSetter(t)
+	now := time.Now()
+	publishTestVersions(t, setter, now)
+	Convey("Pinning a collection to a superseded version", t, func() {
+		So(cacheStorage.PinVersion(context.TODO(), setter, "catalog", "1", "dana", "bad upload"), ShouldBeNil)
+		cacheVersion, err := getter.GetLatestCollectionVersion(context.TODO(), "catalog")
+		So(err, ShouldBeNil)
+		So(cacheVersion.Pin.Author, ShouldEqual, "dana")
+		So(cacheVersion.Pin.Reason, ShouldEqual, "bad upload")
+		active, err := cacheStorage.GetActiveVersion(context.TODO(), getter, "catalog", now.Add(2*time.Hour))
+		So(err, ShouldBeNil)
+		So(active.Version, ShouldEqual, "1")
+	})
+	Convey("Pinning a collection to a version never published", t, func() {
+		err := cacheStorage.PinVersion(context.TODO(), setter, "catalog", "9", "dana", "")
+		So(err, ShouldNotBeNil)
+		So(err.IsNotFound(), ShouldBeTrue)
+	})
+	Convey("Pinning a collection without an author", t, func() {
+		So(cacheStorage.PinVersion(context.TODO(), setter, "catalog", "2", "", ""), ShouldNotBeNil)
+	})
+	Convey("Unpinning a collection returns it to its schedule", t, func() {
+		So(cacheStorage.UnpinVersion(context.TODO(), setter, "catalog"), ShouldBeNil)
+		active, err := cacheStorage.GetActiveVersion(context.TODO(), getter, "catalog", now)
+		So(err, ShouldBeNil)
+		So(active.Version, ShouldEqual, "3")
+	})
+}
+
+func TestRollbackVersion(t *testing.T) {
+	getter, setter := newTestSetter(t)
+	now := time.Now()
+	publishTestVersions(t, setter, now)
+	Convey("Rolling back to a superseded version", t, func() {
+		So(cacheStorage.RollbackVersion(context.TODO(), setter, "catalog", "1", "dana", "bad upload"), ShouldBeNil)
+		cacheVersion, err := getter.GetLatestCollectionVersion(context.TODO(), "catalog")
+		So(err, ShouldBeNil)
+		active, _ := cacheVersion.ActiveVersion(time.Now())
+		So(active.Version, ShouldEqual, "1")
+		So(len(cacheVersion.Versions), ShouldEqual, 2)
+		So(len(cacheVersion.RolledBack), ShouldEqual, 2)
+		So(cacheVersion.RolledBack[0].Author, ShouldEqual, "dana")
+		next, ok := cacheVersion.NextSwitch(time.Now())
+		So(ok, ShouldBeTrue)
+		So(next.Version, ShouldEqual, "4")
+	})
+	Convey("Rolling back to the scheduled version", t, func() {
+		So(cacheStorage.RollbackVersion(context.TODO(), setter, "catalog", "1", "dana", ""), ShouldNotBeNil)
+	})
+	Convey("Rolling back to a version that was never active", t, func() {
+		So(cacheStorage.RollbackVersion(context.TODO(), setter, "catalog", "4", "dana", ""), ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,226 @@
+// Package snapshot keeps the active version of whole collections in memory and swaps to a new version as soon as the
+// cacheVersions schedule activates it.
+package snapshot
+
+import (
+	"context"
+	"fmt"
+	"github.com/orchestd/cacheStorage"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const defaultPollInterval = 30 * time.Second
+
+// minRefreshWait is the least Run waits between two refreshes, so a switch time already past can't make it spin.
+const minRefreshWait = time.Second
+
+type Collection struct {
+	Name string
+	// Item is a value of the type the items of the collection are decoded into.
+	Item interface{}
+}
+
+type Configuration struct {
+	// PollInterval is how often the cacheVersions collection is checked for a newly active version.
+	PollInterval time.Duration
+	// OnError is called with the errors of background refreshes, which otherwise keep serving the current snapshot.
+	// Failed refreshes are retried after a backoff growing from a second up to PollInterval.
+	OnError func(err error)
+}
+
+type collectionSnapshot struct {
+	version string
+	items   reflect.Value
+}
+
+type snapshot map[string]collectionSnapshot
+
+type Loader struct {
+	getter      cacheStorage.CacheStorageGetter
+	collections []Collection
+	conf        Configuration
+	current     atomic.Value
+	refreshMu   sync.Mutex
+	nextSwitch  time.Time
+	// failures counts the refreshes that failed in a row.
+	failures int
+	now      func() time.Time
+}
+
+func NewLoader(getter cacheStorage.CacheStorageGetter, collections []Collection, conf Configuration) *Loader {
+	if conf.PollInterval <= 0 {
+		conf.PollInterval = defaultPollInterval
+	}
+	l := &Loader{getter: getter, collections: collections, conf: conf, now: time.Now}
+	l.current.Store(snapshot{})
+	return l
+}
+
+func (l *Loader) snapshot() snapshot {
+	return l.current.Load().(snapshot)
+}
+
+/*
+Refresh loads the active version of every collection whose active version differs from the loaded one, and then swaps
+all of them into the served snapshot at once. Versions are resolved together, so collections locking their version upon
+each other switch together. Until the first successful Refresh nothing is served.
+*/
+func (l *Loader) Refresh(c context.Context) error {
+	l.refreshMu.Lock()
+	defer l.refreshMu.Unlock()
+	nextSwitch, err := l.refresh(c)
+	if err != nil {
+		// the switch that was due may be what failed, so it is retried after the backoff rather than right away
+		l.failures++
+		l.nextSwitch = time.Time{}
+		return err
+	}
+	l.failures = 0
+	l.nextSwitch = nextSwitch
+	return nil
+}
+
+// refresh does the work of Refresh and returns when the next loaded collection is scheduled to switch, if any.
+func (l *Loader) refresh(c context.Context) (time.Time, error) {
+	cacheVersions, err := l.getter.GetLatestVersions(c)
+	if err != nil {
+		return time.Time{}, err
+	}
+	now := l.now()
+	names := make([]string, len(l.collections))
+	for i, collection := range l.collections {
+		names[i] = collection.Name
+	}
+	vers, err := cacheStorage.ResolveCacheVersions(cacheVersions, now, names...)
+	if err != nil {
+		return time.Time{}, err
+	}
+	// any collection switching may switch a loaded collection locking its version upon it
+	var nextSwitch time.Time
+	for _, cacheVersion := range cacheVersions {
+		if scheduled, ok := cacheVersion.NextSwitch(now); ok && (nextSwitch.IsZero() || scheduled.TimedTo.Before(nextSwitch)) {
+			nextSwitch = scheduled.TimedTo
+		}
+	}
+
+	current := l.snapshot()
+	next := make(snapshot, len(l.collections))
+	changed := false
+	for _, collection := range l.collections {
+		version := vers[collection.Name]
+		if loaded, ok := current[collection.Name]; ok && loaded.version == version {
+			next[collection.Name] = loaded
+			continue
+		}
+		items := reflect.MakeMap(reflect.MapOf(reflect.TypeOf(""), reflect.TypeOf(collection.Item)))
+		if err := l.getter.GetAll(c, collection.Name, version, items.Interface()); err != nil {
+			return time.Time{}, err
+		}
+		next[collection.Name] = collectionSnapshot{version: version, items: items}
+		changed = true
+	}
+	if changed {
+		l.current.Store(next)
+	}
+	return nextSwitch, nil
+}
+
+// untilRefresh returns how long to wait before the next refresh, which is PollInterval unless a loaded collection is
+// scheduled to switch versions sooner, or the backoff after failed refreshes. It is never less than minRefreshWait.
+func (l *Loader) untilRefresh() time.Duration {
+	l.refreshMu.Lock()
+	defer l.refreshMu.Unlock()
+	if l.failures > 0 {
+		backoff := cacheStorage.Backoff{Initial: minRefreshWait, Max: l.conf.PollInterval, Jitter: 0.2}
+		return maxDuration(backoff.Delay(l.failures-1), minRefreshWait)
+	}
+	wait := l.conf.PollInterval
+	if !l.nextSwitch.IsZero() {
+		if untilSwitch := l.nextSwitch.Sub(l.now()); untilSwitch < wait {
+			wait = untilSwitch
+		}
+	}
+	return maxDuration(wait, minRefreshWait)
+}
+
+func maxDuration(a, b time.Duration) time.Duration {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// Run refreshes the snapshot every PollInterval, and as soon as a loaded collection's next version becomes active,
+// until c is done.
+func (l *Loader) Run(c context.Context) {
+	timer := time.NewTimer(l.untilRefresh())
+	defer timer.Stop()
+	for {
+		select {
+		case <-c.Done():
+			return
+		case <-timer.C:
+			if err := l.Refresh(c); err != nil && l.conf.OnError != nil {
+				l.conf.OnError(err)
+			}
+			timer.Reset(l.untilRefresh())
+		}
+	}
+}
+
+// Version returns the version of collection currently served, or false if it was not loaded yet.
+func (l *Loader) Version(collection string) (string, bool) {
+	loaded, ok := l.snapshot()[collection]
+	return loaded.version, ok
+}
+
+func (l *Loader) collection(collection string) (collectionSnapshot, cacheStorage.CacheStorageError) {
+	loaded, ok := l.snapshot()[collection]
+	if !ok {
+		err := fmt.Errorf("collection %v is not loaded", collection)
+		return loaded, cacheStorage.NewCacheStorageError(fmt.Errorf("%w: %q", cacheStorage.ErrNotFound, err))
+	}
+	return loaded, nil
+}
+
+// GetById copies the item of collection with the given id into dest, which must point to the collection's Item type.
+func (l *Loader) GetById(collection string, id string, dest interface{}) cacheStorage.CacheStorageError {
+	loaded, err := l.collection(collection)
+	if err != nil {
+		return err
+	}
+	destVal := reflect.ValueOf(dest)
+	itemType := loaded.items.Type().Elem()
+	if destVal.Kind() != reflect.Ptr || destVal.IsNil() || destVal.Type().Elem() != itemType {
+		err := fmt.Errorf("dest must be a non nil *%v", itemType)
+		return cacheStorage.NewCacheStorageError(fmt.Errorf("%w: %q", cacheStorage.ErrInvalidDestType, err))
+	}
+	item := loaded.items.MapIndex(reflect.ValueOf(id))
+	if !item.IsValid() {
+		err := fmt.Errorf("element with id: %v not found in collection %v by version %v", id, collection, loaded.version)
+		return cacheStorage.NewCacheStorageError(fmt.Errorf("%w: %q", cacheStorage.ErrNotFound, err))
+	}
+	destVal.Elem().Set(item)
+	return nil
+}
+
+// GetAll copies every item of collection into dest, which must be a map[string] of the collection's Item type.
+func (l *Loader) GetAll(collection string, dest interface{}) cacheStorage.CacheStorageError {
+	loaded, err := l.collection(collection)
+	if err != nil {
+		return err
+	}
+	destMap := reflect.Indirect(reflect.ValueOf(dest))
+	if destMap.Kind() != reflect.Map || destMap.IsNil() || destMap.Type() != loaded.items.Type() {
+		err := fmt.Errorf("dest must be a non nil %v", loaded.items.Type())
+		return cacheStorage.NewCacheStorageError(fmt.Errorf("%w: %q", cacheStorage.ErrInvalidDestType, err))
+	}
+	iter := loaded.items.MapRange()
+	for iter.Next() {
+		destMap.SetMapIndex(iter.Key(), iter.Value())
+	}
+	return nil
+}
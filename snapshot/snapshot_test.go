@@ -0,0 +1,145 @@
+package snapshot
+
+import (
+	"context"
+	"errors"
+	"github.com/orchestd/cacheStorage"
+	"github.com/orchestd/cacheStorage/memory"
+	. "github.com/smartystreets/goconvey/convey"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type TestCatalogItem struct {
+	Id   string
+	Name string
+}
+
+var switchTime = time.Date(2021, 2, 1, 0, 0, 0, 0, time.UTC)
+
+func newTestLoader(t *testing.T) (*Loader, *time.Time) {
+	cache := memory.NewMemoryCacheStorage()
+	if err := cache.Connect(context.TODO(), "", "", "", "test"); err != nil {
+		t.Fatal(err)
+	}
+	_, setter := cache.GetCacheStorageClient()
+	versions := map[string][]TestCatalogItem{
+		"1": {{Id: "1", Name: "Item1"}, {Id: "2", Name: "Item2"}},
+		"2": {{Id: "1", Name: "Item1!"}},
+	}
+	for ver, items := range versions {
+		for _, item := range items {
+			if err := setter.Insert(context.TODO(), "catalog", item.Id, ver, item); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	err := setter.Insert(context.TODO(), "cacheVersions", "catalog", "1", cacheStorage.CacheVersion{
+		CollectionName: "catalog",
+		Versions: []cacheStorage.Version{
+			{Version: "1", TimedTo: switchTime.Add(-time.Hour)},
+			{Version: "2", TimedTo: switchTime},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	getter, _ := cache.GetCacheStorageClient()
+	loader := NewLoader(getter, []Collection{{Name: "catalog", Item: TestCatalogItem{}}}, Configuration{})
+	now := switchTime.Add(-time.Minute)
+	loader.now = func() time.Time { return now }
+	return loader, &now
+}
+
+func TestRefresh(t *testing.T) {
+	loader, now := newTestLoader(t)
+	Convey("Getting an item before the first refresh", t, func() {
+		var item TestCatalogItem
+		err := loader.GetById("catalog", "1", &item)
+		So(err, ShouldNotBeNil)
+		So(err.IsNotFound(), ShouldBeTrue)
+	})
+	Convey("Refreshing loads the version active now", t, func() {
+		So(loader.Refresh(context.TODO()), ShouldBeNil)
+		version, _ := loader.Version("catalog")
+		So(version, ShouldEqual, "1")
+		items := make(map[string]TestCatalogItem)
+		So(loader.GetAll("catalog", items), ShouldBeNil)
+		So(len(items), ShouldEqual, 2)
+	})
+	Convey("The next refresh is due when the next version is timed to if that is before PollInterval", t, func() {
+		So(loader.untilRefresh(), ShouldEqual, defaultPollInterval)
+		loader.conf.PollInterval = time.Hour
+		So(loader.untilRefresh(), ShouldEqual, time.Minute)
+	})
+	Convey("Refreshing after the next version is timed to swaps to it", t, func() {
+		*now = switchTime
+		So(loader.Refresh(context.TODO()), ShouldBeNil)
+		version, _ := loader.Version("catalog")
+		So(version, ShouldEqual, "2")
+		var item TestCatalogItem
+		So(loader.GetById("catalog", "1", &item), ShouldBeNil)
+		So(item.Name, ShouldEqual, "Item1!")
+		err := loader.GetById("catalog", "2", &item)
+		So(err, ShouldNotBeNil)
+		So(err.IsNotFound(), ShouldBeTrue)
+	})
+	Convey("Getting an item into a dest of another type", t, func() {
+		var item string
+		err := loader.GetById("catalog", "1", &item)
+		So(err, ShouldNotBeNil)
+		So(err.IsInvalidDestType(), ShouldBeTrue)
+	})
+}
+
+func TestRefreshBeforeAnyVersionIsActive(t *testing.T) {
+	loader, now := newTestLoader(t)
+	*now = switchTime.Add(-2 * time.Hour)
+	Convey("Refreshing before any version is timed to", t, func() {
+		So(loader.Refresh(context.TODO()), ShouldNotBeNil)
+		_, loaded := loader.Version("catalog")
+		So(loaded, ShouldBeFalse)
+	})
+}
+
+// failingGetter fails GetLatestVersions while fail is set, counting the calls.
+type failingGetter struct {
+	cacheStorage.CacheStorageGetter
+	fail  bool
+	calls int32
+}
+
+func (g *failingGetter) GetLatestVersions(c context.Context) ([]cacheStorage.CacheVersion, cacheStorage.CacheStorageError) {
+	atomic.AddInt32(&g.calls, 1)
+	if g.fail {
+		return nil, cacheStorage.NewCacheStorageError(errors.New("unreachable"))
+	}
+	return g.CacheStorageGetter.GetLatestVersions(c)
+}
+
+func TestRefreshFailing(t *testing.T) {
+	loader, now := newTestLoader(t)
+	getter := &failingGetter{CacheStorageGetter: loader.getter}
+	loader.getter = getter
+	loader.conf.PollInterval = time.Hour
+	var errs int32
+	loader.conf.OnError = func(error) { atomic.AddInt32(&errs, 1) }
+	Convey("Failing refreshes past a due switch back off instead of retrying right away", t, func() {
+		So(loader.Refresh(context.TODO()), ShouldBeNil)
+		*now = switchTime.Add(time.Minute)
+		getter.fail = true
+		atomic.StoreInt32(&getter.calls, 0)
+		So(loader.untilRefresh(), ShouldEqual, minRefreshWait)
+
+		c, cancel := context.WithTimeout(context.Background(), 1500*time.Millisecond)
+		defer cancel()
+		loader.Run(c)
+		calls := atomic.LoadInt32(&getter.calls)
+		So(calls, ShouldBeBetweenOrEqual, 1, 2)
+		So(atomic.LoadInt32(&errs), ShouldEqual, calls)
+		So(loader.untilRefresh(), ShouldBeGreaterThanOrEqualTo, minRefreshWait)
+		version, _ := loader.Version("catalog")
+		So(version, ShouldEqual, "1")
+	})
+}
@@ -0,0 +1,174 @@
+// Package sql keeps the cache in a single table of a database/sql database, with dialects for sqlite and postgres. The
+// conformance tests run on sqlite, and on a postgres started in docker wherever docker is available.
+package sql
+
+import (
+	"context"
+	gosql "database/sql"
+	"fmt"
+	"github.com/orchestd/cacheStorage"
+	"strconv"
+	"strings"
+)
+
+type dialect struct {
+	// seqColumn is the definition of the auto incremented primary key keeping the insertion order.
+	seqColumn string
+	// lockRow is appended to the query selecting the row GetAndLockById is about to lock. It must not skip locked rows,
+	// which would let the query return the next row of the same id instead.
+	lockRow string
+	// lockKey takes a transaction scoped lock on a key, serializing the transactions that would otherwise race to insert
+	// the same missing row.
+	lockKey string
+	// singleConn serializes every statement through one connection, for databases that lock the whole file on write.
+	singleConn bool
+	numbered   bool
+}
+
+var postgres = dialect{
+	seqColumn: "BIGSERIAL PRIMARY KEY",
+	lockRow:   " FOR UPDATE",
+	lockKey:   "SELECT pg_advisory_xact_lock(hashtext(?))",
+	numbered:  true,
+}
+
+var sqlite = dialect{
+	seqColumn:  "INTEGER PRIMARY KEY AUTOINCREMENT",
+	singleConn: true,
+}
+
+var dialects = map[string]dialect{
+	"postgres": postgres,
+	"pgx":      postgres,
+	"sqlite3":  sqlite,
+	"sqlite":   sqlite,
+}
+
+// rebind replaces the ? placeholders of query with the ones the dialect expects.
+func (d dialect) rebind(query string) string {
+	if !d.numbered {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+type sqlCacheStorage struct {
+	driverName string
+	dialect    dialect
+	db         *gosql.DB
+	table      string
+	// leasesTable keeps the slots of the named locks of the storage's Locker.
+	leasesTable string
+	options     cacheStorage.StorageOptions
+}
+
+// NewSqlCacheStorage returns a CacheStorage kept in a single table of a database/sql database. driverName must be
+// one of postgres, pgx, sqlite3 or sqlite, and the matching driver must be imported by the caller. Connect takes the
+// data source name as host, with the credentials already in it, and uses database as the table name. The named locks
+// of its Locker are kept in a second table, named database_leases.
+func NewSqlCacheStorage(driverName string, options ...cacheStorage.StorageOption) cacheStorage.CacheStorage {
+	return &sqlCacheStorage{driverName: driverName, options: cacheStorage.NewStorageOptions(options...)}
+}
+
+func (s *sqlCacheStorage) Connect(c context.Context, host, userName, userPw, database string) error {
+	d, ok := dialects[s.driverName]
+	if !ok {
+		return fmt.Errorf("unsupported sql driver %q", s.driverName)
+	}
+	db, err := gosql.Open(s.driverName, host)
+	if err != nil {
+		return err
+	}
+	if d.singleConn {
+		db.SetMaxOpenConns(1)
+	}
+	s.dialect = d
+	s.db = db
+	s.table = quoteIdentifier(database)
+	s.leasesTable = quoteIdentifier(database + "_leases")
+	if err := s.createTable(c, database); err != nil {
+		db.Close()
+		return err
+	}
+	return nil
+}
+
+func (s *sqlCacheStorage) createTable(c context.Context, database string) error {
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS ` + s.table + ` (
+			seq ` + s.dialect.seqColumn + `,
+			collection TEXT NOT NULL,
+			id TEXT NOT NULL,
+			ver TEXT NOT NULL,
+			data TEXT NOT NULL,
+			codec TEXT NOT NULL DEFAULT '',
+			compression TEXT NOT NULL DEFAULT '',
+			key_id TEXT NOT NULL DEFAULT '',
+			locked_at BIGINT,
+			locked_by TEXT,
+			fence BIGINT NOT NULL DEFAULT 0
+		)`,
+		`CREATE INDEX IF NOT EXISTS ` + quoteIdentifier(database+"_collection_ver_id") + ` ON ` + s.table + ` (collection, ver, id, seq)`,
+		`CREATE INDEX IF NOT EXISTS ` + quoteIdentifier(database+"_collection_id") + ` ON ` + s.table + ` (collection, id, seq)`,
+		`CREATE TABLE IF NOT EXISTS ` + s.leasesTable + ` (
+			name TEXT NOT NULL,
+			slot INTEGER NOT NULL,
+			owner TEXT,
+			expires_at BIGINT NOT NULL DEFAULT 0,
+			fence BIGINT NOT NULL DEFAULT 0,
+			PRIMARY KEY (name, slot)
+		)`,
+	}
+	for _, statement := range statements {
+		if _, err := s.db.ExecContext(c, statement); err != nil {
+			return err
+		}
+	}
+	// tables created by earlier versions lack the columns added since, which are empty for the rows already there
+	for _, column := range [][2]string{
+		{"codec", "TEXT NOT NULL DEFAULT ''"},
+		{"compression", "TEXT NOT NULL DEFAULT ''"},
+		{"key_id", "TEXT NOT NULL DEFAULT ''"},
+		{"fence", "BIGINT NOT NULL DEFAULT 0"},
+	} {
+		if _, err := s.db.ExecContext(c, `SELECT `+column[0]+` FROM `+s.table+` WHERE 1 = 0`); err != nil {
+			if _, err := s.db.ExecContext(c, `ALTER TABLE `+s.table+` ADD COLUMN `+column[0]+` `+column[1]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s sqlCacheStorage) Close(c context.Context) error {
+	return s.db.Close()
+}
+
+func (s *sqlCacheStorage) GetCacheStorageClient() (cacheStorage.CacheStorageGetter, cacheStorage.CacheStorageSetter) {
+	client := sqlClient{storage: s}
+	return client, client
+}
+
+func (s *sqlCacheStorage) GetLocker() *cacheStorage.Locker {
+	return cacheStorage.NewLocker(sqlLeases{storage: s}, s.options.Lock)
+}
+
+// query formats query with the table names and rebinds its placeholders.
+func (s *sqlCacheStorage) query(query string) string {
+	query = strings.Replace(query, "{table}", s.table, -1)
+	return s.dialect.rebind(strings.Replace(query, "{leases}", s.leasesTable, -1))
+}
+
+func quoteIdentifier(name string) string {
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
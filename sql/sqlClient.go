@@ -0,0 +1,502 @@
+package sql
+
+import (
+	"context"
+	gosql "database/sql"
+	"fmt"
+	. "github.com/orchestd/cacheStorage"
+	"github.com/orchestd/cacheStorage/internal/dest"
+	"strings"
+	"time"
+)
+
+const cacheVersionsCollectionName = "cacheVersions"
+
+/*
+Every item is a row of (seq, collection, id, ver, data, codec, compression, key_id), data being the item as encoded by
+the codec named in codec, or as JSON when codec is empty, then compressed by the compressor named in compression and
+encrypted with the key whose id is key_id. Like a mongo collection without a unique index the same id+ver may hold
+more than one row; single item operations act on the one with the lowest seq, the first one inserted.
+*/
+const (
+	firstItemQuery = `SELECT seq FROM {table} WHERE collection = ? AND ver = ? AND id = ? ORDER BY seq LIMIT 1`
+	firstByIdQuery = `SELECT seq, data, codec, compression, key_id, locked_at, locked_by FROM {table} WHERE collection = ? AND id = ? ORDER BY seq LIMIT 1`
+	insertQuery    = `INSERT INTO {table} (collection, id, ver, data, codec, compression, key_id) VALUES (?, ?, ?, ?, ?, ?, ?)`
+)
+
+// encodedItem is the data, codec, compression and key_id columns of a row.
+type encodedItem struct {
+	data        string
+	codec       string
+	compression string
+	keyId       string
+}
+
+func (m sqlClient) encode(collectionName string, item interface{}) (encodedItem, error) {
+	encoded, err := m.storage.options.EncodeItem(collectionName, item)
+	if err != nil {
+		return encodedItem{}, err
+	}
+	return columns(encoded), nil
+}
+
+func columns(encoded EncodedItem) encodedItem {
+	return encodedItem{data: encoded.Text(), codec: encoded.Codec, compression: encoded.Compression, keyId: encoded.KeyId}
+}
+
+func (m sqlClient) decode(item encodedItem) func(interface{}) error {
+	return func(i interface{}) error {
+		return m.storage.options.DecodeText(EncodedItem{Codec: item.codec, Compression: item.compression, KeyId: item.keyId}, item.data, i)
+	}
+}
+
+type sqlClient struct {
+	storage *sqlCacheStorage
+}
+
+func (m sqlClient) GetLatestVersions(c context.Context) ([]CacheVersion, CacheStorageError) {
+	cacheVersions := make(map[string]CacheVersion)
+	var versions []CacheVersion
+	err := m.GetAll(c, cacheVersionsCollectionName, "1", cacheVersions)
+	if err != nil {
+		return versions, err
+	}
+	for i := range cacheVersions {
+		versions = append(versions, cacheVersions[i])
+	}
+	return versions, nil
+}
+
+func (m sqlClient) GetLatestCollectionVersion(c context.Context, collection string) (CacheVersion, CacheStorageError) {
+	cacheVersion := CacheVersion{}
+	err := m.GetById(c, cacheVersionsCollectionName, collection, "1", &cacheVersion)
+	if err != nil {
+		return cacheVersion, err
+	}
+	return cacheVersion, nil
+}
+
+func (m sqlClient) GetStoredVersions(c context.Context, collectionName string) ([]string, CacheStorageError) {
+	query := m.storage.query(`SELECT DISTINCT ver FROM {table} WHERE collection = ? ORDER BY ver`)
+	rows, err := m.storage.db.QueryContext(c, query, collectionName)
+	if err != nil {
+		return nil, NewCacheStorageError(err)
+	}
+	defer rows.Close()
+	var vers []string
+	for rows.Next() {
+		var ver string
+		if err := rows.Scan(&ver); err != nil {
+			return nil, NewCacheStorageError(err)
+		}
+		vers = append(vers, ver)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, NewCacheStorageError(err)
+	}
+	return vers, nil
+}
+
+func (m sqlClient) GetById(ctx context.Context, collectionName string, id string, ver string, dst interface{}) CacheStorageError {
+	err := dest.Check(dst, true, true, false, false)
+	if err != nil {
+		return NewCacheStorageError(fmt.Errorf("%w: %q", ErrInvalidDestType, err))
+	}
+	var item encodedItem
+	query := m.storage.query(`SELECT data, codec, compression, key_id FROM {table} WHERE collection = ? AND ver = ? AND id = ? ORDER BY seq LIMIT 1`)
+	err = m.storage.db.QueryRowContext(ctx, query, collectionName, ver, id).Scan(&item.data, &item.codec, &item.compression, &item.keyId)
+	if err != nil {
+		if err == gosql.ErrNoRows {
+			return NewCacheStorageError(fmt.Errorf("%w: %q", ErrNotFound, err))
+		}
+		return NewCacheStorageError(err)
+	}
+	if err := m.decode(item)(dst); err != nil {
+		return NewCacheStorageError(err)
+	}
+	return nil
+}
+
+func (m sqlClient) getMany(ctx context.Context, collectionName string, filterByIds []string, ver string, dst interface{}) CacheStorageError {
+	err := dest.Check(dst, false, true, true, false)
+	if err != nil {
+		return NewCacheStorageError(fmt.Errorf("%w: %q", ErrInvalidDestType, err))
+	}
+	query := `SELECT id, data, codec, compression, key_id FROM {table} WHERE collection = ? AND ver = ?`
+	args := []interface{}{collectionName, ver}
+	if len(filterByIds) > 0 {
+		query += ` AND id IN (?` + strings.Repeat(`, ?`, len(filterByIds)-1) + `)`
+		for _, id := range filterByIds {
+			args = append(args, id)
+		}
+	}
+	rows, err := m.storage.db.QueryContext(ctx, m.storage.query(query+` ORDER BY seq`), args...)
+	if err != nil {
+		return NewCacheStorageError(err)
+	}
+	defer rows.Close()
+	foundElementIds := make(map[string]bool)
+	for rows.Next() {
+		var id string
+		var item encodedItem
+		if err := rows.Scan(&id, &item.data, &item.codec, &item.compression, &item.keyId); err != nil {
+			return NewCacheStorageError(err)
+		}
+		if err := dest.SetMapItem(dst, id, m.decode(item)); err != nil {
+			return NewCacheStorageError(err)
+		}
+		foundElementIds[id] = true
+	}
+	if err := rows.Err(); err != nil {
+		return NewCacheStorageError(err)
+	}
+	if len(foundElementIds) < len(filterByIds) {
+		var notFoundElements []string
+		for _, id := range filterByIds {
+			if _, ok := foundElementIds[id]; !ok {
+				notFoundElements = append(notFoundElements, id)
+			}
+		}
+		// len == 0 meaning the func got ids with duplicates
+		if len(notFoundElements) > 0 {
+			err := fmt.Errorf("elements with id: %v not found in collection %v by version %v", notFoundElements, collectionName, ver)
+			return NewCacheStorageError(fmt.Errorf("%w: %q", ErrNotFound, err))
+		}
+	}
+	return nil
+}
+
+func (m sqlClient) GetManyByIds(ctx context.Context, collectionName string, ids []string, ver string, dst interface{}) CacheStorageError {
+	if len(ids) == 0 {
+		return nil
+	}
+	return m.getMany(ctx, collectionName, ids, ver, dst)
+}
+
+func (m sqlClient) GetArrayBySingleId(ctx context.Context, collectionName string, id string, ver string, dst interface{}) CacheStorageError {
+	err := dest.Check(dst, false, true, false, true)
+	if err != nil {
+		return NewCacheStorageError(fmt.Errorf("%w: %q", ErrInvalidDestType, err))
+	}
+	query := m.storage.query(`SELECT data, codec, compression, key_id FROM {table} WHERE collection = ? AND ver = ? AND id = ? ORDER BY seq`)
+	rows, err := m.storage.db.QueryContext(ctx, query, collectionName, ver, id)
+	if err != nil {
+		return NewCacheStorageError(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var item encodedItem
+		if err := rows.Scan(&item.data, &item.codec, &item.compression, &item.keyId); err != nil {
+			return NewCacheStorageError(err)
+		}
+		if err := dest.AppendSliceItem(dst, m.decode(item)); err != nil {
+			return NewCacheStorageError(err)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return NewCacheStorageError(err)
+	}
+	return nil
+}
+
+func (m sqlClient) GetAll(ctx context.Context, collectionName string, ver string, dst interface{}) CacheStorageError {
+	return m.getMany(ctx, collectionName, nil, ver, dst)
+}
+
+func (m sqlClient) Insert(ctx context.Context, collectionName string, id string, ver string, item interface{}) CacheStorageError {
+	encoded, err := m.encode(collectionName, item)
+	if err != nil {
+		return NewCacheStorageError(err)
+	}
+	query := m.storage.query(insertQuery)
+	if _, err := m.storage.db.ExecContext(ctx, query, collectionName, id, ver, encoded.data, encoded.codec, encoded.compression, encoded.keyId); err != nil {
+		return NewCacheStorageError(err)
+	}
+	return nil
+}
+
+func (m sqlClient) InsertMany(ctx context.Context, collectionName string, ver string, items map[string]interface{}) CacheStorageError {
+	encoded, err := m.storage.options.EncodeItems(collectionName, items)
+	if err != nil {
+		return NewCacheStorageError(err)
+	}
+	err = m.inTx(ctx, func(tx *gosql.Tx) error {
+		stmt, err := tx.PrepareContext(ctx, m.storage.query(insertQuery))
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+		for id, e := range encoded {
+			item := columns(e)
+			if _, err := stmt.ExecContext(ctx, collectionName, id, ver, item.data, item.codec, item.compression, item.keyId); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return NewCacheStorageError(err)
+	}
+	return nil
+}
+
+func (m sqlClient) replace(ctx context.Context, collectionName string, id string, ver string, item interface{}, upsert bool) CacheStorageError {
+	encoded, err := m.encode(collectionName, item)
+	if err != nil {
+		return NewCacheStorageError(err)
+	}
+	err = m.inTx(ctx, func(tx *gosql.Tx) error {
+		query := `UPDATE {table} SET data = ?, codec = ?, compression = ?, key_id = ?, locked_at = NULL, locked_by = NULL WHERE seq = (` + firstItemQuery + `)`
+		args := []interface{}{encoded.data, encoded.codec, encoded.compression, encoded.keyId, collectionName, ver, id}
+		guarded := m.storage.options.Lock.GuardUpdates
+		if guarded {
+			query += ` AND (locked_by IS NULL OR locked_at < ?)`
+			args = append(args, unixMilli(time.Now().Add(-m.storage.options.Lock.Lease)))
+		}
+		res, err := tx.ExecContext(ctx, m.storage.query(query), args...)
+		if err != nil {
+			return err
+		}
+		if updated, err := res.RowsAffected(); err != nil || updated > 0 {
+			return err
+		}
+		if guarded {
+			// nothing was updated, either because the row is locked or because there is none
+			var seq int64
+			err := tx.QueryRowContext(ctx, m.storage.query(firstItemQuery), collectionName, ver, id).Scan(&seq)
+			if err == nil {
+				return fmt.Errorf("%w: item %v of collection %v is locked by another owner", ErrLockNotHeld, id, collectionName)
+			} else if err != gosql.ErrNoRows {
+				return err
+			}
+		}
+		if !upsert {
+			return nil
+		}
+		_, err = tx.ExecContext(ctx, m.storage.query(insertQuery), collectionName, id, ver, encoded.data, encoded.codec, encoded.compression, encoded.keyId)
+		return err
+	})
+	if err != nil {
+		return NewCacheStorageError(err)
+	}
+	return nil
+}
+
+func (m sqlClient) InsertOrUpdate(ctx context.Context, collectionName string, id string, ver string, item interface{}) CacheStorageError {
+	return m.replace(ctx, collectionName, id, ver, item, true)
+}
+
+func (m sqlClient) Update(ctx context.Context, collectionName string, id string, ver string, item interface{}) CacheStorageError {
+	return m.replace(ctx, collectionName, id, ver, item, false)
+}
+
+func (m sqlClient) Remove(ctx context.Context, collectionName string, id string, ver string) CacheStorageError {
+	query := m.storage.query(`DELETE FROM {table} WHERE seq = (` + firstItemQuery + `)`)
+	if _, err := m.storage.db.ExecContext(ctx, query, collectionName, ver, id); err != nil {
+		return NewCacheStorageError(err)
+	}
+	return nil
+}
+
+func (m sqlClient) RemoveAll(ctx context.Context, collectionName string, ver string) CacheStorageError {
+	query := m.storage.query(`DELETE FROM {table} WHERE collection = ? AND ver = ?`)
+	if _, err := m.storage.db.ExecContext(ctx, query, collectionName, ver); err != nil {
+		return NewCacheStorageError(err)
+	}
+	return nil
+}
+
+func (m sqlClient) inTx(ctx context.Context, f func(tx *gosql.Tx) error) error {
+	tx, err := m.storage.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := f(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// lockKey takes the dialect's transaction scoped lock on key, doing nothing on databases that serialize their writes
+// anyway.
+func (m sqlClient) lockKey(ctx context.Context, tx *gosql.Tx, key string) error {
+	if m.storage.dialect.lockKey == "" {
+		return nil
+	}
+	_, err := tx.ExecContext(ctx, m.storage.dialect.rebind(m.storage.dialect.lockKey), m.storage.table+":"+key)
+	return err
+}
+
+// tryLock locks the first row of id for owner unless someone else holds an unexpired lock on it, and returns the
+// row's data and its fence once owner holds the lock, or a zero fence. On postgres it first takes the dialect's lock on
+// id, so concurrent attempts on the same id run one after the other, each seeing the lock the previous one took.
+func (m sqlClient) tryLock(ctx context.Context, collectionName string, id string, owner string) (item encodedItem, fence int64, err error) {
+	err = m.inTx(ctx, func(tx *gosql.Tx) error {
+		if err := m.lockKey(ctx, tx, collectionName+":id:"+id); err != nil {
+			return err
+		}
+		var seq int64
+		var lockedAt gosql.NullInt64
+		var currentOwner gosql.NullString
+		query := m.storage.query(firstByIdQuery + m.storage.dialect.lockRow)
+		err := tx.QueryRowContext(ctx, query, collectionName, id).Scan(&seq, &item.data, &item.codec, &item.compression, &item.keyId, &lockedAt, &currentOwner)
+		if err == gosql.ErrNoRows {
+			err := fmt.Errorf("element with id: %v not found in collection %v", id, collectionName)
+			return fmt.Errorf("%w: %q", ErrNotFound, err)
+		} else if err != nil {
+			return err
+		}
+		now := unixMilli(time.Now())
+		if !currentOwner.Valid || !lockedAt.Valid || now-lockedAt.Int64 > m.storage.options.Lock.Lease.Milliseconds() {
+			query := m.storage.query(`UPDATE {table} SET locked_at = ?, locked_by = ?, fence = fence + 1 WHERE seq = ?`)
+			if _, err := tx.ExecContext(ctx, query, now, owner, seq); err != nil {
+				return err
+			}
+			return tx.QueryRowContext(ctx, m.storage.query(`SELECT fence FROM {table} WHERE seq = ?`), seq).Scan(&fence)
+		}
+		return nil
+	})
+	return item, fence, err
+}
+
+func (m sqlClient) GetAndLockById(c context.Context, collectionName string, id string, dst interface{}) (LockHandle, CacheStorageError) {
+	handle := LockHandle{Collection: collectionName, Id: id, Owner: NewLockOwner()}
+	wait := m.storage.options.Lock.NewLockWait(collectionName, id)
+	for {
+		item, fence, err := m.tryLock(c, collectionName, id, handle.Owner)
+		if err != nil {
+			return LockHandle{}, NewCacheStorageError(err)
+		}
+		if fence > 0 {
+			if err := m.decode(item)(dst); err != nil {
+				return LockHandle{}, NewCacheStorageError(err)
+			}
+			handle.Fence = fence
+			return handle, nil
+		}
+		if err := wait.Sleep(c, nil); err != nil {
+			return LockHandle{}, NewCacheStorageError(err)
+		}
+	}
+}
+
+/*
+ReleaseLockedById in most cases will do nothing, cause UpdateAndRelease clears the lock of the row it writes and
+therefore "automatically releases" the item a specific session locked
+*/
+func (m sqlClient) ReleaseLockedById(c context.Context, lock LockHandle) CacheStorageError {
+	query := m.storage.query(`UPDATE {table} SET locked_at = NULL, locked_by = NULL WHERE seq = (
+		SELECT seq FROM {table} WHERE collection = ? AND id = ? AND locked_by = ? ORDER BY seq LIMIT 1)`)
+	if _, err := m.storage.db.ExecContext(c, query, lock.Collection, lock.Id, lock.Owner); err != nil {
+		return NewCacheStorageError(err)
+	}
+	return nil
+}
+
+func (m sqlClient) UpdateAndRelease(c context.Context, lock LockHandle, item interface{}) CacheStorageError {
+	encoded, err := m.encode(lock.Collection, item)
+	if err != nil {
+		return NewCacheStorageError(err)
+	}
+	query := m.storage.query(`UPDATE {table} SET data = ?, codec = ?, compression = ?, key_id = ?, locked_at = NULL, locked_by = NULL WHERE seq = (
+		SELECT seq FROM {table} WHERE collection = ? AND id = ? AND locked_by = ? AND locked_at >= ? ORDER BY seq LIMIT 1)`)
+	res, err := m.storage.db.ExecContext(c, query, encoded.data, encoded.codec, encoded.compression, encoded.keyId,
+		lock.Collection, lock.Id, lock.Owner, unixMilli(time.Now().Add(-m.storage.options.Lock.Lease)))
+	if err != nil {
+		return NewCacheStorageError(err)
+	}
+	if updated, err := res.RowsAffected(); err != nil {
+		return NewCacheStorageError(err)
+	} else if updated == 0 {
+		return NewCacheStorageError(fmt.Errorf("%w: item %v of collection %v", ErrLockNotHeld, lock.Id, lock.Collection))
+	}
+	return nil
+}
+
+func (m sqlClient) RenewLock(c context.Context, lock LockHandle) CacheStorageError {
+	now := unixMilli(time.Now())
+	query := m.storage.query(`UPDATE {table} SET locked_at = ? WHERE seq = (
+		SELECT seq FROM {table} WHERE collection = ? AND id = ? AND locked_by = ? AND locked_at >= ? ORDER BY seq LIMIT 1)`)
+	res, err := m.storage.db.ExecContext(c, query, now, lock.Collection, lock.Id, lock.Owner, now-m.storage.options.Lock.Lease.Milliseconds())
+	if err != nil {
+		return NewCacheStorageError(err)
+	}
+	if renewed, err := res.RowsAffected(); err != nil {
+		return NewCacheStorageError(err)
+	} else if renewed == 0 {
+		return NewCacheStorageError(fmt.Errorf("%w: item %v of collection %v", ErrLockNotHeld, lock.Id, lock.Collection))
+	}
+	return nil
+}
+
+func (m sqlClient) UpdateCacheVersion(c context.Context, collection string, update func(cacheVersion *CacheVersion) error) CacheStorageError {
+	err := m.inTx(c, func(tx *gosql.Tx) error {
+		if err := m.lockKey(c, tx, cacheVersionsCollectionName+":"+collection); err != nil {
+			return err
+		}
+		cacheVersion := CacheVersion{CollectionName: collection}
+		var seq int64
+		var item encodedItem
+		query := m.storage.query(`SELECT seq, data, codec, compression, key_id FROM {table} WHERE collection = ? AND ver = ? AND id = ? ORDER BY seq LIMIT 1`)
+		err := tx.QueryRowContext(c, query, cacheVersionsCollectionName, "1", collection).Scan(&seq, &item.data, &item.codec, &item.compression, &item.keyId)
+		if err != nil && err != gosql.ErrNoRows {
+			return err
+		}
+		exists := err == nil
+		if exists {
+			if err := m.decode(item)(&cacheVersion); err != nil {
+				return err
+			}
+		}
+		if err := update(&cacheVersion); err != nil {
+			return err
+		}
+		if item, err = m.encode(cacheVersionsCollectionName, cacheVersion); err != nil {
+			return err
+		}
+		if exists {
+			_, err = tx.ExecContext(c, m.storage.query(`UPDATE {table} SET data = ?, codec = ?, compression = ?, key_id = ? WHERE seq = ?`), item.data, item.codec, item.compression, item.keyId, seq)
+			return err
+		}
+		_, err = tx.ExecContext(c, m.storage.query(insertQuery), cacheVersionsCollectionName, collection, "1", item.data, item.codec, item.compression, item.keyId)
+		return err
+	})
+	if err != nil {
+		return NewCacheStorageError(err)
+	}
+	return nil
+}
+
+/*
+MoveVersion checks toVer is empty and updates the rows in a single transaction. On postgres the transaction first takes
+the dialect's lock on toVer, so concurrent moves into the same ver run one after the other and the later one sees the
+rows of the earlier one. Inserts don't take that lock, so items another writer inserts into toVer during the move end
+up mixed with the moved ones.
+*/
+func (m sqlClient) MoveVersion(c context.Context, collectionName string, fromVer string, toVer string) (int, CacheStorageError) {
+	var moved int64
+	err := m.inTx(c, func(tx *gosql.Tx) error {
+		if err := m.lockKey(c, tx, collectionName+":ver:"+toVer); err != nil {
+			return err
+		}
+		var exists int
+		query := m.storage.query(`SELECT 1 FROM {table} WHERE collection = ? AND ver = ? LIMIT 1`)
+		if err := tx.QueryRowContext(c, query, collectionName, toVer).Scan(&exists); err == nil {
+			err := fmt.Errorf("ver %v of collection %v", toVer, collectionName)
+			return fmt.Errorf("%w: %q", ErrVerInUse, err)
+		} else if err != gosql.ErrNoRows {
+			return err
+		}
+		res, err := tx.ExecContext(c, m.storage.query(`UPDATE {table} SET ver = ? WHERE collection = ? AND ver = ?`), toVer, collectionName, fromVer)
+		if err != nil {
+			return err
+		}
+		moved, err = res.RowsAffected()
+		return err
+	})
+	if err != nil {
+		return 0, NewCacheStorageError(err)
+	}
+	return int(moved), nil
+}
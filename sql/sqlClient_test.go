@@ -0,0 +1,42 @@
+package sql
+
+import (
+	"context"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/orchestd/cacheStorage"
+	"github.com/orchestd/cacheStorage/cacheStoragetest"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConformance(t *testing.T) {
+	cacheStoragetest.RunConformance(t, func(t *testing.T, options ...cacheStorage.StorageOption) cacheStorage.CacheStorage {
+		dir, err := ioutil.TempDir("", "cacheStorage")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			os.RemoveAll(dir)
+		})
+		cache := NewSqlCacheStorage("sqlite3", options...)
+		if err := cache.Connect(context.TODO(), filepath.Join(dir, "cache.db"), "", "", "cache"); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			cache.Close(context.TODO())
+		})
+		return cache
+	})
+}
+
+func TestRebind(t *testing.T) {
+	query := "SELECT data FROM t WHERE collection = ? AND id IN (?, ?)"
+	if got := postgres.rebind(query); got != "SELECT data FROM t WHERE collection = $1 AND id IN ($2, $3)" {
+		t.Fatalf("unexpected postgres query %q", got)
+	}
+	if got := sqlite.rebind(query); got != query {
+		t.Fatalf("unexpected sqlite query %q", got)
+	}
+}
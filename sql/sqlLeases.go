@@ -0,0 +1,77 @@
+package sql
+
+import (
+	"context"
+	gosql "database/sql"
+	"fmt"
+	. "github.com/orchestd/cacheStorage"
+	"time"
+)
+
+/*
+Every slot of a named lock is a row of (name, slot, owner, expires_at, fence), inserted the first time the slot is
+tried. owner is NULL while the slot is free, and expires_at is when its lease runs out, in unix milliseconds.
+*/
+type sqlLeases struct {
+	storage *sqlCacheStorage
+}
+
+func unixMilli(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+func (m sqlLeases) AcquireLease(c context.Context, name string, slots int, owner string) (int64, CacheStorageError) {
+	var fence int64
+	err := sqlClient{storage: m.storage}.inTx(c, func(tx *gosql.Tx) error {
+		now := time.Now()
+		for slot := 0; slot < slots; slot++ {
+			query := m.storage.query(`INSERT INTO {leases} (name, slot) VALUES (?, ?) ON CONFLICT DO NOTHING`)
+			if _, err := tx.ExecContext(c, query, name, slot); err != nil {
+				return err
+			}
+			query = m.storage.query(`UPDATE {leases} SET owner = ?, expires_at = ?, fence = fence + 1
+				WHERE name = ? AND slot = ? AND (owner IS NULL OR expires_at < ?)`)
+			res, err := tx.ExecContext(c, query, owner, unixMilli(now.Add(m.storage.options.Lock.Lease)), name, slot, unixMilli(now))
+			if err != nil {
+				return err
+			}
+			taken, err := res.RowsAffected()
+			if err != nil {
+				return err
+			}
+			if taken == 0 {
+				continue
+			}
+			query = m.storage.query(`SELECT fence FROM {leases} WHERE name = ? AND slot = ?`)
+			return tx.QueryRowContext(c, query, name, slot).Scan(&fence)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, NewCacheStorageError(err)
+	}
+	return fence, nil
+}
+
+func (m sqlLeases) ReleaseLease(c context.Context, name string, slots int, owner string) CacheStorageError {
+	query := m.storage.query(`UPDATE {leases} SET owner = NULL WHERE name = ? AND slot < ? AND owner = ?`)
+	if _, err := m.storage.db.ExecContext(c, query, name, slots, owner); err != nil {
+		return NewCacheStorageError(err)
+	}
+	return nil
+}
+
+func (m sqlLeases) RenewLease(c context.Context, name string, slots int, owner string) CacheStorageError {
+	now := time.Now()
+	query := m.storage.query(`UPDATE {leases} SET expires_at = ? WHERE name = ? AND slot < ? AND owner = ? AND expires_at >= ?`)
+	res, err := m.storage.db.ExecContext(c, query, unixMilli(now.Add(m.storage.options.Lock.Lease)), name, slots, owner, unixMilli(now))
+	if err != nil {
+		return NewCacheStorageError(err)
+	}
+	if renewed, err := res.RowsAffected(); err != nil {
+		return NewCacheStorageError(err)
+	} else if renewed == 0 {
+		return NewCacheStorageError(fmt.Errorf("%w: %v", ErrLockNotHeld, name))
+	}
+	return nil
+}
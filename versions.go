@@ -0,0 +1,235 @@
+package cacheStorage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Latest is the ver that items written outside of any published version are kept under, mutable unlike the others.
+const Latest = "latest"
+
+var ErrNoActiveVersion = fmt.Errorf("%w: no active version", ErrNotFound)
+var ErrVersionCycle = errors.New("Cyclic LockVersionUpon")
+
+// GetStoredVersions calls the GetStoredVersions of getter, failing with ErrNotSupported when getter is not a
+// StoredVersionsLister.
+func GetStoredVersions(c context.Context, getter CacheStorageGetter, collectionName string) ([]string, CacheStorageError) {
+	lister, ok := getter.(StoredVersionsLister)
+	if !ok {
+		return nil, NewCacheStorageError(fmt.Errorf("%w: %T can't list the stored versions of collection %v", ErrNotSupported, getter, collectionName))
+	}
+	return lister.GetStoredVersions(c, collectionName)
+}
+
+/*
+ActiveVersion returns the version in effect at now, which is the pinned version if there is one and otherwise the
+ScheduledVersion.
+*/
+func (v CacheVersion) ActiveVersion(now time.Time) (Version, bool) {
+	if v.Pin != nil {
+		for _, version := range v.Versions {
+			if version.Version == v.Pin.Version {
+				return version, true
+			}
+		}
+		return Version{Version: v.Pin.Version, TimedTo: v.Pin.PinnedAt}, true
+	}
+	return v.ScheduledVersion(now)
+}
+
+/*
+ScheduledVersion returns the version the schedule puts in effect at now, ignoring any pin, which is the one timed to
+the latest moment not after now. When several versions are timed to the same moment the one listed last wins. It
+returns false while every version is still scheduled for the future.
+*/
+func (v CacheVersion) ScheduledVersion(now time.Time) (Version, bool) {
+	var active Version
+	found := false
+	for _, version := range v.Versions {
+		if !version.TimedTo.After(now) && (!found || !version.TimedTo.Before(active.TimedTo)) {
+			active, found = version, true
+		}
+	}
+	return active, found
+}
+
+// NextSwitch returns the first version scheduled to become active after now, or false if none is scheduled or the
+// collection is pinned.
+func (v CacheVersion) NextSwitch(now time.Time) (Version, bool) {
+	var next Version
+	if v.Pin != nil {
+		return next, false
+	}
+	found := false
+	for _, version := range v.Versions {
+		if version.TimedTo.After(now) && (!found || !version.TimedTo.After(next.TimedTo)) {
+			next, found = version, true
+		}
+	}
+	return next, found
+}
+
+/*
+GetActiveVersion resolves the version of collection in effect at now from its cacheVersions schedule. A collection
+locking its version upon others is resolved together with them, see ResolveVersionsAt.
+*/
+func GetActiveVersion(c context.Context, getter CacheStorageGetter, collection string, now time.Time) (Version, CacheStorageError) {
+	cacheVersion, err := getter.GetLatestCollectionVersion(c, collection)
+	if err != nil {
+		return Version{}, err
+	}
+	if len(cacheVersion.LockVersionUpon) > 0 && cacheVersion.Pin == nil {
+		cacheVersions, err := getter.GetLatestVersions(c)
+		if err != nil {
+			return Version{}, err
+		}
+		return newVersionResolver(cacheVersions, now).resolve(collection)
+	}
+	active, ok := cacheVersion.ActiveVersion(now)
+	if !ok {
+		return active, NewCacheStorageError(fmt.Errorf("%w of collection %v at %v", ErrNoActiveVersion, collection, now))
+	}
+	return active, nil
+}
+
+// ResolveVersions is ResolveVersionsAt right now.
+func ResolveVersions(c context.Context, getter CacheStorageGetter, collections ...string) (map[string]string, CacheStorageError) {
+	return ResolveVersionsAt(c, getter, time.Now(), collections...)
+}
+
+/*
+ResolveVersionsAt returns the ver in effect at now of every collection given, or of every collection in cacheVersions
+when none is, all from a single read of the cacheVersions collection. See ResolveCacheVersions.
+*/
+func ResolveVersionsAt(c context.Context, getter CacheStorageGetter, now time.Time, collections ...string) (map[string]string, CacheStorageError) {
+	cacheVersions, err := getter.GetLatestVersions(c)
+	if err != nil {
+		return nil, err
+	}
+	return ResolveCacheVersions(cacheVersions, now, collections...)
+}
+
+/*
+ResolveCacheVersions returns the ver in effect at now of every collection given, or of every one of cacheVersions when
+none is. A collection that locks its version upon others only switches to a version once every one of them has reached
+the version of the same name, so it resolves to the newest of its active or superseded versions that each of its
+dependencies resolves to or has already moved past. A pin overrides this as well.
+*/
+func ResolveCacheVersions(cacheVersions []CacheVersion, now time.Time, collections ...string) (map[string]string, CacheStorageError) {
+	if len(collections) == 0 {
+		for _, cacheVersion := range cacheVersions {
+			collections = append(collections, cacheVersion.CollectionName)
+		}
+	}
+	resolver := newVersionResolver(cacheVersions, now)
+	vers := make(map[string]string, len(collections))
+	for _, collection := range collections {
+		version, err := resolver.resolve(collection)
+		if err != nil {
+			return nil, err
+		}
+		vers[collection] = version.Version
+	}
+	return vers, nil
+}
+
+type versionResolver struct {
+	cacheVersions map[string]CacheVersion
+	now           time.Time
+	resolved      map[string]Version
+	resolving     map[string]bool
+}
+
+func newVersionResolver(cacheVersions []CacheVersion, now time.Time) *versionResolver {
+	r := &versionResolver{
+		cacheVersions: make(map[string]CacheVersion, len(cacheVersions)),
+		now:           now,
+		resolved:      make(map[string]Version),
+		resolving:     make(map[string]bool),
+	}
+	for _, cacheVersion := range cacheVersions {
+		r.cacheVersions[cacheVersion.CollectionName] = cacheVersion
+	}
+	return r
+}
+
+func (r *versionResolver) resolve(collection string) (Version, CacheStorageError) {
+	if version, ok := r.resolved[collection]; ok {
+		return version, nil
+	}
+	if r.resolving[collection] {
+		return Version{}, NewCacheStorageError(fmt.Errorf("%w: collection %v depends on itself", ErrVersionCycle, collection))
+	}
+	cacheVersion, ok := r.cacheVersions[collection]
+	if !ok {
+		err := fmt.Errorf("collection %v has no cache version", collection)
+		return Version{}, NewCacheStorageError(fmt.Errorf("%w: %q", ErrNotFound, err))
+	}
+	if len(cacheVersion.LockVersionUpon) == 0 || cacheVersion.Pin != nil {
+		active, ok := cacheVersion.ActiveVersion(r.now)
+		if !ok {
+			return active, NewCacheStorageError(fmt.Errorf("%w of collection %v at %v", ErrNoActiveVersion, collection, r.now))
+		}
+		r.resolved[collection] = active
+		return active, nil
+	}
+
+	r.resolving[collection] = true
+	defer delete(r.resolving, collection)
+	dependencies := make([]Version, len(cacheVersion.LockVersionUpon))
+	for i, dependency := range cacheVersion.LockVersionUpon {
+		version, err := r.resolve(dependency)
+		if err != nil {
+			return version, err
+		}
+		dependencies[i] = version
+	}
+	for _, candidate := range cacheVersion.activeAndSuperseded(r.now) {
+		if r.reached(cacheVersion.LockVersionUpon, dependencies, candidate.Version) {
+			r.resolved[collection] = candidate
+			return candidate, nil
+		}
+	}
+	err := fmt.Errorf("%w of collection %v at %v that %v reached", ErrNoActiveVersion, collection, r.now, cacheVersion.LockVersionUpon)
+	return Version{}, NewCacheStorageError(err)
+}
+
+// reached tells whether every dependency has a version named version that is already active, or was superseded by the
+// version it resolves to.
+func (r *versionResolver) reached(dependencies []string, resolved []Version, version string) bool {
+	for i, dependency := range dependencies {
+		cacheVersion := r.cacheVersions[dependency]
+		at, ok := findVersion(&cacheVersion, version)
+		if !ok || cacheVersion.Versions[at].TimedTo.After(r.now) || cacheVersion.Versions[at].TimedTo.After(resolved[i].TimedTo) {
+			return false
+		}
+	}
+	return true
+}
+
+// activeAndSuperseded returns the versions not timed after now, in the order they take over, the active one first.
+func (v CacheVersion) activeAndSuperseded(now time.Time) []Version {
+	var versions []Version
+	for i := len(v.Versions) - 1; i >= 0; i-- {
+		if !v.Versions[i].TimedTo.After(now) {
+			versions = append(versions, v.Versions[i])
+		}
+	}
+	// stable on the reversed schedule, so of versions timed to the same moment the one listed last comes first
+	sort.SliceStable(versions, func(i, j int) bool {
+		return versions[i].TimedTo.After(versions[j].TimedTo)
+	})
+	return versions
+}
+
+// GetByIdActive gets the item with the given id from the version of collectionName in effect right now.
+func GetByIdActive(c context.Context, getter CacheStorageGetter, collectionName string, id string, dest interface{}) CacheStorageError {
+	active, err := GetActiveVersion(c, getter, collectionName, time.Now())
+	if err != nil {
+		return err
+	}
+	return getter.GetById(c, collectionName, id, active.Version, dest)
+}
@@ -0,0 +1,123 @@
+package cacheStorage
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+var scheduleStart = time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+
+var testCacheVersion = CacheVersion{
+	CollectionName: "catalog",
+	Versions: []Version{
+		{Version: "2", TimedTo: scheduleStart.Add(time.Hour)},
+		{Version: "1", TimedTo: scheduleStart},
+		{Version: "3", TimedTo: scheduleStart.Add(2 * time.Hour)},
+		{Version: "3.1", TimedTo: scheduleStart.Add(2 * time.Hour)},
+	},
+}
+
+func TestActiveVersion(t *testing.T) {
+	Convey("Resolving the active version before any version is timed to", t, func() {
+		_, ok := testCacheVersion.ActiveVersion(scheduleStart.Add(-time.Second))
+		So(ok, ShouldBeFalse)
+	})
+	Convey("Resolving the active version at the moment a version is timed to", t, func() {
+		active, ok := testCacheVersion.ActiveVersion(scheduleStart.Add(time.Hour))
+		So(ok, ShouldBeTrue)
+		So(active.Version, ShouldEqual, "2")
+	})
+	Convey("Resolving the active version between two scheduled versions", t, func() {
+		active, _ := testCacheVersion.ActiveVersion(scheduleStart.Add(90 * time.Minute))
+		So(active.Version, ShouldEqual, "2")
+	})
+	Convey("Resolving the active version among versions timed to the same moment", t, func() {
+		active, _ := testCacheVersion.ActiveVersion(scheduleStart.Add(3 * time.Hour))
+		So(active.Version, ShouldEqual, "3.1")
+	})
+}
+
+func TestActiveVersionPinned(t *testing.T) {
+	pinned := testCacheVersion
+	pinned.Pin = &VersionPin{Version: "1", Author: "dana", PinnedAt: scheduleStart.Add(90 * time.Minute)}
+	Convey("Resolving the active version of a pinned collection", t, func() {
+		active, ok := pinned.ActiveVersion(scheduleStart.Add(3 * time.Hour))
+		So(ok, ShouldBeTrue)
+		So(active.Version, ShouldEqual, "1")
+		scheduled, _ := pinned.ScheduledVersion(scheduleStart.Add(3 * time.Hour))
+		So(scheduled.Version, ShouldEqual, "3.1")
+	})
+	Convey("Getting the next scheduled version of a pinned collection", t, func() {
+		_, ok := pinned.NextSwitch(scheduleStart)
+		So(ok, ShouldBeFalse)
+	})
+}
+
+func TestNextSwitch(t *testing.T) {
+	Convey("Getting the next scheduled version", t, func() {
+		next, ok := testCacheVersion.NextSwitch(scheduleStart)
+		So(ok, ShouldBeTrue)
+		So(next.Version, ShouldEqual, "2")
+		So(next.TimedTo, ShouldEqual, scheduleStart.Add(time.Hour))
+	})
+	Convey("Getting the next scheduled version among versions timed to the same moment", t, func() {
+		next, _ := testCacheVersion.NextSwitch(scheduleStart.Add(time.Hour))
+		So(next.Version, ShouldEqual, "3.1")
+	})
+	Convey("Getting the next scheduled version after the last one", t, func() {
+		_, ok := testCacheVersion.NextSwitch(scheduleStart.Add(2 * time.Hour))
+		So(ok, ShouldBeFalse)
+	})
+}
+
+func dependentCacheVersions(aSwitch time.Duration) []CacheVersion {
+	return []CacheVersion{
+		{
+			CollectionName:  "prices",
+			Versions:        []Version{{Version: "1", TimedTo: scheduleStart}, {Version: "2", TimedTo: scheduleStart.Add(aSwitch)}},
+			LockVersionUpon: []string{"catalog"},
+		},
+		{
+			CollectionName: "catalog",
+			Versions:       []Version{{Version: "1", TimedTo: scheduleStart}, {Version: "2", TimedTo: scheduleStart.Add(time.Hour)}},
+		},
+	}
+}
+
+func TestResolveCacheVersions(t *testing.T) {
+	Convey("Resolving a collection scheduled to switch before its dependency", t, func() {
+		cacheVersions := dependentCacheVersions(30 * time.Minute)
+		vers, err := ResolveCacheVersions(cacheVersions, scheduleStart.Add(45*time.Minute))
+		So(err, ShouldBeNil)
+		So(vers, ShouldResemble, map[string]string{"prices": "1", "catalog": "1"})
+		vers, err = ResolveCacheVersions(cacheVersions, scheduleStart.Add(time.Hour), "prices")
+		So(err, ShouldBeNil)
+		So(vers, ShouldResemble, map[string]string{"prices": "2"})
+	})
+	Convey("Resolving a collection scheduled to switch after its dependency", t, func() {
+		vers, err := ResolveCacheVersions(dependentCacheVersions(2*time.Hour), scheduleStart.Add(90*time.Minute))
+		So(err, ShouldBeNil)
+		So(vers, ShouldResemble, map[string]string{"prices": "1", "catalog": "2"})
+	})
+	Convey("Resolving a collection whose dependency is pinned back", t, func() {
+		cacheVersions := dependentCacheVersions(30 * time.Minute)
+		cacheVersions[1].Pin = &VersionPin{Version: "1", Author: "dana"}
+		vers, err := ResolveCacheVersions(cacheVersions, scheduleStart.Add(90*time.Minute))
+		So(err, ShouldBeNil)
+		So(vers, ShouldResemble, map[string]string{"prices": "1", "catalog": "1"})
+	})
+	Convey("Resolving collections locking their versions upon each other", t, func() {
+		cacheVersions := dependentCacheVersions(30 * time.Minute)
+		cacheVersions[1].LockVersionUpon = []string{"prices"}
+		_, err := ResolveCacheVersions(cacheVersions, scheduleStart.Add(90*time.Minute), "prices")
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, ErrVersionCycle.Error())
+	})
+	Convey("Resolving a collection whose dependency has no cache version", t, func() {
+		cacheVersions := dependentCacheVersions(30 * time.Minute)[:1]
+		_, err := ResolveCacheVersions(cacheVersions, scheduleStart.Add(90*time.Minute))
+		So(err, ShouldNotBeNil)
+		So(err.IsNotFound(), ShouldBeTrue)
+	})
+}